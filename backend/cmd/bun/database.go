@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+	"github.com/urfave/cli/v2"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server"
+	"github.com/Spiria-Digital/expense-manager/server/seed"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+func backup(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		var err error
+		if path, err = backupPath(""); err != nil {
+			return err
+		}
+	}
+	if err := service.BackupDatabase(c.Context, server.BunDB, path); err != nil {
+		return err
+	}
+	log.Info().Str("file", path).Msg("database backed up")
+	return nil
+}
+
+// backupPath returns a new file in the backups directory next to the
+// database, named after the current time and label.
+func backupPath(label string) (string, error) {
+	dir := filepath.Join(filepath.Dir(server.DatabasePath), "backups")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	name := "expenses-" + time.Now().UTC().Format("20060102-150405")
+	if label != "" {
+		name += "-" + label
+	}
+	return filepath.Join(dir, name+".db"), nil
+}
+
+// restore replaces the database with a backup. It refuses while a server is
+// running, another process uses the database or a migration holds the migrator
+// lock, and keeps the database and the server lock from the copy of the current
+// data to the replacement.
+func restore(c *cli.Context) error {
+	source := c.Args().First()
+	if source == "" {
+		return errors.New("missing backup file")
+	}
+	pending, err := checkBackup(c.Context, source)
+	if err != nil {
+		return fmt.Errorf("refusing to restore %s: %w", source, err)
+	}
+
+	// the servers hold the lock while they run, even without a connection
+	// open: the file replaced under them would not be the one they use
+	lock, err := storage.LockFile(server.ServerLockPath, true)
+	if errors.Is(err, storage.ErrLocked) {
+		return fmt.Errorf("refusing to restore %s: a server is running, stop it first", source)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	conn, err := server.BunDB.Conn(c.Context)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// fail right away rather than wait for the server to release the database
+	if _, err := conn.ExecContext(c.Context, "PRAGMA busy_timeout = 0"); err != nil {
+		return err
+	}
+	var version int
+	if err := conn.NewRaw("PRAGMA data_version").Scan(c.Context, &version); err != nil {
+		return fmt.Errorf("refusing to restore %s: %w", source, errDatabaseInUse(err))
+	}
+
+	// keep the current data, in case the wrong backup is restored. VACUUM
+	// cannot run in the transaction holding the lock, so the lock is taken
+	// right after and the database checked to be unchanged.
+	current, err := backupPath("before-restore")
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(c.Context, "VACUUM INTO ?", current); err != nil {
+		return fmt.Errorf("saving the current database: %w", err)
+	}
+	if err := lockDatabase(c.Context, conn, version); err != nil {
+		os.Remove(current)
+		return fmt.Errorf("refusing to restore %s: %w", source, err)
+	}
+	// the lock is held until the database file is replaced
+	defer conn.ExecContext(context.WithoutCancel(c.Context), "ROLLBACK")
+	log.Info().Str("file", current).Msg("current database saved")
+
+	if err := replaceFile(source, server.DatabasePath); err != nil {
+		return err
+	}
+	log.Info().Str("file", source).Msg("database restored")
+	if len(pending) > 0 {
+		log.Warn().Strs("pending", pending).Msg("the backup predates some migrations, run \"bun db migrate\"")
+	}
+	return nil
+}
+
+func errDatabaseInUse(err error) error {
+	return fmt.Errorf("the database is in use, stop the server first: %w", err)
+}
+
+// lockDatabase takes an exclusive lock on the database in a transaction of
+// conn, which is rolled back on failure. It fails when another process uses
+// the database, when the database changed since it reported version, or when
+// the migrator lock is held.
+func lockDatabase(ctx context.Context, conn bun.Conn, version int) error {
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		return errDatabaseInUse(err)
+	}
+	err := func() error {
+		var current int
+		if err := conn.NewRaw("PRAGMA data_version").Scan(ctx, &current); err != nil {
+			return err
+		}
+		if current != version {
+			return errors.New("the database changed while it was saved, stop the server first")
+		}
+		locked, err := service.MigrationsLocked(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errors.New("a migration is running; if none is, release the lock with \"bun db unlock\"")
+		}
+		return nil
+	}()
+	if err != nil {
+		conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+	}
+	return err
+}
+
+// checkBackup checks that the file is a sound SQLite database this build can
+// run on, and returns the migrations it still needs.
+func checkBackup(ctx context.Context, path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(file, header)
+	file.Close()
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return nil, errors.New("not a SQLite database")
+	}
+
+	db, err := storage.NewBunDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	problems, err := service.CheckIntegrity(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("the backup is damaged: %s", strings.Join(problems, "; "))
+	}
+	pending, unknown, err := service.MigrationStatus(ctx, db, migrations.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: unknown migrations %s", service.ErrDatabaseAhead, strings.Join(unknown, ", "))
+	}
+	return pending, nil
+}
+
+// replaceFile copies source over target, which is never left half written.
+func replaceFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// a journal left by the replaced database would be applied to the new one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(target + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func checkIntegrity(c *cli.Context) error {
+	problems, err := service.CheckIntegrity(c.Context, server.BunDB)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		log.Error().Msg(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d integrity problems found", len(problems))
+	}
+	log.Info().Msg("no integrity problem found")
+	return nil
+}
+
+func seedDemoData(c *cli.Context) error {
+	s := c.Uint64("seed")
+	summary, err := seed.Run(c.Context, server.BunDB, rand.New(rand.NewPCG(s, s)), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Int("users", summary.Users).
+		Int("categories", summary.Categories).
+		Int("expenses", summary.Expenses).
+		Str("password", seed.Password).
+		Msg("demo data created")
+	return nil
+}
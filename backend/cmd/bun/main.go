@@ -11,6 +11,8 @@ import (
 
 	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
 	"github.com/Spiria-Digital/expense-manager/server"
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/service"
 )
 
 func main() {
@@ -18,11 +20,12 @@ func main() {
 		Name: "bun",
 		Commands: []*cli.Command{
 			subCommands(migrate.NewMigrator(server.BunDB, migrations.Migrations)),
+			userCommands(),
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal().Err(err).Msg("Error running database migrations")
+		log.Fatal().Err(err).Msg("Error running command")
 	}
 }
 
@@ -42,12 +45,7 @@ func subCommands(migrator *migrate.Migrator) *cli.Command {
 				Name:  "migrate",
 				Usage: "migrate database",
 				Action: func(c *cli.Context) error {
-					if err := migrator.Lock(c.Context); err != nil {
-						return err
-					}
-					defer migrator.Unlock(c.Context)
-
-					group, err := migrator.Migrate(c.Context)
+					group, err := service.Migrate(c.Context, migrator.DB(), migrations.Migrations, config.Current.Database.MigrationLockTimeout)
 					if err != nil {
 						return err
 					}
@@ -84,6 +82,13 @@ func subCommands(migrator *migrate.Migrator) *cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:  "unlock",
+				Usage: "release the migrations lock left by an interrupted migration",
+				Action: func(c *cli.Context) error {
+					return migrator.Unlock(c.Context)
+				},
+			},
 			{
 				Name:  "status",
 				Usage: "show migration status",
@@ -102,6 +107,31 @@ func subCommands(migrator *migrate.Migrator) *cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:      "backup",
+				Usage:     "copy the database to a file, or to the backups directory, while it is in use",
+				ArgsUsage: "[file]",
+				Action:    backup,
+			},
+			{
+				Name:      "restore",
+				Usage:     "replace the database with a backup, once the server is stopped",
+				ArgsUsage: "file",
+				Action:    restore,
+			},
+			{
+				Name:   "check",
+				Usage:  "check the integrity of the database and its foreign keys",
+				Action: checkIntegrity,
+			},
+			{
+				Name:  "seed",
+				Usage: "create demo users, categories and a year of expenses for local development",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{Name: "seed", Value: 1, Usage: "random seed, the same one creates the same expenses"},
+				},
+				Action: seedDemoData,
+			},
 			{
 				Name:  "create",
 				Usage: "create new migration",
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		exists, err := columnExists(ctx, db, "users", "email_verified_at")
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := db.NewAddColumn().
+				Model((*models.User)(nil)).
+				ColumnExpr("email_verified_at TIMESTAMP").
+				Exec(ctx); err != nil {
+				return err
+			}
+
+			// accounts created before verification existed stay usable
+			if _, err := db.NewUpdate().
+				Model((*models.User)(nil)).
+				Set("email_verified_at = CURRENT_TIMESTAMP").
+				Where("email_verified_at IS NULL").
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		_, err = db.NewCreateTable().
+			Model((*models.UserToken)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		_, err := db.NewDropTable().
+			Model((*models.UserToken)(nil)).
+			IfExists().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.NewDropColumn().
+			Model((*models.User)(nil)).
+			Column("email_verified_at").
+			Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := addColumn(ctx, db, "users", "failed_login_attempts",
+			"failed_login_attempts INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := addColumn(ctx, db, "users", "locked_until", "locked_until TIMESTAMP")
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if err := dropColumn(ctx, db, "users", "locked_until"); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "users", "failed_login_attempts")
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		columns := [][2]string{
+			{"totp_secret", "totp_secret VARCHAR"},
+			{"totp_enabled", "totp_enabled BOOLEAN NOT NULL DEFAULT false"},
+			{"totp_last_step", "totp_last_step INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, column := range columns {
+			if _, err := addColumn(ctx, db, "users", column[0], column[1]); err != nil {
+				return err
+			}
+		}
+
+		_, err := db.NewCreateTable().
+			Model((*models.RecoveryCode)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		_, err := db.NewDropTable().
+			Model((*models.RecoveryCode)(nil)).
+			IfExists().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, column := range []string{"totp_last_step", "totp_enabled", "totp_secret"} {
+			if err := dropColumn(ctx, db, "users", column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
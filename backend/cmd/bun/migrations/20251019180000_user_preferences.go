@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := addColumn(ctx, db, "users", "default_currency",
+			"default_currency VARCHAR(3) NOT NULL DEFAULT 'USD'"); err != nil {
+			return err
+		}
+		_, err := addColumn(ctx, db, "users", "locale", "locale VARCHAR(35) NOT NULL DEFAULT 'en-US'")
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if err := dropColumn(ctx, db, "users", "locale"); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "users", "default_currency")
+	})
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.Organization)(nil)).
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := db.NewCreateTable().
+			Model((*models.OrganizationMember)(nil)).
+			ForeignKey("(organization_id) REFERENCES organizations (id) ON DELETE CASCADE").
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := addColumn(ctx, db, "expenses", "organization_id",
+			"organization_id INTEGER"); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.Expense)(nil)).
+			Index("expenses_organization_id_date_idx").
+			Column("organization_id", "date").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropIndex().
+			Model((*models.Expense)(nil)).
+			Index("expenses_organization_id_date_idx").
+			IfExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		if err := dropColumn(ctx, db, "expenses", "organization_id"); err != nil {
+			return err
+		}
+
+		for _, model := range []any{(*models.OrganizationMember)(nil), (*models.Organization)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
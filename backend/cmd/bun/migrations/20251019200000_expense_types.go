@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		columns := [][2]string{
+			{"type", "type VARCHAR(16) NOT NULL DEFAULT 'receipt'"},
+			{"rate", "rate REAL"},
+			{"distance_km", "distance_km REAL"},
+			{"vehicle", "vehicle VARCHAR(32)"},
+			{"destination", "destination VARCHAR(255)"},
+			{"days", "days INTEGER"},
+			{"meals_provided", "meals_provided INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, column := range columns {
+			if _, err := addColumn(ctx, db, "expenses", column[0], column[1]); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []any{(*models.MileageRate)(nil), (*models.PerDiemRate)(nil)} {
+			if _, err := db.NewCreateTable().Model(model).IfNotExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		for _, model := range []any{(*models.PerDiemRate)(nil), (*models.MileageRate)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		for _, column := range []string{"meals_provided", "days", "destination", "vehicle", "distance_km", "rate", "type"} {
+			if err := dropColumn(ctx, db, "expenses", column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.PolicyRule)(nil)).
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := db.NewCreateTable().
+			Model((*models.PolicyViolation)(nil)).
+			ForeignKey("(expense_id) REFERENCES expenses (id) ON DELETE CASCADE").
+			ForeignKey("(rule_id) REFERENCES policy_rules (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.PolicyViolation)(nil)).
+			Index("policy_violations_expense_id_idx").
+			Column("expense_id").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		for _, model := range []any{(*models.PolicyViolation)(nil), (*models.PolicyRule)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.WebhookSubscription)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			ForeignKey("(organization_id) REFERENCES organizations (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := db.NewCreateTable().
+			Model((*models.WebhookDelivery)(nil)).
+			ForeignKey("(subscription_id) REFERENCES webhook_subscriptions (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.WebhookDelivery)(nil)).
+			Index("webhook_deliveries_status_next_attempt_at_idx").
+			Column("status", "next_attempt_at").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		for _, model := range []any{(*models.WebhookDelivery)(nil), (*models.WebhookSubscription)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
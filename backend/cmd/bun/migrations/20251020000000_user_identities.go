@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.UserIdentity)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		_, err := db.NewCreateTable().
+			Model((*models.OIDCLoginState)(nil)).
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		for _, model := range []any{(*models.OIDCLoginState)(nil), (*models.UserIdentity)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// The full-text index of expenses. Its rowid is the expense ID. It keeps its
+// own copy of the text, including the category name, so snippets can be
+// built without joining, and is maintained by triggers.
+var expenseSearchUp = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS expenses_fts USING fts5(
+		title, description, merchant, category,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+
+	`CREATE TRIGGER IF NOT EXISTS expenses_fts_insert AFTER INSERT ON expenses BEGIN
+		INSERT INTO expenses_fts (rowid, title, description, merchant, category)
+		VALUES (new.id, new.title, coalesce(new.description, ''), coalesce(new.merchant, ''),
+			coalesce((SELECT name FROM categories WHERE id = new.category_id), ''));
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS expenses_fts_update AFTER UPDATE OF title, description, merchant, category_id ON expenses BEGIN
+		DELETE FROM expenses_fts WHERE rowid = old.id;
+		INSERT INTO expenses_fts (rowid, title, description, merchant, category)
+		VALUES (new.id, new.title, coalesce(new.description, ''), coalesce(new.merchant, ''),
+			coalesce((SELECT name FROM categories WHERE id = new.category_id), ''));
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS expenses_fts_delete AFTER DELETE ON expenses BEGIN
+		DELETE FROM expenses_fts WHERE rowid = old.id;
+	END`,
+
+	`INSERT INTO expenses_fts (rowid, title, description, merchant, category)
+	SELECT e.id, e.title, coalesce(e.description, ''), coalesce(e.merchant, ''), coalesce(c.name, '')
+	FROM expenses AS e
+	LEFT JOIN categories AS c ON c.id = e.category_id
+	WHERE e.id NOT IN (SELECT rowid FROM expenses_fts)`,
+}
+
+// categorySearchTriggers keep the category names of the index up to date. They
+// are dropped along with the categories table. Deleted categories are also
+// handled by the update trigger, when foreign keys are enforced and the
+// expenses' category_id is set to NULL.
+var categorySearchTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS expenses_fts_category_update AFTER UPDATE OF name ON categories BEGIN
+		UPDATE expenses_fts SET category = new.name
+		WHERE rowid IN (SELECT id FROM expenses WHERE category_id = new.id);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS expenses_fts_category_delete AFTER DELETE ON categories BEGIN
+		UPDATE expenses_fts SET category = ''
+		WHERE rowid IN (SELECT id FROM expenses WHERE category_id = old.id);
+	END`,
+}
+
+var expenseSearchDown = []string{
+	`DROP TRIGGER IF EXISTS expenses_fts_category_delete`,
+	`DROP TRIGGER IF EXISTS expenses_fts_category_update`,
+	`DROP TRIGGER IF EXISTS expenses_fts_delete`,
+	`DROP TRIGGER IF EXISTS expenses_fts_update`,
+	`DROP TRIGGER IF EXISTS expenses_fts_insert`,
+	`DROP TABLE IF EXISTS expenses_fts`,
+}
+
+func init() {
+	exec := func(statements []string) func(ctx context.Context, db *bun.DB) error {
+		return func(ctx context.Context, db *bun.DB) error {
+			for _, statement := range statements {
+				if _, err := db.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	Migrations.MustRegister(exec(append(expenseSearchUp, categorySearchTriggers...)), exec(expenseSearchDown))
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.Merchant)(nil)).
+			ForeignKey("(default_category_id) REFERENCES categories (id) ON DELETE SET NULL").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := db.NewCreateTable().
+			Model((*models.MerchantAlias)(nil)).
+			ForeignKey("(merchant_id) REFERENCES merchants (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := addColumn(ctx, db, "expenses", "merchant_id", "merchant_id INTEGER"); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.Expense)(nil)).
+			Index("expenses_owner_id_merchant_id_idx").
+			Column("owner_id", "merchant_id").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropIndex().Index("expenses_owner_id_merchant_id_idx").IfExists().Exec(ctx); err != nil {
+			return err
+		}
+		if err := dropColumn(ctx, db, "expenses", "merchant_id"); err != nil {
+			return err
+		}
+
+		for _, model := range []any{(*models.MerchantAlias)(nil), (*models.Merchant)(nil)} {
+			if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
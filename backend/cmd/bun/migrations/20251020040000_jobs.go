@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.Job)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE CASCADE").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := db.NewCreateIndex().
+			Model((*models.Job)(nil)).
+			Index("jobs_status_run_at_idx").
+			Column("status", "run_at").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := db.NewCreateIndex().
+			Model((*models.Job)(nil)).
+			Index("jobs_user_id_idx").
+			Column("user_id").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		// receipts were read by their own scanner until now
+		_, err := db.NewRaw(`INSERT INTO jobs (user_id, type, payload, status, attempts, max_attempts, run_at, created_at)
+			SELECT user_id, ?, json_object('receiptId', id), ?, 0, 5, current_timestamp, current_timestamp
+			FROM receipt_scans WHERE status IN (?, ?)`,
+			models.JobTypeReceiptScan, models.JobStatusPending, models.ReceiptScanPending, models.ReceiptScanProcessing,
+		).Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		_, err := db.NewDropTable().Model((*models.Job)(nil)).IfExists().Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		_, err := addColumn(ctx, db, "users", "disabled_at", "disabled_at TIMESTAMP")
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		return dropColumn(ctx, db, "users", "disabled_at")
+	})
+}
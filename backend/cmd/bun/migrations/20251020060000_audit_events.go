@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.AuditEvent)(nil)).
+			ForeignKey("(user_id) REFERENCES users (id) ON DELETE SET NULL").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.AuditEvent)(nil)).
+			Index("audit_events_user_id_idx").
+			Column("user_id").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		_, err := db.NewDropTable().Model((*models.AuditEvent)(nil)).IfExists().Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.OrganizationInvitation)(nil)).
+			ForeignKey("(organization_id) REFERENCES organizations (id) ON DELETE CASCADE").
+			ForeignKey("(invited_by) REFERENCES users (id) ON DELETE SET NULL").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.OrganizationInvitation)(nil)).
+			Index("organization_invitations_email_idx").
+			Column("email").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		_, err := db.NewDropTable().Model((*models.OrganizationInvitation)(nil)).IfExists().Exec(ctx)
+		return err
+	})
+}
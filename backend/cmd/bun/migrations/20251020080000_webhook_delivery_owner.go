@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		added, err := addColumn(ctx, db, "webhook_deliveries", "owner_id", "owner_id INTEGER")
+		if err != nil {
+			return err
+		}
+		if added {
+			// the payloads sent before the expense response carry the model
+			if _, err := db.NewUpdate().
+				Model((*models.WebhookDelivery)(nil)).
+				Set("owner_id = coalesce(json_extract(payload, '$.data.ownerId'), json_extract(payload, '$.data.OwnerID'))").
+				Where("1 = 1").
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		_, err = db.NewCreateIndex().
+			Model((*models.WebhookDelivery)(nil)).
+			Index("webhook_deliveries_owner_id_idx").
+			Column("owner_id").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropIndex().
+			Model((*models.WebhookDelivery)(nil)).
+			Index("webhook_deliveries_owner_id_idx").
+			IfExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "webhook_deliveries", "owner_id")
+	})
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// organizationSettings are the tables shared within an organization, with the
+// column unique within it. Their rows without organization are shared by the
+// users who do not belong to one.
+var organizationSettings = []struct {
+	table       string
+	model       any
+	unique      string
+	foreignKeys []string
+}{
+	{"categories", (*models.Category)(nil), "name", nil},
+	{"merchants", (*models.Merchant)(nil), "key", []string{
+		"(default_category_id) REFERENCES categories (id) ON DELETE SET NULL",
+	}},
+	{"merchant_aliases", (*models.MerchantAlias)(nil), "key", []string{
+		"(merchant_id) REFERENCES merchants (id) ON DELETE CASCADE",
+	}},
+	{"mileage_rates", (*models.MileageRate)(nil), "vehicle", nil},
+	{"per_diem_rates", (*models.PerDiemRate)(nil), "destination", nil},
+	{"policy_rules", (*models.PolicyRule)(nil), "name", nil},
+}
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		for _, settings := range organizationSettings {
+			// the tables were created with the column unique across
+			// organizations, or from the current models on a fresh database
+			exists, err := columnExists(ctx, db, settings.table, "organization_id")
+			if err != nil {
+				return err
+			}
+			if !exists {
+				if err := rebuildTable(ctx, db, settings.table, settings.model, settings.foreignKeys...); err != nil {
+					return err
+				}
+			}
+			if _, err := db.NewCreateIndex().
+				Table(settings.table).
+				Unique().
+				Index(settings.table+"_organization_id_"+settings.unique+"_idx").
+				ColumnExpr("coalesce(organization_id, 0)").
+				Column(settings.unique).
+				IfNotExists().
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		for _, statement := range categorySearchTriggers {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		for i := len(organizationSettings) - 1; i >= 0; i-- {
+			settings := organizationSettings[i]
+			if _, err := db.NewDropIndex().
+				Index(settings.table + "_organization_id_" + settings.unique + "_idx").
+				IfExists().
+				Exec(ctx); err != nil {
+				return err
+			}
+			// the rows of organizations could clash with each other
+			if _, err := db.NewDelete().
+				Table(settings.table).
+				Where("organization_id IS NOT NULL").
+				Exec(ctx); err != nil {
+				return err
+			}
+			if err := dropColumn(ctx, db, settings.table, "organization_id"); err != nil {
+				return err
+			}
+			if _, err := db.NewCreateIndex().
+				Table(settings.table).
+				Unique().
+				Index(settings.table + "_" + settings.unique + "_idx").
+				Column(settings.unique).
+				IfNotExists().
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
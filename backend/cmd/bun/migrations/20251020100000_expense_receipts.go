@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := addColumn(ctx, db, "expenses", "receipt_id", "receipt_id INTEGER"); err != nil {
+			return err
+		}
+		_, err := db.NewCreateIndex().
+			Model((*models.Expense)(nil)).
+			Index("expenses_receipt_id_idx").
+			Column("receipt_id").
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropIndex().
+			Model((*models.Expense)(nil)).
+			Index("expenses_receipt_id_idx").
+			IfExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "expenses", "receipt_id")
+	})
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// columnExists reports whether table already has column. Tables are created
+// from the current models, so on a fresh database a column added by a later
+// migration may already be there.
+func columnExists(ctx context.Context, db *bun.DB, table, column string) (bool, error) {
+	var count int
+	err := db.NewRaw("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(ctx, &count)
+	return count > 0, err
+}
+
+// addColumn adds column to table using definition, unless it already exists.
+// It reports whether the column was added.
+func addColumn(ctx context.Context, db *bun.DB, table, column, definition string) (bool, error) {
+	exists, err := columnExists(ctx, db, table, column)
+	if err != nil || exists {
+		return false, err
+	}
+	_, err = db.NewAddColumn().Table(table).ColumnExpr(definition).Exec(ctx)
+	return err == nil, err
+}
+
+// dropColumn removes column from table.
+func dropColumn(ctx context.Context, db *bun.DB, table, column string) error {
+	_, err := db.NewDropColumn().Table(table).Column(column).Exec(ctx)
+	return err
+}
+
+// rebuildTable creates table again from model, with the given foreign keys,
+// and copies its rows over, which is how SQLite drops a constraint. The
+// foreign keys are not enforced meanwhile, so that dropping the old table
+// leaves the rows referencing it alone, and the renaming does not check the
+// triggers and views of other tables, which reference the table while it is
+// missing. Its indexes and triggers are dropped with it.
+func rebuildTable(ctx context.Context, db *bun.DB, table string, model any, foreignKeys ...string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var columns []string
+	if err := conn.NewRaw("SELECT name FROM pragma_table_info(?)", table).Scan(ctx, &columns); err != nil {
+		return err
+	}
+	idents := make([]bun.Ident, len(columns))
+	for i, column := range columns {
+		idents[i] = bun.Ident(column)
+	}
+
+	// the foreign_keys pragma has no effect within a transaction
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF; PRAGMA legacy_alter_table = ON"); err != nil {
+		return err
+	}
+	err = conn.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		rebuilt := table + "_rebuilt"
+		q := tx.NewCreateTable().Model(model).ModelTableExpr("?", bun.Ident(rebuilt))
+		for _, foreignKey := range foreignKeys {
+			q = q.ForeignKey(foreignKey)
+		}
+		if _, err := q.Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO ? (?) SELECT ? FROM ?",
+			bun.Ident(rebuilt), bun.In(idents), bun.In(idents), bun.Ident(table)); err != nil {
+			return err
+		}
+		if _, err := tx.NewDropTable().Table(table).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "ALTER TABLE ? RENAME TO ?", bun.Ident(rebuilt), bun.Ident(table))
+		return err
+	})
+	if _, pragmaErr := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON; PRAGMA legacy_alter_table = OFF"); err == nil {
+		err = pragmaErr
+	}
+	return err
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/Spiria-Digital/expense-manager/server"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// minPasswordLength is the length required by the registration endpoint.
+const minPasswordLength = 8
+
+var (
+	passwordFlag = &cli.StringFlag{
+		Name: "password",
+		Usage: "new password, prompted for when not set. Unsafe: the command line is visible to the other " +
+			"users of the machine and kept in the shell history, prefer the prompt or --password-stdin",
+		EnvVars: []string{"EXPENSE_USER_PASSWORD"},
+	}
+	passwordStdinFlag = &cli.BoolFlag{
+		Name:  "password-stdin",
+		Usage: "read the new password from the first line of the standard input, for scripts",
+	}
+)
+
+func userCommands() *cli.Command {
+	return &cli.Command{
+		Name:  "user",
+		Usage: "user accounts",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "create a user whose email address is considered verified",
+				ArgsUsage: "email",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "first-name", Required: true},
+					&cli.StringFlag{Name: "last-name", Required: true},
+					&cli.BoolFlag{Name: "admin", Usage: "make the user an administrator"},
+					passwordFlag,
+					passwordStdinFlag,
+				},
+				Action: createUser,
+			},
+			{
+				Name:      "reset-password",
+				Usage:     "set the password of a user and unlock their account",
+				ArgsUsage: "email",
+				Flags:     []cli.Flag{passwordFlag, passwordStdinFlag},
+				Action:    resetPassword,
+			},
+			{
+				Name:      "promote",
+				Usage:     "make a user an administrator",
+				ArgsUsage: "email",
+				Action:    setAdmin(true),
+			},
+			{
+				Name:      "demote",
+				Usage:     "remove the administrator rights of a user",
+				ArgsUsage: "email",
+				Action:    setAdmin(false),
+			},
+			{
+				Name:      "disable",
+				Usage:     "refuse the logins, tokens and API keys of a user",
+				ArgsUsage: "email",
+				Action:    setDisabled(true),
+			},
+			{
+				Name:      "enable",
+				Usage:     "enable a disabled user again",
+				ArgsUsage: "email",
+				Action:    setDisabled(false),
+			},
+			{
+				Name:   "list",
+				Usage:  "list the users",
+				Action: listUsers,
+			},
+			{
+				Name:      "export",
+				Usage:     "write all the data of a user to a zip archive",
+				ArgsUsage: "email [file]",
+				Action:    exportUser,
+			},
+			{
+				Name:      "erase",
+				Usage:     "delete a user and their personal data, keeping their audit events anonymized",
+				ArgsUsage: "email",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "yes", Usage: "confirm the erasure, which cannot be undone"},
+				},
+				Action: eraseUser,
+			},
+		},
+	}
+}
+
+func createUser(c *cli.Context) error {
+	email := c.Args().First()
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return fmt.Errorf("invalid email address %q", email)
+	}
+	password, err := readPassword(c)
+	if err != nil {
+		return err
+	}
+	hashedPw, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user := &models.User{
+		Email:     email,
+		Password:  hashedPw,
+		FirstName: c.String("first-name"),
+		LastName:  c.String("last-name"),
+		IsAdmin:   c.Bool("admin"),
+		// the administrator vouches for the address
+		EmailVerifiedAt: time.Now(),
+	}
+	if err := service.CreateUser(c.Context, server.BunDB, user); err != nil {
+		return err
+	}
+	if err := audit(c, user, models.AuditUserCreated); err != nil {
+		return err
+	}
+	log.Info().Int("user", user.ID).Str("email", user.Email).Bool("admin", user.IsAdmin).Msg("user created")
+	return nil
+}
+
+func resetPassword(c *cli.Context) error {
+	user, err := userArg(c)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(c)
+	if err != nil {
+		return err
+	}
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		return err
+	}
+	if err := service.UpdateUser(c.Context, server.BunDB, user, "password"); err != nil {
+		return err
+	}
+	if err := service.ResetFailedLogins(c.Context, server.BunDB, user); err != nil {
+		return err
+	}
+	if err := audit(c, user, models.AuditUserPasswordReset); err != nil {
+		return err
+	}
+	log.Info().Int("user", user.ID).Str("email", user.Email).Msg("password reset")
+	return nil
+}
+
+func setAdmin(admin bool) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		user, err := userArg(c)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			if err := keepAnAdmin(c, user); err != nil {
+				return err
+			}
+		}
+		user.IsAdmin = admin
+		if err := service.UpdateUser(c.Context, server.BunDB, user, "is_admin"); err != nil {
+			return err
+		}
+		action := models.AuditUserDemoted
+		if admin {
+			action = models.AuditUserPromoted
+		}
+		if err := audit(c, user, action); err != nil {
+			return err
+		}
+		log.Info().Int("user", user.ID).Str("email", user.Email).Bool("admin", admin).Msg("user updated")
+		return nil
+	}
+}
+
+func setDisabled(disabled bool) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		user, err := userArg(c)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			if err := keepAnAdmin(c, user); err != nil {
+				return err
+			}
+			user.DisabledAt = time.Now()
+		} else {
+			user.DisabledAt = time.Time{}
+		}
+		if err := service.UpdateUser(c.Context, server.BunDB, user, "disabled_at"); err != nil {
+			return err
+		}
+		action := models.AuditUserEnabled
+		if disabled {
+			action = models.AuditUserDisabled
+		}
+		if err := audit(c, user, action); err != nil {
+			return err
+		}
+		log.Info().Int("user", user.ID).Str("email", user.Email).Bool("disabled", disabled).Msg("user updated")
+		return nil
+	}
+}
+
+// keepAnAdmin refuses to demote or disable the last enabled administrator,
+// who is the only one able to manage the rates, merchants and policies.
+func keepAnAdmin(c *cli.Context, user *models.User) error {
+	if !user.IsAdmin || user.IsDisabled() {
+		return nil
+	}
+	admins, err := service.CountAdmins(c.Context, server.BunDB)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return errors.New("refusing to remove the last administrator, promote another user first")
+	}
+	return nil
+}
+
+func listUsers(c *cli.Context) error {
+	users, err := service.ListAccounts(c.Context, server.BunDB)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tADMIN\tVERIFIED\t2FA\tSTATUS")
+	now := time.Now()
+	for _, user := range users {
+		status := "active"
+		switch {
+		case user.IsDisabled():
+			status = "disabled"
+		case user.IsLocked(now):
+			status = "locked"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", user.ID, user.Email, user.FullName(),
+			yesNo(user.IsAdmin), yesNo(user.IsEmailVerified()), yesNo(user.TOTPEnabled), status)
+	}
+	return w.Flush()
+}
+
+func exportUser(c *cli.Context) error {
+	user, err := userArg(c)
+	if err != nil {
+		return err
+	}
+	export, err := service.ExportAccount(c.Context, server.BunDB, user)
+	if err != nil {
+		return err
+	}
+	path := c.Args().Get(1)
+	if path == "" {
+		path = fmt.Sprintf("user-%d-export-%s.zip", user.ID, export.ExportedAt.Format("2006-01-02"))
+	}
+
+	// the archive holds personal data
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := service.WriteAccountArchive(c.Context, server.BunDB, export, file); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := audit(c, user, models.AuditAccountExported); err != nil {
+		return err
+	}
+	log.Info().Int("user", user.ID).Str("path", path).Msg("user exported")
+	return nil
+}
+
+func eraseUser(c *cli.Context) error {
+	user, err := userArg(c)
+	if err != nil {
+		return err
+	}
+	if !c.Bool("yes") {
+		return fmt.Errorf("erasing %s cannot be undone, export their data first and confirm with --yes", user.Email)
+	}
+	if err := keepAnAdmin(c, user); err != nil {
+		return err
+	}
+	if err := service.EraseAccount(c.Context, server.BunDB, user.ID, models.AuditActorAdmin); err != nil {
+		return err
+	}
+	// the address is personal data, it is not logged
+	log.Info().Int("user", user.ID).Msg("user erased")
+	return nil
+}
+
+// audit records an action of the administrator on the user.
+func audit(c *cli.Context, user *models.User, action string) error {
+	return service.RecordAuditEvent(c.Context, server.BunDB, &models.AuditEvent{
+		UserID: user.ID,
+		Action: action,
+		Actor:  models.AuditActorAdmin,
+	})
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// userArg returns the user whose email address is the first argument.
+func userArg(c *cli.Context) (*models.User, error) {
+	email := c.Args().First()
+	if email == "" {
+		return nil, errors.New("missing email address")
+	}
+	return service.GetUserByEmail(c.Context, server.BunDB, email)
+}
+
+// readPassword returns the password flag, or reads the password from the
+// standard input. It is prompted for twice, without echo, when the standard
+// input is a terminal, unless --password-stdin is set.
+func readPassword(c *cli.Context) (string, error) {
+	password := c.String("password")
+	switch {
+	case c.IsSet("password"):
+	case !c.Bool("password-stdin") && isTerminal(c.App.Reader):
+		fd := int(c.App.Reader.(*os.File).Fd())
+		fmt.Fprint(c.App.ErrWriter, "Password: ")
+		typed, err := term.ReadPassword(fd)
+		fmt.Fprintln(c.App.ErrWriter)
+		if err != nil {
+			return "", fmt.Errorf("reading the password: %w", err)
+		}
+		fmt.Fprint(c.App.ErrWriter, "Confirm password: ")
+		confirmed, err := term.ReadPassword(fd)
+		fmt.Fprintln(c.App.ErrWriter)
+		if err != nil {
+			return "", fmt.Errorf("reading the password: %w", err)
+		}
+		if string(typed) != string(confirmed) {
+			return "", errors.New("the passwords do not match")
+		}
+		password = string(typed)
+	default:
+		line, err := bufio.NewReader(c.App.Reader).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading the password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("the password must be at least %d characters long", minPasswordLength)
+	}
+	return password, nil
+}
+
+// isTerminal reports whether r is a terminal.
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
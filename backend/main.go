@@ -1,13 +1,73 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/rs/zerolog/log"
 
 	"github.com/Spiria-Digital/expense-manager/server"
+	"github.com/Spiria-Digital/expense-manager/server/config"
 )
 
 func main() {
-	if err := server.Router.Run("0.0.0.0:8080"); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := config.Current.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+	}
+	lock, err := server.LockDatabase()
+	if err != nil {
+		log.Fatal().Err(err).Msg("error locking the database")
+	}
+	defer lock.Close()
+	if err := server.PrepareDatabase(ctx); err != nil {
+		log.Fatal().Err(err).Msg("error preparing the database")
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		server.WebhookDispatcher.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		server.JobQueue.Run(ctx)
+	}()
+
+	srv := &http.Server{Addr: "0.0.0.0:8080", Handler: server.Router}
+	// event streams never end on their own
+	srv.RegisterOnShutdown(server.Events.Close)
+	// ListenAndServe returns as soon as Shutdown is called, before the
+	// requests in flight are done
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Err(err).Msg("error shutting down the server")
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal().Err(err).Msg("error running app")
 	}
+	stop()
+	<-shutdown
+	workers.Wait()
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.TracerProvider.Shutdown(flushCtx); err != nil {
+		log.Err(err).Msg("error flushing the traces")
+	}
 }
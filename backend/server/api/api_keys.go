@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type createAPIKeyRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Scope string `json:"scope" binding:"required,oneof=read write"`
+	// ExpiresAt is optional, keys without expiry work until revoked.
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type createAPIKeyResponse struct {
+	APIKey *models.APIKey `json:"apiKey"`
+	// Key is sent in the X-API-Key header. It is only returned once.
+	Key string `json:"key"`
+}
+
+// CreateAPIKey
+// @Summary Create an API key
+// @Description Create a personal API key for scripts. Send it in the X-API-Key header instead of a bearer token. Read keys can only make GET requests.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body createAPIKeyRequest true "API key"
+// @Success 201 {object} createAPIKeyResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api-keys [post]
+func CreateAPIKey(ctx *gin.Context) {
+	var req createAPIKeyRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		middleware.AbortWithError(ctx, middleware.BadRequest("expiresAt must be in the future"))
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	key := &models.APIKey{UserID: currentUser.ID, Name: req.Name, Scope: req.Scope}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+
+	token, err := service.CreateAPIKey(ctx, db, key)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("api key creation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, createAPIKeyResponse{APIKey: key, Key: token})
+}
+
+// ListAPIKeys
+// @Summary List API keys
+// @Description List the API keys of the current user with their last use, revoked keys included
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.APIKey
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api-keys [get]
+func ListAPIKeys(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	keys, err := service.ListAPIKeys(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("api key listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey
+// @Summary Revoke an API key
+// @Description Revoke an API key. It stops working immediately.
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "API key ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(ctx *gin.Context) {
+	keyID, ok := paramID(ctx, "id", "invalid API key ID")
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	if err := service.RevokeAPIKey(ctx, db, keyID, currentUser.ID); err != nil {
+		log.Ctx(ctx).Err(err).Msg("api key revocation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
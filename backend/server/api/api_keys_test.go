@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "api.keys@test.com", FirstName: "Scripty", LastName: "McScript"})
+	token, err := middleware.GenerateToken(user.ID)
+	require.NoError(t, err)
+
+	// call runs handlers behind the authentication middleware, with either a
+	// bearer token or an API key.
+	call := func(headers map[string]string, method string, handlers []gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{Method: method, Payload: payload, Params: params, Header: headers},
+			append([]gin.HandlerFunc{middleware.JWTMiddleware()}, handlers...)...)
+	}
+	session := map[string]string{"Authorization": "Bearer " + token}
+	withKey := func(key string) map[string]string {
+		return map[string]string{middleware.APIKeyHeader: key}
+	}
+	managed := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return []gin.HandlerFunc{middleware.RequireSession(), handler}
+	}
+	createKey := func(payload map[string]any) createAPIKeyResponse {
+		w := call(session, "POST", managed(CreateAPIKey), payload)
+		require.Equal(t, 201, w.Code, w.Body.String())
+		var created createAPIKeyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		w := call(session, "POST", managed(CreateAPIKey), map[string]any{"name": "cron", "scope": "admin"})
+		assert.Equal(t, 400, w.Code)
+
+		w = call(session, "POST", managed(CreateAPIKey), map[string]any{"name": "cron", "scope": "read", "expiresAt": time.Now().Add(-time.Hour)})
+		assert.Equal(t, 400, w.Code)
+	})
+
+	reader := createKey(map[string]any{"name": "reporting", "scope": "read"})
+	writer := createKey(map[string]any{"name": "cron", "scope": "write", "expiresAt": time.Now().Add(time.Hour)})
+	assert.Regexp(t, `^exp_`, writer.Key)
+	assert.Equal(t, writer.Key[:12], writer.APIKey.Prefix)
+	assert.NotNil(t, writer.APIKey.ExpiresAt)
+
+	t.Run("keys are stored hashed and never listed", func(t *testing.T) {
+		var stored models.APIKey
+		require.NoError(t, db.NewSelect().Model(&stored).Where("id = ?", writer.APIKey.ID).Scan(context.Background()))
+		assert.NotContains(t, stored.KeyHash, writer.Key)
+
+		w := call(session, "GET", managed(ListAPIKeys), nil)
+		require.Equal(t, 200, w.Code)
+		assert.NotContains(t, w.Body.String(), writer.Key)
+		assert.NotContains(t, w.Body.String(), stored.KeyHash)
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		expense := map[string]any{"title": "Pushed by cron", "amount": 10, "date": "2025-05-01"}
+
+		w := call(withKey(reader.Key), "GET", []gin.HandlerFunc{ListExpenses}, nil)
+		assert.Equal(t, 200, w.Code)
+		w = call(withKey(reader.Key), "POST", []gin.HandlerFunc{CreateExpense}, expense)
+		assert.Equal(t, 403, w.Code)
+
+		w = call(withKey(writer.Key), "POST", []gin.HandlerFunc{CreateExpense}, expense)
+		require.Equal(t, 201, w.Code)
+		var created models.Expense
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, user.ID, created.OwnerID)
+	})
+
+	t.Run("keys cannot manage credentials", func(t *testing.T) {
+		w := call(withKey(writer.Key), "GET", managed(ListAPIKeys), nil)
+		assert.Equal(t, 403, w.Code)
+		w = call(withKey(writer.Key), "POST", managed(ChangePassword), map[string]any{})
+		assert.Equal(t, 403, w.Code)
+		w = call(withKey(writer.Key), "POST", managed(CreateWebhook), map[string]any{"url": "https://example.com/hook"})
+		assert.Equal(t, 403, w.Code)
+		w = call(withKey(writer.Key), "GET", managed(ListWebhooks), nil)
+		assert.Equal(t, 403, w.Code)
+		w = call(withKey(writer.Key), "POST", managed(InviteMember), map[string]any{"email": "invited@test.com", "role": "member"})
+		assert.Equal(t, 403, w.Code)
+		w = call(withKey(writer.Key), "GET", managed(GetOrganization), nil)
+		assert.Equal(t, 403, w.Code)
+	})
+
+	t.Run("last use is tracked", func(t *testing.T) {
+		keys, err := service.ListAPIKeys(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		for _, key := range keys {
+			require.NotNil(t, key.LastUsedAt, key.Name)
+			assert.WithinDuration(t, time.Now(), *key.LastUsedAt, time.Minute)
+		}
+	})
+
+	t.Run("invalid, expired and revoked keys", func(t *testing.T) {
+		w := call(withKey("exp_unknown"), "GET", []gin.HandlerFunc{ListExpenses}, nil)
+		assert.Equal(t, 401, w.Code)
+
+		_, err := db.NewUpdate().Model((*models.APIKey)(nil)).
+			Set("expires_at = ?", time.Now().Add(-time.Minute).UTC()).
+			Where("id = ?", writer.APIKey.ID).
+			Exec(context.Background())
+		require.NoError(t, err)
+		w = call(withKey(writer.Key), "GET", []gin.HandlerFunc{ListExpenses}, nil)
+		assert.Equal(t, 401, w.Code)
+
+		id := gin.Param{Key: "id", Value: strconv.Itoa(reader.APIKey.ID)}
+		w = call(session, "DELETE", managed(RevokeAPIKey), nil, id)
+		assert.Equal(t, 204, w.Code)
+		w = call(session, "DELETE", managed(RevokeAPIKey), nil, id)
+		assert.Equal(t, 404, w.Code)
+		w = call(withKey(reader.Key), "GET", []gin.HandlerFunc{ListExpenses}, nil)
+		assert.Equal(t, 401, w.Code)
+
+		w = call(session, "GET", managed(ListAPIKeys), nil)
+		var keys []models.APIKey
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+		require.Len(t, keys, 2)
+		assert.NotNil(t, keys[0].RevokedAt)
+	})
+}
@@ -1,22 +1,67 @@
 package api
 
 import (
-	"database/sql"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
 	"github.com/Spiria-Digital/expense-manager/server/middleware"
 	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
 	"github.com/Spiria-Digital/expense-manager/server/utils"
 )
 
 var InvalidEmailOrPassword = "invalid email or password"
 
+func lockoutPolicy() service.LockoutPolicy {
+	return service.LockoutPolicy{
+		Threshold:   config.Current.Security.LockoutThreshold,
+		Duration:    config.Current.Security.LockoutDuration,
+		MaxDuration: config.Current.Security.LockoutMaxDuration,
+	}
+}
+
+func invalidCredentials() error {
+	return middleware.NewHTTPError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, InvalidEmailOrPassword)
+}
+
+func accountLocked(retryAfter time.Duration) error {
+	return middleware.TooManyRequests(
+		models.ErrorCodeAccountLocked,
+		"account temporarily locked after too many failed logins",
+		retryAfter)
+}
+
+// checkCurrentPassword confirms a sensitive change with the password of the
+// signed-in user, answering the request otherwise. Wrong passwords count as
+// failed logins and locked accounts are refused, so a stolen session cannot
+// be used to guess the password.
+func checkCurrentPassword(ctx *gin.Context, db *bun.DB, user *models.User, password string) bool {
+	// check the password, even for locked accounts to keep timings identical
+	validPassword := utils.CheckPasswordHash(password, user.Password)
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		middleware.AbortWithError(ctx, accountLocked(user.LockedUntil.Sub(now)))
+		return false
+	}
+	if !validPassword {
+		if err := service.RecordFailedLogin(ctx, db, user, lockoutPolicy()); err != nil {
+			log.Ctx(ctx).Err(err).Int("user", user.ID).Msg("failed login tracking error")
+		}
+		middleware.AbortWithError(ctx, invalidCredentials())
+		return false
+	}
+	return true
+}
+
 type userRegistrationRequest struct {
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=8"`
@@ -37,25 +82,20 @@ type userRegistrationResponse struct {
 // @Param user body userRegistrationRequest true "User registration request"
 // @Success 201 {object} userRegistrationResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /auth/register [post]
 func UserRegistration(ctx *gin.Context) {
 	var user userRegistrationRequest
-	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request body",
-			Message: err.Error(),
-		})
+	if !bindJSON(ctx, &user) {
 		return
 	}
 
 	// hash the password
 	hashedPw, err := utils.HashPassword(user.Password)
 	if err != nil {
-		log.Err(err).Msg("password hashing error")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "password hashing error",
-		})
+		log.Ctx(ctx).Err(err).Msg("password hashing error")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
@@ -70,13 +110,17 @@ func UserRegistration(ctx *gin.Context) {
 		LastName:  user.LastName,
 	}
 	if err := service.CreateUser(ctx, db, entity); err != nil {
-		log.Err(err).Msg("user creation error")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "user creation error",
-		})
+		log.Ctx(ctx).Err(err).Msg("user creation error")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
+	// the account exists at this point, a failed email can be re-requested
+	m := ctx.MustGet("mailer").(mailer.Mailer)
+	if err := sendVerificationEmail(ctx, db, m, entity); err != nil {
+		log.Ctx(ctx).Err(err).Int("user", entity.ID).Msg("verification email error")
+	}
+
 	ctx.JSON(http.StatusCreated, userRegistrationResponse{Message: "User created successfully"})
 }
 
@@ -85,13 +129,17 @@ type userLoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// userLoginResponse carries either the access token or, for users with
+// two-factor authentication, the challenge token to send to /auth/login/2fa.
 type userLoginResponse struct {
-	Token string `json:"token"`
+	Token          string `json:"token,omitempty"`
+	MFARequired    bool   `json:"mfaRequired,omitempty"`
+	ChallengeToken string `json:"challengeToken,omitempty"`
 }
 
 // UserLogin
 // @Summary User login
-// @Description Login a user
+// @Description Login a user. Users with two-factor authentication receive a challenge token instead of an access token.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -99,14 +147,13 @@ type userLoginResponse struct {
 // @Success 200 {object} userLoginResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /auth/login [post]
 func UserLogin(ctx *gin.Context) {
 	var user userLoginRequest
-	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request body",
-			Message: err.Error(),
-		})
+	if !bindJSON(ctx, &user) {
 		return
 	}
 
@@ -114,37 +161,100 @@ func UserLogin(ctx *gin.Context) {
 	db := ctx.MustGet("db").(*bun.DB)
 	entity, err := service.GetUserByEmail(ctx, db, user.Email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: InvalidEmailOrPassword,
-			})
+		if errors.Is(err, service.ErrNotFound) {
+			// answer like an account, spending the same time on a wrong password
+			// and locking out the same way, so accounts cannot be probed
+			utils.CheckDummyPasswordHash(user.Password)
+			now := time.Now()
+			if until := unknownAccounts.lockedUntil(user.Email, now); !until.IsZero() {
+				telemetry.RecordLogin(telemetry.LoginLocked)
+				middleware.AbortWithError(ctx, accountLocked(until.Sub(now)))
+				return
+			}
+			unknownAccounts.fail(user.Email, lockoutPolicy(), now)
+			telemetry.RecordLogin(telemetry.LoginFailure)
+			middleware.AbortWithError(ctx, invalidCredentials())
 			return
 		}
 
-		log.Err(err).Msg("user retrieval error")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "user retrieval error",
-		})
+		log.Ctx(ctx).Err(err).Msg("user retrieval error")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
-	// check the password
-	if !utils.CheckPasswordHash(user.Password, entity.Password) {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: InvalidEmailOrPassword,
-		})
+	// check the password, even for locked accounts to keep timings identical
+	validPassword := utils.CheckPasswordHash(user.Password, entity.Password)
+
+	now := time.Now()
+	if entity.IsLocked(now) {
+		telemetry.RecordLogin(telemetry.LoginLocked)
+		middleware.AbortWithError(ctx, accountLocked(entity.LockedUntil.Sub(now)))
+		return
+	}
+
+	if !validPassword {
+		if err := service.RecordFailedLogin(ctx, db, entity, lockoutPolicy()); err != nil {
+			log.Ctx(ctx).Err(err).Int("user", entity.ID).Msg("failed login tracking error")
+		}
+		telemetry.RecordLogin(telemetry.LoginFailure)
+		middleware.AbortWithError(ctx, invalidCredentials())
 		return
 	}
 
+	if config.Current.RequireEmailVerification && !entity.IsEmailVerified() {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(
+			http.StatusForbidden, models.ErrorCodeEmailNotVerified, "email address is not verified"))
+		return
+	}
+
+	finishLogin(ctx, db, entity)
+}
+
+// finishLogin answers an authenticated user with a two-factor challenge when
+// they enabled it, or with an access token. Disabled accounts are refused.
+func finishLogin(ctx *gin.Context, db *bun.DB, entity *models.User) {
+	if entity.IsDisabled() {
+		middleware.AbortWithError(ctx, middleware.AccountDisabled())
+		return
+	}
+
+	// failed attempts are only cleared once the second factor is checked,
+	// otherwise knowing the password would allow guessing codes forever
+	if entity.TOTPEnabled {
+		challenge, err := middleware.GenerateMFAChallengeToken(entity.ID, config.Current.MFAChallengeTTL)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("challenge token generation error")
+			middleware.AbortWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, userLoginResponse{MFARequired: true, ChallengeToken: challenge})
+		return
+	}
+
+	completeLogin(ctx, db, entity)
+}
+
+// completeLogin clears the failed login counter and answers with an access
+// token.
+func completeLogin(ctx *gin.Context, db *bun.DB, entity *models.User) {
+	// the account may have been disabled since the second factor was asked
+	if entity.IsDisabled() {
+		middleware.AbortWithError(ctx, middleware.AccountDisabled())
+		return
+	}
+
+	if err := service.ResetFailedLogins(ctx, db, entity); err != nil {
+		log.Ctx(ctx).Err(err).Int("user", entity.ID).Msg("failed login reset error")
+	}
+
 	// generate the token
 	token, err := middleware.GenerateToken(entity.ID)
 	if err != nil {
-		log.Err(err).Msg("token generation error")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "token generation error",
-		})
+		log.Ctx(ctx).Err(err).Msg("token generation error")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
+	telemetry.RecordLogin(telemetry.LoginSuccess)
 	ctx.JSON(http.StatusOK, userLoginResponse{Token: token})
 }
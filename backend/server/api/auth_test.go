@@ -5,16 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"net/http/httptest"
-	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
 	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
-	"github.com/Spiria-Digital/expense-manager/server/storage"
 	"github.com/Spiria-Digital/expense-manager/server/utils"
 )
 
@@ -26,24 +28,15 @@ var (
 func TestUserLogin(t *testing.T) {
 	t.Parallel()
 
-	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
-	db, err := storage.NewBunDB(filePath)
-	require.NoError(t, err)
+	db := openTestDB(t)
 
 	hashedPassword, err := utils.HashPassword("secret123")
 	require.NoError(t, err)
-	user := &models.User{
+	newTestUser(t, db, &models.User{
 		Email:     "john.doe@test.com",
 		Password:  hashedPassword,
 		FirstName: "John",
 		LastName:  "Doe",
-	}
-
-	require.NoError(t, service.CreateUser(context.Background(), db, user))
-
-	t.Cleanup(func() {
-		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
-		require.NoError(t, db.Close())
 	})
 
 	testCases := map[string]struct {
@@ -115,16 +108,127 @@ func TestUserLogin(t *testing.T) {
 	}
 }
 
-func TestUserRegistration(t *testing.T) {
+func TestUserLoginLockout(t *testing.T) {
 	t.Parallel()
 
-	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
-	db, err := storage.NewBunDB(filePath)
+	db := openTestDB(t)
+
+	hashedPassword, err := utils.HashPassword("secret123")
 	require.NoError(t, err)
+	user := newTestUser(t, db, &models.User{
+		Email:     "brute.forced@test.com",
+		Password:  hashedPassword,
+		FirstName: "Brute",
+		LastName:  "Forced",
+	})
+
+	loginAs := func(email, password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		payload, _ := json.Marshal(map[string]interface{}{"email": email, "password": password})
+		ctx.Request = httptest.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(payload))
+		ctx.Set("db", db)
+		UserLogin(ctx)
+		return w
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		return loginAs(user.Email, password)
+	}
+
+	threshold := config.Current.Security.LockoutThreshold
+	for i := 0; i < threshold; i++ {
+		assert.Equal(t, 401, login("wrong-password").Code)
+	}
+
+	// even the right password is refused while locked
+	w := login("secret123")
+	assert.Equal(t, 429, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeAccountLocked)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
 
-	t.Cleanup(func() {
-		require.NoError(t, db.Close())
+	locked, err := service.GetUserById(context.Background(), db, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, threshold, locked.FailedLoginAttempts)
+	assert.True(t, locked.IsLocked(time.Now()))
+
+	// once the lock expires a successful login clears the counters
+	_, err = db.NewUpdate().Model(locked).
+		Set("locked_until = ?", time.Now().Add(-time.Second)).
+		WherePK().
+		Exec(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 200, login("secret123").Code)
+
+	unlocked, err := service.GetUserById(context.Background(), db, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, unlocked.FailedLoginAttempts)
+	assert.True(t, unlocked.LockedUntil.IsZero())
+
+	t.Run("unknown emails are locked out the same way", func(t *testing.T) {
+		for i := 0; i < threshold; i++ {
+			assert.Equal(t, 401, loginAs("Nobody.Here@test.com", "wrong-password").Code)
+		}
+		w := loginAs("nobody.here@test.com ", "secret123")
+		assert.Equal(t, 429, w.Code)
+		assert.Contains(t, w.Body.String(), models.ErrorCodeAccountLocked)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
 	})
+}
+
+func TestDisabledAccount(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	hashedPassword, err := utils.HashPassword("secret123")
+	require.NoError(t, err)
+	user := newTestUser(t, db, &models.User{Email: "disabled.account@test.com", Password: hashedPassword, FirstName: "Dee", LastName: "Sabled"})
+	token, err := middleware.GenerateToken(user.ID)
+	require.NoError(t, err)
+	key := &models.APIKey{UserID: user.ID, Name: "script", Scope: models.APIKeyScopeRead}
+	secret, err := service.CreateAPIKey(context.Background(), db, key)
+	require.NoError(t, err)
+
+	login := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		payload, _ := json.Marshal(map[string]interface{}{"email": user.Email, "password": "secret123"})
+		ctx.Request = httptest.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(payload))
+		ctx.Set("db", db)
+		UserLogin(ctx)
+		return w
+	}
+	authenticate := func(header, value string) int {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/api/users/me", nil)
+		ctx.Request.Header.Set(header, value)
+		ctx.Set("db", db)
+		middleware.JWTMiddleware()(ctx)
+		ctx.Writer.WriteHeaderNow()
+		return w.Code
+	}
+
+	user.DisabledAt = time.Now()
+	require.NoError(t, service.UpdateUser(context.Background(), db, user, "disabled_at"))
+	w := login()
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeAccountDisabled)
+	assert.Equal(t, 403, authenticate("Authorization", "Bearer "+token), "issued tokens are refused")
+	assert.Equal(t, 403, authenticate(middleware.APIKeyHeader, secret), "API keys are refused")
+
+	user.DisabledAt = time.Time{}
+	require.NoError(t, service.UpdateUser(context.Background(), db, user, "disabled_at"))
+	assert.Equal(t, 200, login().Code)
+	assert.Equal(t, 200, authenticate("Authorization", "Bearer "+token))
+	assert.Equal(t, 200, authenticate(middleware.APIKeyHeader, secret))
+}
+
+func TestUserRegistration(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	mail := mailer.NewFileMailer(t.TempDir(), "test@localhost")
 
 	testCases := map[string]struct {
 		payload            map[string]interface{}
@@ -142,7 +246,7 @@ func TestUserRegistration(t *testing.T) {
 				"firstName": "John",
 				"lastName":  "Doe",
 			},
-			partialResponse:    `Field validation for 'Email' failed on the 'required' tag`,
+			partialResponse:    `{"field":"email","code":"required","message":"email is required"}`,
 			expectedStatusCode: 400,
 		},
 		"missing password": {
@@ -151,7 +255,17 @@ func TestUserRegistration(t *testing.T) {
 				"firstName": "John",
 				"lastName":  "Doe",
 			},
-			partialResponse:    `Field validation for 'Password' failed on the 'required' tag`,
+			partialResponse:    `{"field":"password","code":"required","message":"password is required"}`,
+			expectedStatusCode: 400,
+		},
+		"short password": {
+			payload: map[string]interface{}{
+				"email":     "user1@company.net",
+				"password":  "secret",
+				"firstName": "John",
+				"lastName":  "Doe",
+			},
+			partialResponse:    `{"field":"password","code":"min","message":"password must be at least 8 characters long"}`,
 			expectedStatusCode: 400,
 		},
 		"missing required fields - first name": {
@@ -160,7 +274,7 @@ func TestUserRegistration(t *testing.T) {
 				"password": "secret123",
 				"lastName": "Doe",
 			},
-			partialResponse:    `Field validation for 'FirstName' failed on the 'required' tag`,
+			partialResponse:    `{"field":"firstName","code":"required","message":"firstName is required"}`,
 			expectedStatusCode: 400,
 		},
 		"missing required fields - last name": {
@@ -169,7 +283,7 @@ func TestUserRegistration(t *testing.T) {
 				"password":  "secret123",
 				"firstName": "John",
 			},
-			partialResponse:    `Field validation for 'FirstName' failed on the 'required' tag`,
+			partialResponse:    `{"field":"lastName","code":"required","message":"lastName is required"}`,
 			expectedStatusCode: 400,
 		},
 	}
@@ -184,6 +298,7 @@ func TestUserRegistration(t *testing.T) {
 			ctx.Request = httptest.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
 
 			ctx.Set("db", db)
+			ctx.Set("mailer", mail)
 
 			UserRegistration(ctx)
 
@@ -195,6 +310,8 @@ func TestUserRegistration(t *testing.T) {
 	t.Run("valid user registration", func(t *testing.T) {
 		t.Parallel()
 
+		mail := mailer.NewFileMailer(t.TempDir(), "test@localhost")
+
 		w := httptest.NewRecorder()
 		ctx, _ := gin.CreateTestContext(w)
 		email := "user1@company.io"
@@ -207,6 +324,7 @@ func TestUserRegistration(t *testing.T) {
 		ctx.Request = httptest.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
 
 		ctx.Set("db", db)
+		ctx.Set("mailer", mail)
 
 		UserRegistration(ctx)
 
@@ -216,8 +334,45 @@ func TestUserRegistration(t *testing.T) {
 		user, err := service.GetUserByEmail(context.Background(), db, email)
 		require.NoError(t, err)
 		assert.NotEqual(t, "secret123", user.Password)
+		assert.Len(t, mailTokens(t, mail.Dir), 1, "a verification email is sent")
 
 		// cleanup
 		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
 	})
+
+	t.Run("duplicate email is a conflict", func(t *testing.T) {
+		t.Parallel()
+
+		email := "user2@company.io"
+		register := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			payload, _ := json.Marshal(map[string]interface{}{
+				"email":     email,
+				"password":  "secret123",
+				"firstName": "John",
+				"lastName":  "Doe",
+			})
+			ctx.Request = httptest.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(payload))
+			ctx.Set("db", db)
+			ctx.Set("mailer", mail)
+			UserRegistration(ctx)
+			return w
+		}
+
+		require.Equal(t, 201, register().Code)
+		t.Cleanup(func() {
+			user, err := service.GetUserByEmail(context.Background(), db, email)
+			require.NoError(t, err)
+			require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+		})
+
+		w := register()
+		assert.Equal(t, 409, w.Code)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.ErrorCodeConflict, response.Code)
+		assert.Equal(t, "email is already registered", response.Error)
+	})
 }
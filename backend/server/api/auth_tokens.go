@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type tokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// emailLink builds a frontend URL carrying token in its query string.
+func emailLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", config.Current.AppBaseURL, path, url.QueryEscape(token))
+}
+
+func sendVerificationEmail(ctx context.Context, db *bun.DB, m mailer.Mailer, user *models.User) error {
+	token, err := service.IssueUserToken(ctx, db, user.ID, models.TokenPurposeEmailVerification, config.Current.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm your email address by opening the link below:\n\n%s\n\n"+
+			"If the link does not work, use this code: %s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			user.FirstName, emailLink("/verify-email", token), token, config.Current.EmailVerificationTTL),
+	})
+}
+
+func sendPasswordResetEmail(ctx context.Context, db *bun.DB, m mailer.Mailer, user *models.User) error {
+	token, err := service.IssueUserToken(ctx, db, user.ID, models.TokenPurposePasswordReset, config.Current.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Someone asked to reset the password of your account. Open the link below to choose a new one:\n\n%s\n\n"+
+			"If the link does not work, use this code: %s\n\n"+
+			"The link expires in %s. If you did not ask for a reset, you can ignore this email.\n",
+			user.FirstName, emailLink("/reset-password", token), token, config.Current.PasswordResetTTL),
+	})
+}
+
+// RequestEmailVerification
+// @Summary Request an email verification link
+// @Description Send a new verification email. The response is the same whether or not the address is registered.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body emailRequest true "Email address"
+// @Success 202 {object} messageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/verify-email/request [post]
+func RequestEmailVerification(ctx *gin.Context) {
+	var req emailRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	m := ctx.MustGet("mailer").(mailer.Mailer)
+	user, err := service.GetUserByEmail(ctx, db, req.Email)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		// do not reveal which addresses are registered
+	case err != nil:
+		log.Ctx(ctx).Err(err).Msg("user retrieval error")
+		middleware.AbortWithError(ctx, err)
+		return
+	case !user.IsEmailVerified():
+		if err := sendVerificationEmail(ctx, db, m, user); err != nil {
+			log.Ctx(ctx).Err(err).Int("user", user.ID).Msg("verification email error")
+			middleware.AbortWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusAccepted, messageResponse{
+		Message: "If the address belongs to an unverified account, a verification email has been sent",
+	})
+}
+
+// ConfirmEmailVerification
+// @Summary Confirm an email address
+// @Description Redeem the token received by email to mark the address as verified
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body tokenRequest true "Verification token"
+// @Success 200 {object} messageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/verify-email/confirm [post]
+func ConfirmEmailVerification(ctx *gin.Context) {
+	var req tokenRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.VerifyEmail(ctx, db, req.Token); err != nil {
+		log.Ctx(ctx).Err(err).Msg("email verification error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, messageResponse{Message: "Email address verified"})
+}
+
+// RequestPasswordReset
+// @Summary Request a password reset link
+// @Description Send a password reset email. The response is the same whether or not the address is registered.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body emailRequest true "Email address"
+// @Success 202 {object} messageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password-reset/request [post]
+func RequestPasswordReset(ctx *gin.Context) {
+	var req emailRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	m := ctx.MustGet("mailer").(mailer.Mailer)
+	user, err := service.GetUserByEmail(ctx, db, req.Email)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		// do not reveal which addresses are registered
+	case err != nil:
+		log.Ctx(ctx).Err(err).Msg("user retrieval error")
+		middleware.AbortWithError(ctx, err)
+		return
+	default:
+		if err := sendPasswordResetEmail(ctx, db, m, user); err != nil {
+			log.Ctx(ctx).Err(err).Int("user", user.ID).Msg("password reset email error")
+			middleware.AbortWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusAccepted, messageResponse{
+		Message: "If the address is registered, a password reset email has been sent",
+	})
+}
+
+// ConfirmPasswordReset
+// @Summary Reset a password
+// @Description Redeem the token received by email and set a new password
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body passwordResetConfirmRequest true "Reset token and new password"
+// @Success 200 {object} messageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password-reset/confirm [post]
+func ConfirmPasswordReset(ctx *gin.Context) {
+	var req passwordResetConfirmRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	hashedPw, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("password hashing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.ResetPassword(ctx, db, req.Token, hashedPw); err != nil {
+		log.Ctx(ctx).Err(err).Msg("password reset error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, messageResponse{Message: "Password updated"})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+var mailTokenPattern = regexp.MustCompile(`use this code: (\S+)`)
+
+// mailTokens returns the tokens of every email written to dir, oldest first.
+func mailTokens(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	tokens := make([]string, 0, len(names))
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		match := mailTokenPattern.FindSubmatch(content)
+		require.NotNil(t, match, "no token in %s", name)
+		tokens = append(tokens, string(match[1]))
+	}
+	return tokens
+}
+
+func postJSON(db *bun.DB, m mailer.Mailer, handler gin.HandlerFunc, payload any) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(payload)
+	ctx.Request = httptest.NewRequest("POST", "/api/auth", bytes.NewBuffer(body))
+	ctx.Set("db", db)
+	ctx.Set("mailer", m)
+	handler(ctx)
+	return w
+}
+
+// TestEmailVerification is not parallel because it toggles the global
+// RequireEmailVerification option.
+func TestEmailVerification(t *testing.T) {
+	db := openTestDB(t)
+
+	dir := t.TempDir()
+	mail := mailer.NewFileMailer(dir, "test@localhost")
+	email := "unverified@company.io"
+
+	previous := config.Current.RequireEmailVerification
+	config.Current.RequireEmailVerification = true
+
+	t.Cleanup(func() {
+		config.Current.RequireEmailVerification = previous
+		user, err := service.GetUserByEmail(context.Background(), db, email)
+		if err == nil {
+			require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+		}
+	})
+
+	w := postJSON(db, mail, UserRegistration, map[string]any{
+		"email":     email,
+		"password":  "secret123",
+		"firstName": "Ursula",
+		"lastName":  "Unverified",
+	})
+	require.Equal(t, 201, w.Code)
+
+	tokens := mailTokens(t, dir)
+	require.Len(t, tokens, 1)
+
+	login := map[string]any{"email": email, "password": "secret123"}
+	w = postJSON(db, mail, UserLogin, login)
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeEmailNotVerified)
+
+	w = postJSON(db, mail, ConfirmEmailVerification, map[string]any{"token": "not-a-token"})
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid or expired token")
+
+	w = postJSON(db, mail, ConfirmEmailVerification, map[string]any{"token": tokens[0]})
+	require.Equal(t, 200, w.Code)
+
+	w = postJSON(db, mail, ConfirmEmailVerification, map[string]any{"token": tokens[0]})
+	assert.Equal(t, 400, w.Code, "tokens are single use")
+
+	w = postJSON(db, mail, UserLogin, login)
+	assert.Equal(t, 200, w.Code)
+
+	// verified accounts do not get new verification emails
+	w = postJSON(db, mail, RequestEmailVerification, map[string]any{"email": email})
+	assert.Equal(t, 202, w.Code)
+	assert.Len(t, mailTokens(t, dir), 1)
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	hashedPassword, err := utils.HashPassword("forgotten1")
+	require.NoError(t, err)
+	user := &models.User{
+		Email:     "forgetful@company.io",
+		Password:  hashedPassword,
+		FirstName: "Fiona",
+		LastName:  "Forgetful",
+	}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+	})
+
+	dir := t.TempDir()
+	mail := mailer.NewFileMailer(dir, "test@localhost")
+
+	w := postJSON(db, mail, RequestPasswordReset, map[string]any{"email": "nobody@company.io"})
+	assert.Equal(t, 202, w.Code, "unknown addresses get the same answer")
+	assert.Empty(t, mailTokens(t, dir))
+
+	w = postJSON(db, mail, RequestPasswordReset, map[string]any{"email": user.Email})
+	require.Equal(t, 202, w.Code)
+	w = postJSON(db, mail, RequestPasswordReset, map[string]any{"email": user.Email})
+	require.Equal(t, 202, w.Code)
+
+	tokens := mailTokens(t, dir)
+	require.Len(t, tokens, 2)
+
+	w = postJSON(db, mail, ConfirmPasswordReset, map[string]any{"token": tokens[0], "password": "remembered1"})
+	assert.Equal(t, 400, w.Code, "a newer request revokes older tokens")
+
+	w = postJSON(db, mail, ConfirmPasswordReset, map[string]any{"token": tokens[1], "password": "short"})
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeValidation)
+
+	w = postJSON(db, mail, ConfirmPasswordReset, map[string]any{"token": tokens[1], "password": "remembered1"})
+	require.Equal(t, 200, w.Code)
+
+	w = postJSON(db, mail, UserLogin, map[string]any{"email": user.Email, "password": "forgotten1"})
+	assert.Equal(t, 401, w.Code)
+	w = postJSON(db, mail, UserLogin, map[string]any{"email": user.Email, "password": "remembered1"})
+	assert.Equal(t, 200, w.Code)
+
+	// the stored token is a hash, never the value sent by email
+	var stored []models.UserToken
+	require.NoError(t, db.NewSelect().Model(&stored).Where("user_id = ?", user.ID).Scan(context.Background()))
+	require.Len(t, stored, 2)
+	for _, token := range stored {
+		assert.NotContains(t, tokens, token.TokenHash)
+		assert.False(t, token.UsedAt.IsZero())
+	}
+}
@@ -7,13 +7,14 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
 	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
 )
 
 // ListCategories
-// @Summary List all categories
-// @Description List all categories
+// @Summary List categories
+// @Description List the categories of the user's organization, or those of the users without organization
 // @Tags Categories
 // @Accept json
 // @Produce json
@@ -22,13 +23,16 @@ import (
 // @Failure 500 {object} models.ErrorResponse
 // @Router /categories [get]
 func ListCategories(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
 	db := ctx.MustGet("db").(*bun.DB)
-	categories, err := service.GetCategories(ctx, db)
+	categories, err := service.GetCategories(ctx, db, orgID)
 	if err != nil {
-		log.Err(err).Msg("failed to get categories")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "failed to get categories",
-		})
+		log.Ctx(ctx).Err(err).Msg("failed to get categories")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, categories)
@@ -36,31 +40,33 @@ func ListCategories(ctx *gin.Context) {
 
 // CreateCategory
 // @Summary Create a category
-// @Description Create a category
+// @Description Create a category in the user's organization, or among those of the users without organization
 // @Tags Categories
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param category body models.Category true "Category object"
 // @Success 201 {object} models.Category
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /categories [post]
 func CreateCategory(ctx *gin.Context) {
 	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
 	var category models.Category
-	if err := ctx.ShouldBindJSON(&category); err != nil {
-		log.Err(err).Msg("failed to bind category")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "failed to bind category",
-			Message: err.Error(),
-		})
+	if !bindJSON(ctx, &category) {
+		return
+	}
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
 		return
 	}
-	err := service.CreateCategory(ctx, db, &category)
+	category.OrganizationID = orgID
+	err := service.CreateCategory(ctx, db, currentUser.ID, &category)
 	if err != nil {
-		log.Err(err).Msg("failed to create category")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "failed to create category",
-		})
+		log.Ctx(ctx).Err(err).Msg("failed to create category")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
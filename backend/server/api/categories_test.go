@@ -1,85 +1,84 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"github.com/Spiria-Digital/expense-manager/server/middleware"
-	"github.com/Spiria-Digital/expense-manager/server/models"
-	"github.com/Spiria-Digital/expense-manager/server/service"
-	"github.com/Spiria-Digital/expense-manager/server/storage"
-	"github.com/Spiria-Digital/expense-manager/server/utils"
-	"github.com/gin-gonic/gin"
+	"testing"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"net/http/httptest"
-	"path/filepath"
-	"testing"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
 )
 
 func TestCreateListCategories(t *testing.T) {
 	t.Parallel()
 
-	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
-	db, err := storage.NewBunDB(filePath)
-	require.NoError(t, err)
-
-	hashedPassword, err := utils.HashPassword("secret123")
-	require.NoError(t, err)
-	user := &models.User{
-		Email:     "category.creator@test.com",
-		Password:  hashedPassword,
-		FirstName: "John",
-		LastName:  "Doe",
-	}
-
-	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	db := openTestDB(t)
 
-	token, err := middleware.GenerateToken(user.ID)
-	require.NoError(t, err)
+	user := newTestUser(t, db, &models.User{Email: "category.creator@test.com", FirstName: "John", LastName: "Doe"})
+	teammate := newTestUser(t, db, &models.User{Email: "category.teammate@test.com", FirstName: "Tina", LastName: "Teammate"})
+	rival := newTestUser(t, db, &models.User{Email: "category.rival@test.com", FirstName: "Rick", LastName: "Rival"})
 
+	var orgIDs []int
 	t.Cleanup(func() {
-		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
-		require.NoError(t, db.Close())
+		_, err := db.NewDelete().Model((*models.Organization)(nil)).Where("id IN (?)", bun.In(orgIDs)).Exec(context.Background())
+		require.NoError(t, err)
 	})
+	for _, members := range [][]*models.User{{user, teammate}, {rival}} {
+		org := &models.Organization{Name: "Categories of " + members[0].FirstName}
+		_, err := service.CreateOrganization(context.Background(), db, org, members[0].ID)
+		require.NoError(t, err)
+		orgIDs = append(orgIDs, org.ID)
+		for _, member := range members[1:] {
+			_, err := db.NewInsert().Model(&models.OrganizationMember{OrganizationID: org.ID, UserID: member.ID, Role: models.RoleMember}).Exec(context.Background())
+			require.NoError(t, err)
+		}
+	}
 
-	t.Run("test create and list", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		ctx, _ := gin.CreateTestContext(w)
-		payload, _ := json.Marshal(map[string]string{
-			"name": "Test Groceries",
-		})
-		ctx.Request = httptest.NewRequest("POST", "/api/categories", bytes.NewBuffer(payload))
-		ctx.Request.Header.Set("Authorization", "Bearer "+token)
-
-		ctx.Set("db", db)
-
-		CreateCategory(ctx)
-
-		assert.Equal(t, 201, w.Code)
+	create := func(user *models.User, name string) (int, models.Category) {
+		w := callHandler(db, testRequest{User: user, Method: "POST", Target: "/api/categories", Payload: map[string]string{"name": name}}, CreateCategory)
 		var category models.Category
-		err = json.Unmarshal(w.Body.Bytes(), &category)
-		assert.Equal(t, category.Name, "Test Groceries")
-		assert.Greater(t, category.ID, 0)
-
-		defer func() {
-			require.NoError(t, service.DeleteCategory(context.Background(), db, &category))
-		}()
+		_ = json.Unmarshal(w.Body.Bytes(), &category)
+		if w.Code == 201 {
+			category.OrganizationID, _ = service.OrganizationOf(context.Background(), db, user.ID)
+			t.Cleanup(func() {
+				require.NoError(t, service.DeleteCategory(context.Background(), db, 0, &category))
+			})
+		}
+		return w.Code, category
+	}
+	list := func(user *models.User) []string {
+		w := callHandler(db, testRequest{User: user, Target: "/api/categories"}, ListCategories)
+		require.Equal(t, 200, w.Code)
+		var categories []models.Category
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &categories))
+		var names []string
+		for _, category := range categories {
+			names = append(names, category.Name)
+		}
+		return names
+	}
 
-		w = httptest.NewRecorder()
-		ctx, _ = gin.CreateTestContext(w)
-		ctx.Request = httptest.NewRequest("GET", "/api/categories", nil)
-		ctx.Request.Header.Set("Authorization", "Bearer "+token)
+	t.Run("test create and list", func(t *testing.T) {
+		code, category := create(user, "Test Groceries")
+		require.Equal(t, 201, code)
+		assert.Equal(t, "Test Groceries", category.Name)
+		assert.Greater(t, category.ID, 0)
 
-		ctx.Set("db", db)
+		assert.Contains(t, list(user), "Test Groceries")
+		assert.Contains(t, list(teammate), "Test Groceries", "categories are shared within the organization")
 
-		ListCategories(ctx)
+		code, _ = create(teammate, "Test Groceries")
+		assert.Equal(t, 409, code)
+	})
 
-		assert.Equal(t, 200, w.Code)
-		var response []models.Category
-		err = json.Unmarshal(w.Body.Bytes(), &response)
+	t.Run("organizations do not see each other's categories", func(t *testing.T) {
+		assert.NotContains(t, list(rival), "Test Groceries")
 
-		assert.NoError(t, err)
-		assert.GreaterOrEqual(t, len(response), 1)
+		code, _ := create(rival, "Test Groceries")
+		assert.Equal(t, 201, code, "names are only unique within an organization")
 	})
 }
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/events"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// resetEvent tells the client that the events it missed are lost and that it
+// should reload its data.
+const resetEvent = "reset"
+
+// StreamEvents
+// @Summary Stream live updates
+// @Description Server-sent events stream of the changes to the user's expenses (expense.created, expense.updated, expense.deleted) and to the categories of the user's organization (category.created, category.updated, category.deleted). The data of each event is the changed object as JSON. Clients reconnecting with the Last-Event-ID header receive the events they missed, or a reset event first when they are no longer available and the data should be reloaded.
+// @Tags events
+// @Produce text/event-stream
+// @Param Authorization header string true "Bearer token"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} models.ErrorResponse
+// @Router /events [get]
+func StreamEvents(ctx *gin.Context) {
+	currentUser := ctx.MustGet("user").(*models.User)
+	sub, missed, ok := service.Events.Subscribe(currentUser.ID, ctx.GetHeader("Last-Event-ID"))
+	defer service.Events.Unsubscribe(sub)
+
+	sse.Event{}.WriteContentType(ctx.Writer)
+	// disables response buffering in nginx
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	if !ok {
+		ctx.Render(-1, sse.Event{Event: resetEvent, Data: []byte("{}")})
+	}
+	for i := range missed {
+		renderEvent(ctx, &missed[i])
+	}
+	ctx.Writer.Flush()
+
+	keepAlive := time.NewTicker(config.Current.Events.KeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, open := <-sub.C:
+			if !open {
+				// the client reconnects and catches up with Last-Event-ID
+				return
+			}
+			renderEvent(ctx, &event)
+		case <-keepAlive.C:
+			_, _ = io.WriteString(ctx.Writer, ": keep-alive\n\n")
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func renderEvent(ctx *gin.Context, event *events.Event) {
+	ctx.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(event.ID, 10),
+		Event: event.Type,
+		Data:  []byte(event.Data),
+	})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/events"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type streamedEvent struct {
+	id, event, data string
+}
+
+func TestStreamEvents(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "events.owner@test.com", FirstName: "Eve", LastName: "Events"})
+	other := newTestUser(t, db, &models.User{Email: "events.other@test.com", FirstName: "Olga", LastName: "Other"})
+	category := &models.Category{Name: "Streamed Category"}
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, category))
+	})
+
+	router := gin.New()
+	router.GET("/api/events", func(ctx *gin.Context) {
+		ctx.Set("user", user)
+	}, StreamEvents)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	connect := func(lastEventID string) (*bufio.Reader, func()) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events", nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Content-Type"), "text/event-stream")
+		assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+		return bufio.NewReader(res.Body), func() {
+			cancel()
+			res.Body.Close()
+		}
+	}
+	// next returns the next event of this test, skipping the categories
+	// created by the other tests
+	next := func(stream *bufio.Reader) streamedEvent {
+		for {
+			var event streamedEvent
+			for {
+				line, err := stream.ReadString('\n')
+				require.NoError(t, err)
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" {
+					break
+				}
+				field, value, _ := strings.Cut(line, ":")
+				switch field {
+				case "id":
+					event.id = value
+				case "event":
+					event.event = value
+				case "data":
+					event.data = value
+				}
+			}
+			if !strings.HasPrefix(event.event, "category.") || strings.Contains(event.data, category.Name) {
+				return event
+			}
+		}
+	}
+
+	stream, disconnect := connect("")
+	require.NoError(t, service.CreateExpense(context.Background(), db, &models.Expense{
+		OwnerID: other.ID, Title: "Not streamed", Date: time.Now(), Amount: 5,
+	}))
+	expense := &models.Expense{OwnerID: user.ID, Title: "Streamed taxi", Date: time.Now(), Amount: 12}
+	require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+	require.NoError(t, service.CreateCategory(context.Background(), db, user.ID, category))
+
+	created := next(stream)
+	assert.Equal(t, "expense.created", created.event)
+	var data models.ExpenseResponse
+	require.NoError(t, json.Unmarshal([]byte(created.data), &data))
+	assert.Equal(t, expense.ID, data.ID)
+	assert.Equal(t, user.ID, data.OwnerID)
+	assert.Equal(t, "Streamed taxi", data.Title)
+	assert.Equal(t, "category.created", next(stream).event)
+	disconnect()
+
+	t.Run("resumes with Last-Event-ID", func(t *testing.T) {
+		expense.Amount = 15
+		require.NoError(t, service.UpdateExpense(context.Background(), db, expense))
+		require.NoError(t, service.DeleteExpense(context.Background(), db, expense.ID, user.ID))
+
+		stream, disconnect := connect(created.id)
+		defer disconnect()
+		assert.Equal(t, "category.created", next(stream).event)
+		assert.Equal(t, "expense.updated", next(stream).event)
+		assert.Equal(t, "expense.deleted", next(stream).event)
+	})
+
+	t.Run("asks to reload when events are lost", func(t *testing.T) {
+		stream, disconnect := connect("1")
+		defer disconnect()
+		assert.Equal(t, "reset", next(stream).event)
+	})
+}
+
+func TestCategoryEventsStayInOrganization(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	alice := newTestUser(t, db, &models.User{Email: "events.alice@test.com", FirstName: "Alice", LastName: "Events"})
+	bob := newTestUser(t, db, &models.User{Email: "events.bob@test.com", FirstName: "Bob", LastName: "Events"})
+	var orgIDs []int
+	for _, user := range []*models.User{alice, bob} {
+		member, err := service.CreateOrganization(context.Background(), db, &models.Organization{Name: user.FirstName + " Events"}, user.ID)
+		require.NoError(t, err)
+		orgIDs = append(orgIDs, member.OrganizationID)
+	}
+	t.Cleanup(func() {
+		_, err := db.NewDelete().Model((*models.Organization)(nil)).Where("id IN (?)", bun.In(orgIDs)).Exec(context.Background())
+		require.NoError(t, err)
+	})
+
+	subscribe := func(user *models.User) *events.Subscription {
+		sub, _, _ := service.Events.Subscribe(user.ID, "")
+		t.Cleanup(func() { service.Events.Unsubscribe(sub) })
+		return sub
+	}
+	// next returns the next category event of this test, skipping the
+	// events of the other tests
+	next := func(sub *events.Subscription) events.Event {
+		for {
+			select {
+			case event := <-sub.C:
+				if strings.HasPrefix(event.Type, "category.") && strings.Contains(string(event.Data), "Private Category") {
+					return event
+				}
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "no category event")
+			}
+		}
+	}
+	aliceEvents, bobEvents := subscribe(alice), subscribe(bob)
+
+	secret := &models.Category{OrganizationID: orgIDs[0], Name: "Alice Private Category"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, alice.ID, secret))
+	own := &models.Category{OrganizationID: orgIDs[1], Name: "Bob Private Category"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, bob.ID, own))
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, secret))
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, own))
+	})
+
+	assert.Contains(t, string(next(aliceEvents).Data), secret.Name)
+	// the category of the other organization is never sent to Bob
+	assert.Contains(t, string(next(bobEvents).Data), own.Name)
+}
@@ -1,20 +1,22 @@
 package api
 
 import (
-	"database/sql"
-	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
 	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
 )
 
+// createExpenseRequest describes an expense. For mileage and per-diem
+// expenses the amount is computed from the rate tables and Amount is ignored.
 type createExpenseRequest struct {
 	Amount      float64 `json:"amount"`
 	Title       string  `json:"title" binding:"required"`
@@ -22,54 +24,146 @@ type createExpenseRequest struct {
 	Merchant    string  `json:"merchant"`
 	Date        string  `json:"date"`
 	CategoryId  int     `json:"categoryId"`
+	ReceiptID   int     `json:"receiptId"`
+
+	Type string `json:"type" binding:"omitempty,oneof=receipt mileage per_diem" enums:"receipt,mileage,per_diem"`
+
+	DistanceKm float64 `json:"distanceKm" binding:"required_if=Type mileage,gte=0"`
+	Vehicle    string  `json:"vehicle" binding:"required_if=Type mileage,max=32"`
+
+	Destination   string `json:"destination" binding:"required_if=Type per_diem,max=255"`
+	Days          int    `json:"days" binding:"required_if=Type per_diem,gte=0"`
+	MealsProvided int    `json:"mealsProvided" binding:"gte=0"`
+}
+
+// apply copies the request onto expense.
+func (r *createExpenseRequest) apply(expense *models.Expense, date time.Time) {
+	expense.Amount = models.Amount(r.Amount)
+	expense.Title = r.Title
+	expense.Description = r.Description
+	expense.Merchant = r.Merchant
+	expense.ReceiptID = r.ReceiptID
+	expense.Date = date
+	expense.Type = r.Type
+	expense.DistanceKm = r.DistanceKm
+	expense.Vehicle = r.Vehicle
+	expense.Destination = r.Destination
+	expense.Days = r.Days
+	expense.MealsProvided = r.MealsProvided
+}
+
+func expenseResponses(expenses []models.Expense) []models.ExpenseResponse {
+	responses := make([]models.ExpenseResponse, len(expenses))
+	for i := range expenses {
+		responses[i] = expenses[i].Response()
+	}
+	return responses
+}
+
+// bindExpenseRelations reads the include query parameter, or its alias
+// expand: a comma-separated list of the relations to embed in the expenses,
+// category and owner. It writes a 400 response and returns false for unknown
+// relations.
+func bindExpenseRelations(ctx *gin.Context) (service.ExpenseRelations, bool) {
+	var include service.ExpenseRelations
+	value := ctx.Query("include")
+	if value == "" {
+		value = ctx.Query("expand")
+	}
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "category":
+			include.Category = true
+		case "owner":
+			include.Owner = true
+		default:
+			middleware.AbortWithError(ctx, middleware.BadRequest(fmt.Sprintf("cannot include %q, expected category or owner", name)))
+			return include, false
+		}
+	}
+	return include, true
+}
+
+type searchExpensesQuery struct {
+	Query  string `form:"q" binding:"required,max=200"`
+	From   string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To     string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// expenseMatch is an expense found by a search.
+type expenseMatch struct {
+	Expense models.ExpenseResponse `json:"expense"`
+	// Snippet is an excerpt of the best matching field with the matches
+	// wrapped in <mark> tags. The rest of the text is HTML-escaped.
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+type suggestCategoryQuery struct {
+	Title    string `form:"title" binding:"max=255"`
+	Merchant string `form:"merchant" binding:"max=255"`
+}
+
+// parseExpenseDate parses a YYYY-MM-DD date, writing a 400 response and
+// returning false when it is malformed.
+func parseExpenseDate(ctx *gin.Context, value string) (time.Time, bool) {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		middleware.AbortWithError(ctx, &middleware.HTTPError{
+			Status:  http.StatusBadRequest,
+			Code:    models.ErrorCodeValidation,
+			Message: "invalid request body",
+			Details: []models.FieldError{{
+				Field:   "date",
+				Code:    "date",
+				Message: "date must use the YYYY-MM-DD format",
+			}},
+			Err: err,
+		})
+		return time.Time{}, false
+	}
+	return date, true
 }
 
 // CreateExpense creates a new expense
 // @Summary Create a new expense
-// @Description Create a new expense
+// @Description Create a new expense. The amount of mileage and per-diem expenses is computed from the rate tables. The merchant is replaced by the name of the known merchant it matches, and expenses without a category get the suggested one, as reported by categorySource.
 // @Accept  json
 // @Produce  json
 // @Tags expenses
 // @Param Authorization header string true "Bearer token"
 // @Param expense body createExpenseRequest true "Expense object"
-// @Success 201 {object} models.Expense
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 201 {object} models.ExpenseResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /expenses [post]
 func CreateExpense(ctx *gin.Context) {
 	var req createExpenseRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		log.Err(err).Msg("Error binding JSON")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &req) {
 		return
 	}
 
-	expenseDate, err := time.Parse("2006-01-02", req.Date)
-	if err != nil {
-		log.Err(err).Msg("Error parsing date")
-		ctx.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{"message": err.Error(), "error": "Invalid date format, expected YYYY-MM-DD"})
+	expenseDate, ok := parseExpenseDate(ctx, req.Date)
+	if !ok {
 		return
 	}
 
 	currentUser := ctx.MustGet("user").(*models.User)
 	entity := models.Expense{
-		Amount:      req.Amount,
-		Title:       req.Title,
-		Description: req.Description,
-		Merchant:    req.Merchant,
-		Date:        expenseDate,
-		CategoryID:  req.CategoryId,
-		OwnerID:     currentUser.ID,
+		CategoryID: req.CategoryId,
+		OwnerID:    currentUser.ID,
 	}
+	req.apply(&entity, expenseDate)
 	db := ctx.MustGet("db").(*bun.DB)
 	if err := service.CreateExpense(ctx, db, &entity); err != nil {
-		log.Err(err).Msg("Error creating expense")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error creating expense"})
+		log.Ctx(ctx).Err(err).Msg("Error creating expense")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
-	ctx.JSON(201, entity)
+	ctx.JSON(201, entity.Response())
 }
 
 // ListExpenses returns a list of expenses
@@ -79,20 +173,26 @@ func CreateExpense(ctx *gin.Context) {
 // @Produce  json
 // @Tags expenses
 // @Param Authorization header string true "Bearer token"
-// @Success 200 {array} models.Expense
-// @Failure 500 {object} map[string]string
+// @Param include query string false "Relations to embed, comma-separated: category, owner. Also accepted as expand."
+// @Success 200 {array} models.ExpenseResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /expenses [get]
 func ListExpenses(ctx *gin.Context) {
+	include, ok := bindExpenseRelations(ctx)
+	if !ok {
+		return
+	}
 	db := ctx.MustGet("db").(*bun.DB)
 	currentUser := ctx.MustGet("user").(*models.User)
 	// TODO check if there is a category filter in the query string and use it to call ListExpensesByCategory
-	expenses, err := service.ListExpenses(ctx, db, currentUser.ID)
+	expenses, err := service.ListExpenses(ctx, db, currentUser.ID, include)
 	if err != nil {
-		log.Err(err).Msg("Error getting expenses")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error getting expenses"})
+		log.Ctx(ctx).Err(err).Msg("Error getting expenses")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
-	ctx.JSON(200, expenses)
+	ctx.JSON(200, expenseResponses(expenses))
 }
 
 // GetExpense returns a single expense
@@ -103,31 +203,31 @@ func ListExpenses(ctx *gin.Context) {
 // @Tags expenses
 // @Param Authorization header string true "Bearer token"
 // @Param id path int true "Expense ID"
-// @Success 200 {object} models.Expense
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Param include query string false "Relations to embed, comma-separated: category, owner. Also accepted as expand."
+// @Success 200 {object} models.ExpenseResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /expenses/{id} [get]
 func GetExpense(ctx *gin.Context) {
-	expenseID, err := strconv.Atoi(ctx.Param("id"))
-	if err != nil {
-		log.Err(err).Msg("Error parsing expense ID")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+	expenseID, ok := paramID(ctx, "id", "invalid expense ID")
+	if !ok {
+		return
+	}
+	include, ok := bindExpenseRelations(ctx)
+	if !ok {
 		return
 	}
 	db := ctx.MustGet("db").(*bun.DB)
 	currentUser := ctx.MustGet("user").(*models.User)
 
-	expense, err := service.GetExpense(ctx, db, expenseID, currentUser.ID)
+	expense, err := service.GetExpense(ctx, db, expenseID, currentUser.ID, include)
 	if err != nil {
-		log.Err(err).Msg("Error getting expense")
-		if errors.Is(err, sql.ErrNoRows) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error getting expense"})
+		log.Ctx(ctx).Err(err).Msg("Error getting expense")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
-	ctx.JSON(200, expense)
+	ctx.JSON(200, expense.Response())
 }
 
 // UpdateExpense updates an existing expense
@@ -139,59 +239,44 @@ func GetExpense(ctx *gin.Context) {
 // @Param Authorization header string true "Bearer token"
 // @Param id path int true "Expense ID"
 // @Param expense body createExpenseRequest true "Expense object"
-// @Success 200 {object} models.Expense
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 200 {object} models.ExpenseResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /expenses/{id} [put]
 func UpdateExpense(ctx *gin.Context) {
 	var req createExpenseRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		log.Err(err).Msg("Error binding JSON")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &req) {
 		return
 	}
 
-	expenseDate, err := time.Parse("2006-01-02", req.Date)
-	if err != nil {
-		log.Err(err).Msg("Error parsing date")
-		ctx.AbortWithStatusJSON(
-			http.StatusBadRequest,
-			gin.H{"message": err.Error(), "error": "Invalid date format, expected YYYY-MM-DD"})
+	expenseDate, ok := parseExpenseDate(ctx, req.Date)
+	if !ok {
 		return
 	}
 
-	expenseID, err := strconv.Atoi(ctx.Param("id"))
-	if err != nil {
-		log.Err(err).Msg("Error parsing expense ID")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+	expenseID, ok := paramID(ctx, "id", "invalid expense ID")
+	if !ok {
 		return
 	}
 	db := ctx.MustGet("db").(*bun.DB)
 	currentUser := ctx.MustGet("user").(*models.User)
 
-	expense, err := service.GetExpense(ctx, db, expenseID, currentUser.ID)
+	expense, err := service.GetExpense(ctx, db, expenseID, currentUser.ID, service.ExpenseRelations{})
 	if err != nil {
-		log.Err(err).Msg("Error getting expense")
-		if errors.Is(err, sql.ErrNoRows) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error getting expense"})
+		log.Ctx(ctx).Err(err).Msg("Error getting expense")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
-	expense.Title = req.Title
-	expense.Amount = req.Amount
-	expense.Description = req.Description
-	expense.Merchant = req.Merchant
-	expense.Date = expenseDate
+	req.apply(expense, expenseDate)
 
 	if err := service.UpdateExpense(ctx, db, expense); err != nil {
-		log.Err(err).Msg("Error updating expense")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error updating expense"})
+		log.Ctx(ctx).Err(err).Msg("Error updating expense")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
-	ctx.JSON(200, expense)
+	ctx.JSON(200, expense.Response())
 }
 
 // DeleteExpense deletes an existing expense
@@ -203,27 +288,122 @@ func UpdateExpense(ctx *gin.Context) {
 // @Param Authorization header string true "Bearer token"
 // @Param id path int true "Expense ID"
 // @Success 204
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /expenses/{id} [delete]
 func DeleteExpense(ctx *gin.Context) {
-	expenseID, err := strconv.Atoi(ctx.Param("id"))
-	if err != nil {
-		log.Err(err).Msg("Error parsing expense ID")
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+	expenseID, ok := paramID(ctx, "id", "invalid expense ID")
+	if !ok {
 		return
 	}
 	db := ctx.MustGet("db").(*bun.DB)
 	currentUser := ctx.MustGet("user").(*models.User)
 
 	if err := service.DeleteExpense(ctx, db, expenseID, currentUser.ID); err != nil {
-		log.Err(err).Msg("Error deleting expense")
-		if errors.Is(err, sql.ErrNoRows) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error deleting expense"})
+		log.Ctx(ctx).Err(err).Msg("Error deleting expense")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 	ctx.Status(204)
 }
+
+// SearchExpenses
+// @Summary Search expenses
+// @Description Full-text search of the current user's expenses by title, description, merchant and category name. Every word must match the start of a word, ignoring case and accents; results are ranked by relevance, title matches first.
+// @Tags expenses
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param q query string true "Words to search for"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param limit query int false "Number of results, 20 by default, at most 100"
+// @Param offset query int false "Number of results to skip"
+// @Param include query string false "Relations to embed, comma-separated: category, owner. Also accepted as expand."
+// @Success 200 {array} expenseMatch
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /expenses/search [get]
+func SearchExpenses(ctx *gin.Context) {
+	var query searchExpensesQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return
+	}
+	include, ok := bindExpenseRelations(ctx)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("user").(*models.User)
+	search := service.ExpenseSearch{
+		OwnerID: currentUser.ID,
+		Query:   query.Query,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		Include: include,
+	}
+	if search.Limit == 0 {
+		search.Limit = 20
+	}
+	// the dates were validated by the binding
+	if query.From != "" {
+		search.From, _ = time.Parse("2006-01-02", query.From)
+	}
+	if query.To != "" {
+		search.To, _ = time.Parse("2006-01-02", query.To)
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	matches, err := service.SearchExpenses(ctx, db, search)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Error searching expenses")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	results := make([]expenseMatch, len(matches))
+	for i, match := range matches {
+		results[i] = expenseMatch{Expense: match.Expense.Response(), Snippet: match.Snippet, Rank: match.Rank}
+	}
+	ctx.JSON(http.StatusOK, results)
+}
+
+// SuggestExpenseCategory
+// @Summary Suggest a category
+// @Description Match a merchant name with the known merchants and suggest a category for a new expense: the category the user most often chose for the merchant, else the merchant's default category, else the category the user most often chose for similar titles. Expenses created without a category get the suggested one.
+// @Tags expenses
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param title query string false "Title of the expense"
+// @Param merchant query string false "Merchant as typed or printed on the receipt"
+// @Success 200 {object} service.CategorySuggestion
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /expenses/suggestion [get]
+func SuggestExpenseCategory(ctx *gin.Context) {
+	var query suggestCategoryQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	merchant, err := service.ResolveMerchant(ctx, db, orgID, query.Merchant)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Error matching merchant")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	suggestion, err := service.SuggestCategory(ctx, db, currentUser.ID, orgID, merchant, query.Title)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Error suggesting category")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, suggestion)
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestExpenseIncludes(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "include.owner@test.com", Password: "secret-hash", FirstName: "Ines", LastName: "Include"})
+	books := &models.Category{Name: "Include Books"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, books))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, books))
+	})
+
+	call := func(method, target string, handler gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: target, Payload: payload, Params: params}, handler)
+	}
+
+	w := call("POST", "/api/expenses", CreateExpense, map[string]any{
+		"title": "Go book", "amount": 42.5, "date": "2025-04-01", "categoryId": books.ID,
+	})
+	require.Equal(t, 201, w.Code, w.Body.String())
+	var created map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.EqualValues(t, user.ID, created["ownerId"])
+	assert.NotContains(t, created, "OwnerID")
+	assert.NotContains(t, created, "category")
+	idParam := gin.Param{Key: "id", Value: strconv.Itoa(int(created["id"].(float64)))}
+
+	t.Run("list without include", func(t *testing.T) {
+		w := call("GET", "/api/expenses", ListExpenses, nil)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var expenses []map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expenses))
+		require.Len(t, expenses, 1)
+		assert.EqualValues(t, books.ID, expenses[0]["categoryId"])
+		assert.NotContains(t, expenses[0], "category")
+		assert.NotContains(t, expenses[0], "owner")
+	})
+
+	t.Run("list with include", func(t *testing.T) {
+		w := call("GET", "/api/expenses?include=category,owner", ListExpenses, nil)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var expenses []models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expenses))
+		require.Len(t, expenses, 1)
+		require.NotNil(t, expenses[0].Category)
+		assert.Equal(t, "Include Books", expenses[0].Category.Name)
+		require.NotNil(t, expenses[0].Owner)
+		assert.Equal(t, models.UserSummary{ID: user.ID, Email: user.Email, FirstName: "Ines", LastName: "Include"}, *expenses[0].Owner)
+		assert.NotContains(t, w.Body.String(), "secret-hash")
+	})
+
+	t.Run("get with expand", func(t *testing.T) {
+		w := call("GET", "/api/expenses/x?expand=owner", GetExpense, nil, idParam)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var expense models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+		assert.Nil(t, expense.Category)
+		require.NotNil(t, expense.Owner)
+		assert.Equal(t, user.ID, expense.Owner.ID)
+		assert.Equal(t, 42.5, expense.Amount)
+	})
+
+	t.Run("unknown relation", func(t *testing.T) {
+		w := call("GET", "/api/expenses?include=password", ListExpenses, nil)
+		assert.Equal(t, 400, w.Code)
+	})
+}
+
+func TestSearchExpenses(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "search.traveller@test.com", FirstName: "Sara", LastName: "Search"})
+	other := newTestUser(t, db, &models.User{Email: "search.other@test.com", FirstName: "Oleg", LastName: "Other"})
+	lodging := &models.Category{Name: "Search Lodging"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, lodging))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, lodging))
+	})
+
+	create := func(owner *models.User, title, description, merchant string, categoryID int) *models.Expense {
+		expense := &models.Expense{
+			OwnerID: owner.ID, CategoryID: categoryID, Title: title, Description: description, Merchant: merchant,
+			Date: time.Date(2025, time.April, 12, 0, 0, 0, 0, time.UTC), Amount: 100,
+		}
+		require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+		return expense
+	}
+	hotel := create(user, "Hotel in Lisbon", "Three nights near the Praça do Comércio", "Hôtel Avenida", lodging.ID)
+	dinner := create(user, "Team dinner", "After the Lisbon hotel check-in", "Taberna", 0)
+	create(user, "Taxi", "Airport to office", "", 0)
+	spa := create(user, `Spa <img src=x onerror="alert(1)"> & sauna`, "", "", 0)
+	create(other, "Hotel in Lisbon", "not mine", "", 0)
+
+	search := func(query string) (int, []expenseMatch) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/api/expenses/search?"+query, nil)
+		ctx.Set("db", db)
+		ctx.Set("user", user)
+		SearchExpenses(ctx)
+		ctx.Writer.WriteHeaderNow()
+
+		var matches []expenseMatch
+		if w.Code == 200 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &matches))
+		}
+		return w.Code, matches
+	}
+	ids := func(matches []expenseMatch) []int {
+		var ids []int
+		for _, match := range matches {
+			ids = append(ids, match.Expense.ID)
+		}
+		return ids
+	}
+
+	t.Run("ranks title matches first", func(t *testing.T) {
+		code, matches := search("q=lisb+hot")
+		require.Equal(t, 200, code)
+		assert.Equal(t, []int{hotel.ID, dinner.ID}, ids(matches))
+		assert.Contains(t, matches[0].Snippet, "<mark>Hotel</mark>")
+		assert.Less(t, matches[0].Rank, matches[1].Rank)
+	})
+
+	t.Run("escapes snippets", func(t *testing.T) {
+		_, matches := search("q=sauna")
+		require.Equal(t, []int{spa.ID}, ids(matches))
+		assert.Equal(t, "Spa &lt;img src=x onerror=&#34;alert(1)&#34;&gt; &amp; <mark>sauna</mark>", matches[0].Snippet)
+	})
+
+	t.Run("ignores accents and matches categories", func(t *testing.T) {
+		_, matches := search("q=hotel+avenida")
+		assert.Equal(t, []int{hotel.ID}, ids(matches))
+		_, matches = search("q=comercio")
+		assert.Equal(t, []int{hotel.ID}, ids(matches))
+		_, matches = search("q=lodging&include=category")
+		require.Equal(t, []int{hotel.ID}, ids(matches))
+		assert.Equal(t, "Search Lodging", matches[0].Expense.Category.Name)
+	})
+
+	t.Run("treats operators as words", func(t *testing.T) {
+		code, matches := search(`q=` + url.QueryEscape(`taxi OR "hotel`))
+		require.Equal(t, 200, code)
+		assert.Empty(t, matches, "OR is searched for, not interpreted")
+		code, _ = search("q=" + url.QueryEscape(`*"()`))
+		assert.Equal(t, 400, code)
+		code, _ = search("")
+		assert.Equal(t, 400, code)
+	})
+
+	t.Run("follows changes", func(t *testing.T) {
+		dinner.Title = "Team lunch"
+		dinner.Description = ""
+		require.NoError(t, service.UpdateExpense(context.Background(), db, dinner))
+		_, matches := search("q=lisbon")
+		assert.Equal(t, []int{hotel.ID}, ids(matches))
+		_, matches = search("q=lunch")
+		assert.Equal(t, []int{dinner.ID}, ids(matches))
+
+		lodging.Name = "Search Accommodation"
+		require.NoError(t, service.UpdateCategory(context.Background(), db, 0, lodging))
+		_, matches = search("q=accommodation")
+		assert.Equal(t, []int{hotel.ID}, ids(matches))
+
+		require.NoError(t, service.DeleteExpense(context.Background(), db, dinner.ID, user.ID))
+		_, matches = search("q=lunch")
+		assert.Empty(t, matches)
+	})
+
+	t.Run("filters by date", func(t *testing.T) {
+		_, matches := search("q=hotel&to=2025-04-11")
+		assert.Empty(t, matches)
+		_, matches = search("q=hotel&from=2025-04-12&to=2025-04-12")
+		assert.Equal(t, []int{hotel.ID}, ids(matches))
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/gql"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// GraphQL
+// @Summary Run a GraphQL query
+// @Description Query expenses, categories, users and spending summaries in one round trip. The schema is read-only; queries deeper than 8 levels or selecting too many fields are rejected. GET requests take the query, operationName and JSON-encoded variables as query parameters, which lets read-only API keys use the endpoint. Query errors are reported in the errors field of a 200 response.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body gql.Request true "GraphQL request"
+// @Success 200 {object} object
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /graphql [post]
+func GraphQL(ctx *gin.Context) {
+	var req gql.Request
+	if ctx.Request.Method == http.MethodGet {
+		req.Query = ctx.Query("query")
+		req.OperationName = ctx.Query("operationName")
+		if req.Query == "" {
+			middleware.AbortWithError(ctx, middleware.BadRequest("query is required"))
+			return
+		}
+		if variables := ctx.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				middleware.AbortWithError(ctx, middleware.BadRequest("variables must be a JSON object"))
+				return
+			}
+		}
+	} else if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	result, err := gql.Execute(ctx, db, currentUser, req)
+	if errors.Is(err, gql.ErrTooComplex) {
+		middleware.AbortWithError(ctx, middleware.BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to execute graphql query")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
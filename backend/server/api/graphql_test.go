@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// queryCounter counts the SELECT queries reading a table.
+type queryCounter struct {
+	categories, users atomic.Int32
+}
+
+func (c *queryCounter) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (c *queryCounter) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	switch {
+	case strings.Contains(event.Query, `FROM "categories"`):
+		c.categories.Add(1)
+	case strings.Contains(event.Query, `FROM "users"`):
+		c.users.Add(1)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	counter := &queryCounter{}
+	db.AddQueryHook(counter)
+
+	user := newTestUser(t, db, &models.User{Email: "graphql.user@test.com", FirstName: "Grace", LastName: "Query"})
+	other := newTestUser(t, db, &models.User{Email: "graphql.other@test.com", FirstName: "Otto", LastName: "Other"})
+	food := &models.Category{Name: "GraphQL Food"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, food))
+	travel := &models.Category{Name: "GraphQL Travel"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, travel))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, food))
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, travel))
+	})
+
+	spend := func(owner *models.User, category *models.Category, amount float64, day int) {
+		expense := &models.Expense{
+			OwnerID:    owner.ID,
+			CategoryID: category.ID,
+			Title:      "graphql expense",
+			Date:       time.Date(2025, time.March, day, 0, 0, 0, 0, time.UTC),
+			Amount:     models.Amount(amount),
+		}
+		require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+	}
+	for day := 1; day <= 6; day++ {
+		spend(user, food, 10.25, day)
+	}
+	spend(user, travel, 200, 10)
+	spend(other, food, 999, 10)
+
+	call := func(method string, payload map[string]any) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		if method == "GET" {
+			values := url.Values{}
+			for key, value := range payload {
+				if s, ok := value.(string); ok {
+					values.Set(key, s)
+				}
+			}
+			ctx.Request = httptest.NewRequest(method, "/api/graphql?"+values.Encode(), nil)
+		} else {
+			body, _ := json.Marshal(payload)
+			ctx.Request = httptest.NewRequest(method, "/api/graphql", bytes.NewBuffer(body))
+		}
+		ctx.Set("db", db)
+		ctx.Set("user", user)
+		GraphQL(ctx)
+		ctx.Writer.WriteHeaderNow()
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+		return w.Code, body
+	}
+
+	t.Run("loads categories and owners in batches", func(t *testing.T) {
+		counter.categories.Store(0)
+		counter.users.Store(0)
+		code, body := call("POST", map[string]any{
+			"query": `query Recent($first: Int) {
+				expenses(first: $first, from: "2025-03-01", to: "2025-03-31") {
+					title amount date category { name } owner { firstName email }
+				}
+			}`,
+			"variables": map[string]any{"first": 20},
+		})
+		require.Equal(t, 200, code)
+		require.Nil(t, body["errors"], body)
+
+		expenses := body["data"].(map[string]any)["expenses"].([]any)
+		require.Len(t, expenses, 7)
+		first := expenses[0].(map[string]any)
+		assert.Equal(t, "2025-03-10", first["date"])
+		assert.Equal(t, 200.0, first["amount"])
+		assert.Equal(t, "GraphQL Travel", first["category"].(map[string]any)["name"])
+		assert.Equal(t, "graphql.user@test.com", first["owner"].(map[string]any)["email"])
+
+		assert.EqualValues(t, 1, counter.categories.Load(), "categories should be fetched in one query")
+		assert.EqualValues(t, 1, counter.users.Load(), "owners should be fetched in one query")
+	})
+
+	t.Run("summarizes spending per category", func(t *testing.T) {
+		code, body := call("GET", map[string]any{
+			"query": `{ summary { count total byCategory { category { name } count total } } }`,
+		})
+		require.Equal(t, 200, code)
+		require.Nil(t, body["errors"], body)
+
+		summary := body["data"].(map[string]any)["summary"].(map[string]any)
+		assert.EqualValues(t, 7, summary["count"])
+		assert.InDelta(t, 261.5, summary["total"], 0.001)
+		totals := map[string]float64{}
+		for _, item := range summary["byCategory"].([]any) {
+			item := item.(map[string]any)
+			totals[item["category"].(map[string]any)["name"].(string)] = item["total"].(float64)
+		}
+		assert.InDelta(t, 61.5, totals["GraphQL Food"], 0.001)
+		assert.InDelta(t, 200, totals["GraphQL Travel"], 0.001)
+	})
+
+	t.Run("reports query errors", func(t *testing.T) {
+		code, body := call("POST", map[string]any{"query": `{ expenses(team: true) { id } }`})
+		require.Equal(t, 200, code)
+		errs := body["errors"].([]any)
+		require.Len(t, errs, 1)
+		assert.Contains(t, errs[0].(map[string]any)["message"], "only organization owners and managers")
+
+		_, body = call("POST", map[string]any{"query": `{ expenses(first: 1000) { id } }`})
+		assert.Contains(t, body["errors"].([]any)[0].(map[string]any)["message"], "first must be between 1 and 100")
+
+		_, body = call("POST", map[string]any{"query": `{ expenses { nope } }`})
+		assert.NotEmpty(t, body["errors"])
+
+		_, body = call("POST", map[string]any{"query": `mutation { me { id } }`})
+		assert.NotEmpty(t, body["errors"])
+	})
+
+	t.Run("rejects expensive queries", func(t *testing.T) {
+		// 100 expenses × 100 fields each
+		fields := strings.Repeat("title ", 100)
+		code, body := call("POST", map[string]any{"query": `{ expenses(first: 100) { ` + fields + ` } }`})
+		assert.Equal(t, 400, code)
+		assert.Contains(t, body["error"], "complexity")
+
+		for _, query := range []string{
+			`{ me { ...A } } fragment A on User { ...B } fragment B on User { ...A }`,
+			`{ me { id } } fragment A on User { id ...A }`,
+		} {
+			code, body = call("POST", map[string]any{"query": query})
+			assert.Equal(t, 200, code, "cyclic fragments are reported as query errors")
+			assert.NotEmpty(t, body["errors"])
+		}
+	})
+}
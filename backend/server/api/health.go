@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/buildinfo"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// Health statuses.
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthFailing  = "failing"
+)
+
+type healthCheck struct {
+	Status string `json:"status" example:"ok"`
+	Error  string `json:"error,omitempty"`
+	// Pending lists the migrations not applied yet.
+	Pending []string `json:"pending,omitempty"`
+	// Unknown lists the applied migrations this build does not know about.
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+type healthResponse struct {
+	Status  string                 `json:"status" example:"ok"`
+	Version string                 `json:"version" example:"v1.2.0"`
+	Commit  string                 `json:"commit" example:"0123abc"`
+	Checks  map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// Liveness
+// @Summary Liveness probe
+// @Description Report that the server is running, with the version of the build. It does not check the dependencies, so that an orchestrator does not restart the server while the database is unavailable.
+// @Tags health
+// @Produce json
+// @Success 200 {object} healthResponse
+// @Router /health/live [get]
+func Liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthResponse{Status: healthOK, Version: buildinfo.Version, Commit: buildinfo.Commit})
+}
+
+// Readiness
+// @Summary Readiness probe
+// @Description Check that the database can be reached and that all the migrations are applied, to receive traffic. Applied migrations unknown to this build are listed but do not fail the check, so that the previous version keeps serving during an upgrade.
+// @Tags health
+// @Produce json
+// @Success 200 {object} healthResponse
+// @Failure 503 {object} healthResponse
+// @Router /health/ready [get]
+func Readiness(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	response := healthResponse{
+		Status:  healthOK,
+		Version: buildinfo.Version,
+		Commit:  buildinfo.Commit,
+		Checks:  make(map[string]healthCheck),
+	}
+	fail := func(name string, check healthCheck) {
+		check.Status = healthFailing
+		response.Status = healthDegraded
+		response.Checks[name] = check
+	}
+
+	if err := service.PingDatabase(ctx, db); err != nil {
+		log.Ctx(ctx).Err(err).Msg("database health check error")
+		fail("database", healthCheck{Error: err.Error()})
+	} else {
+		response.Checks["database"] = healthCheck{Status: healthOK}
+	}
+
+	pending, unknown, err := service.MigrationStatus(ctx, db, migrations.Migrations)
+	switch {
+	case err != nil:
+		log.Ctx(ctx).Err(err).Msg("migrations health check error")
+		fail("migrations", healthCheck{Error: err.Error()})
+	case len(pending) > 0:
+		fail("migrations", healthCheck{Error: "migrations are not applied", Pending: pending, Unknown: unknown})
+	default:
+		response.Checks["migrations"] = healthCheck{Status: healthOK, Unknown: unknown}
+	}
+
+	if response.Status != healthOK {
+		ctx.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/buildinfo"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
+	db, err := storage.NewBunDB(filePath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	call := func(db *bun.DB, handler gin.HandlerFunc) (int, healthResponse) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/api/health", nil)
+		ctx.Set("db", db)
+		handler(ctx)
+		var response healthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("is alive", func(t *testing.T) {
+		code, response := call(nil, Liveness)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, healthResponse{Status: "ok", Version: buildinfo.Version, Commit: buildinfo.Commit}, response)
+	})
+
+	t.Run("is ready", func(t *testing.T) {
+		code, response := call(db, Readiness)
+		require.Equal(t, 200, code, response)
+		assert.Equal(t, "ok", response.Status)
+		assert.Equal(t, map[string]healthCheck{
+			"database":   {Status: "ok"},
+			"migrations": {Status: "ok"},
+		}, response.Checks)
+	})
+
+	t.Run("reports missing migrations", func(t *testing.T) {
+		empty, err := storage.NewBunDB(filepath.Join(t.TempDir(), "empty.db"))
+		require.NoError(t, err)
+		defer empty.Close()
+
+		code, response := call(empty, Readiness)
+		assert.Equal(t, 503, code)
+		assert.Equal(t, "degraded", response.Status)
+		assert.Equal(t, "ok", response.Checks["database"].Status)
+		assert.Equal(t, "failing", response.Checks["migrations"].Status)
+		assert.Contains(t, response.Checks["migrations"].Error, "bun_migrations")
+
+		migrator := migrate.NewMigrator(empty, migrations.Migrations)
+		require.NoError(t, migrator.Init(context.Background()))
+		code, response = call(empty, Readiness)
+		assert.Equal(t, 503, code)
+		check := response.Checks["migrations"]
+		assert.Equal(t, "failing", check.Status)
+		assert.Len(t, check.Pending, len(migrations.Migrations.Sorted()))
+		assert.Equal(t, "20250221191532_users", check.Pending[0])
+	})
+
+	t.Run("reports an unreachable database", func(t *testing.T) {
+		closed, err := storage.NewBunDB(filepath.Join(t.TempDir(), "closed.db"))
+		require.NoError(t, err)
+		require.NoError(t, closed.Close())
+
+		code, response := call(closed, Readiness)
+		assert.Equal(t, 503, code)
+		assert.Equal(t, "failing", response.Checks["database"].Status)
+		assert.NotEmpty(t, response.Checks["database"].Error)
+	})
+}
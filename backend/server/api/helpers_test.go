@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+// openTestDB opens the migrated development database, closed once the test
+// and its cleanups are done.
+func openTestDB(t *testing.T) *bun.DB {
+	t.Helper()
+
+	db, err := storage.NewBunDB(filepath.Join(storage.GetRootDir(), "expenses.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+	return db
+}
+
+// newTestUser creates user, with an unused password unless one is set, and
+// deletes it with its data after the test. Tests may delete it themselves.
+func newTestUser(t *testing.T, db *bun.DB, user *models.User) *models.User {
+	t.Helper()
+
+	if user.Password == "" {
+		user.Password = "unused"
+	}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	t.Cleanup(func() {
+		err := service.DeleteUser(context.Background(), db, user.ID)
+		if !errors.Is(err, service.ErrNotFound) {
+			require.NoError(t, err)
+		}
+	})
+	return user
+}
+
+// testRequest is a request made by the tests directly to handlers.
+type testRequest struct {
+	User    *models.User
+	Method  string
+	Target  string
+	Payload any
+	Params  []gin.Param
+	Header  map[string]string
+	// Values are set in the context besides the database and the user, such
+	// as the mailer.
+	Values map[string]any
+}
+
+// callHandler runs handlers on req as the router would, stopping at the first
+// one aborting the request, and returns the response.
+func callHandler(db *bun.DB, req testRequest, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	var body io.Reader = http.NoBody
+	if req.Payload != nil {
+		payload, _ := json.Marshal(req.Payload)
+		body = bytes.NewReader(payload)
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	target := req.Target
+	if target == "" {
+		target = "/api/test"
+	}
+	ctx.Request = httptest.NewRequest(method, target, body)
+	for name, value := range req.Header {
+		ctx.Request.Header.Set(name, value)
+	}
+	ctx.Params = req.Params
+	ctx.Set("db", db)
+	if req.User != nil {
+		ctx.Set("user", req.User)
+	}
+	for key, value := range req.Values {
+		ctx.Set(key, value)
+	}
+	for _, handler := range handlers {
+		if handler(ctx); ctx.IsAborted() {
+			break
+		}
+	}
+	ctx.Writer.WriteHeaderNow()
+	return w
+}
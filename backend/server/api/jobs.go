@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// ListJobs
+// @Summary List background jobs
+// @Description List the 50 latest background jobs created for the user, most recent first
+// @Tags jobs
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.Job
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs [get]
+func ListJobs(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	jobs, err := service.ListJobs(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("job listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, jobs)
+}
+
+// GetJob
+// @Summary Get a background job
+// @Description Get the status of a background job created for the user. Failed attempts are retried at runAt until maxAttempts is reached.
+// @Tags jobs
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs/{id} [get]
+func GetJob(ctx *gin.Context) {
+	jobID, ok := paramID(ctx, "id", "invalid job ID")
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	job, err := service.GetJob(ctx, db, jobID, currentUser.ID)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, job)
+}
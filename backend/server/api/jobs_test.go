@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestJobs(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "job.owner@test.com", FirstName: "Jo", LastName: "Owner"})
+	other := newTestUser(t, db, &models.User{Email: "job.other@test.com", FirstName: "Otto", LastName: "Other"})
+	job := &models.Job{UserID: user.ID, Type: "test.api"}
+	require.NoError(t, service.EnqueueJob(context.Background(), db, job, map[string]int{"id": 1}))
+
+	call := func(user *models.User, handler gin.HandlerFunc, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Target: "/api/jobs", Params: params}, handler)
+	}
+
+	w := call(user, ListJobs)
+	require.Equal(t, 200, w.Code)
+	var jobs []models.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, models.JobStatusPending, jobs[0].Status)
+	assert.JSONEq(t, `{"id":1}`, string(jobs[0].Payload))
+
+	w = call(other, ListJobs)
+	require.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	param := gin.Param{Key: "id", Value: strconv.Itoa(job.ID)}
+	assert.Equal(t, 200, call(user, GetJob, param).Code)
+	assert.Equal(t, 404, call(other, GetJob, param).Code)
+	assert.Equal(t, 400, call(user, GetJob, gin.Param{Key: "id", Value: "x"}).Code)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// shadowLockoutTTL is how long the failed logins of an unknown email are
+// remembered after the last one.
+const shadowLockoutTTL = 24 * time.Hour
+
+// unknownAccounts locks unknown emails out like accounts, so the lockout
+// response does not reveal which emails have an account.
+var unknownAccounts = &shadowLockouts{entries: make(map[string]*shadowLockout)}
+
+type shadowLockout struct {
+	attempts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// shadowLockouts counts the failed logins of unknown emails in memory, with
+// the lockout policy of the accounts. Like the in-memory rate limit store, it
+// is per instance.
+type shadowLockouts struct {
+	mu        sync.Mutex
+	entries   map[string]*shadowLockout
+	lastSweep time.Time
+}
+
+// lockedUntil returns when the lockout of email ends, or the zero time when
+// it is not locked.
+func (s *shadowLockouts) lockedUntil(email string, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[normalizeEmail(email)]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return time.Time{}
+	}
+	return entry.lockedUntil
+}
+
+// fail records a failed login for email, locking it once the policy
+// threshold is reached.
+func (s *shadowLockouts) fail(email string, policy service.LockoutPolicy, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	key := normalizeEmail(email)
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &shadowLockout{}
+		s.entries[key] = entry
+	}
+	entry.attempts++
+	entry.lastFailure = now
+	if d := policy.LockDuration(entry.attempts); d > 0 {
+		entry.lockedUntil = now.Add(d)
+	}
+}
+
+// sweep forgets the emails without failures for shadowLockoutTTL, at most
+// once a minute, so the map does not grow without bound.
+func (s *shadowLockouts) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.Sub(entry.lastFailure) > shadowLockoutTTL && !now.Before(entry.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/webhook"
+)
+
+func TestMain(m *testing.M) {
+	// the secrets stored by the tests are encrypted with a throwaway key
+	config.Current.EncryptionKey = make([]byte, 32)
+	// the tests do not depend on the DNS
+	webhook.Resolver = staticResolver{
+		"example.com":          {{IP: net.ParseIP("93.184.215.14")}},
+		"intranet.example.com": {{IP: net.ParseIP("10.1.2.3")}},
+	}
+	os.Exit(m.Run())
+}
+
+type staticResolver map[string][]net.IPAddr
+
+func (r staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type merchantRequest struct {
+	Name              string   `json:"name" binding:"required,max=255"`
+	Aliases           []string `json:"aliases" binding:"max=50,dive,required,max=255"`
+	DefaultCategoryID int      `json:"defaultCategoryId" binding:"gte=0"`
+}
+
+// ListMerchants
+// @Summary List merchants
+// @Description List the merchants of the user's organization with their aliases and default category
+// @Tags merchants
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.Merchant
+// @Failure 500 {object} models.ErrorResponse
+// @Router /merchants [get]
+func ListMerchants(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	merchants, err := service.ListMerchants(ctx, db, orgID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("merchant listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, merchants)
+}
+
+// CreateMerchant
+// @Summary Create a merchant
+// @Description Create a merchant in the administrator's organization. New expenses of the organization whose merchant starts with its name or one of its aliases, ignoring case, punctuation and store numbers, are linked to it. Administrators only.
+// @Tags merchants
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body merchantRequest true "Merchant"
+// @Success 201 {object} models.Merchant
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /merchants [post]
+func CreateMerchant(ctx *gin.Context) {
+	var req merchantRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	merchant := &models.Merchant{OrganizationID: orgID, Name: req.Name, DefaultCategoryID: req.DefaultCategoryID}
+	if err := service.CreateMerchant(ctx, db, merchant, req.Aliases); err != nil {
+		log.Ctx(ctx).Err(err).Msg("merchant creation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, merchant)
+}
+
+// UpdateMerchant
+// @Summary Update a merchant
+// @Description Rename a merchant, replace its aliases and default category. Expenses already linked to it are not changed. Administrators only.
+// @Tags merchants
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Merchant ID"
+// @Param request body merchantRequest true "Merchant"
+// @Success 200 {object} models.Merchant
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /merchants/{id} [put]
+func UpdateMerchant(ctx *gin.Context) {
+	var req merchantRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	merchantID, ok := paramID(ctx, "id", "invalid merchant ID")
+	if !ok {
+		return
+	}
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	merchant := &models.Merchant{ID: merchantID, OrganizationID: orgID, Name: req.Name, DefaultCategoryID: req.DefaultCategoryID}
+	if err := service.UpdateMerchant(ctx, db, merchant, req.Aliases); err != nil {
+		log.Ctx(ctx).Err(err).Msg("merchant update error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, merchant)
+}
+
+// DeleteMerchant
+// @Summary Delete a merchant
+// @Description Delete a merchant and its aliases. Its expenses keep their merchant name. Administrators only.
+// @Tags merchants
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Merchant ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /merchants/{id} [delete]
+func DeleteMerchant(ctx *gin.Context) {
+	merchantID, ok := paramID(ctx, "id", "invalid merchant ID")
+	if !ok {
+		return
+	}
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.DeleteMerchant(ctx, db, orgID, merchantID); err != nil {
+		log.Ctx(ctx).Err(err).Msg("merchant deletion error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
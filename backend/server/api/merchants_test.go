@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestMerchants(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	admin := newTestUser(t, db, &models.User{Email: "merchant.admin@test.com", FirstName: "Ada", LastName: "Admin", IsAdmin: true})
+	user := newTestUser(t, db, &models.User{Email: "merchant.shopper@test.com", FirstName: "Sam", LastName: "Shopper"})
+	supplies := &models.Category{Name: "Merchant Supplies"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, supplies))
+	books := &models.Category{Name: "Merchant Books"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, books))
+	travel := &models.Category{Name: "Merchant Travel"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, travel))
+
+	var merchantIDs []int
+	t.Cleanup(func() {
+		if len(merchantIDs) > 0 {
+			_, err := db.NewDelete().Model((*models.Merchant)(nil)).Where("id IN (?)", bun.In(merchantIDs)).Exec(context.Background())
+			require.NoError(t, err)
+		}
+		for _, category := range []*models.Category{supplies, books, travel} {
+			require.NoError(t, service.DeleteCategory(context.Background(), db, 0, category))
+		}
+	})
+
+	call := func(user *models.User, method, target string, handler gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: target, Payload: payload, Params: params}, handler)
+	}
+	idParam := func(id int) gin.Param {
+		return gin.Param{Key: "id", Value: strconv.Itoa(id)}
+	}
+	spend := func(title, merchant string, categoryID int) models.ExpenseResponse {
+		w := call(user, "POST", "/api/expenses", CreateExpense, map[string]any{
+			"title": title, "merchant": merchant, "amount": 25, "date": "2025-05-02", "categoryId": categoryID,
+		})
+		require.Equal(t, 201, w.Code, w.Body.String())
+		var expense models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+		return expense
+	}
+
+	w := call(admin, "POST", "/api/merchants", CreateMerchant, map[string]any{
+		"name": "Amazon", "aliases": []string{"AMZN", "Amazon Marketplace", "amazon.com"}, "defaultCategoryId": supplies.ID,
+	})
+	require.Equal(t, 201, w.Code, w.Body.String())
+	var amazon map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &amazon))
+	amazonID := int(amazon["id"].(float64))
+	merchantIDs = append(merchantIDs, amazonID)
+	assert.Equal(t, []any{"AMZN", "Amazon Marketplace"}, amazon["aliases"], "amazon.com is the name once normalized")
+
+	t.Run("validates merchants", func(t *testing.T) {
+		w := call(admin, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "Shop", "aliases": []string{"AMZN Inc."}})
+		assert.Equal(t, 409, w.Code, "alias of another merchant")
+		w = call(admin, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "AMAZON"})
+		assert.Equal(t, 409, w.Code, "name of another merchant")
+		w = call(admin, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "..."})
+		assert.Equal(t, 400, w.Code)
+		w = call(admin, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "Shop", "defaultCategoryId": 999999})
+		assert.Equal(t, 400, w.Code)
+		w = call(admin, "PUT", "/api/merchants/x", UpdateMerchant, map[string]any{"name": "Shop"}, idParam(999999))
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("normalizes merchants and assigns categories", func(t *testing.T) {
+		expense := spend("Printer paper", "AMZN Mktp US*2K3", 0)
+		assert.Equal(t, "Amazon", expense.Merchant)
+		assert.Equal(t, amazonID, expense.MerchantID)
+		assert.Equal(t, supplies.ID, expense.CategoryID)
+		assert.Equal(t, service.CategorySourceMerchant, expense.CategorySource)
+
+		expense = spend("Go book", "amazon.com", books.ID)
+		assert.Equal(t, amazonID, expense.MerchantID)
+		assert.Equal(t, books.ID, expense.CategoryID)
+		assert.Empty(t, expense.CategorySource)
+		spend("Rust book", "Amazon", books.ID)
+
+		expense = spend("Another book", "AMAZON MARKETPLACE", 0)
+		assert.Equal(t, books.ID, expense.CategoryID, "the user's habit wins over the default")
+		assert.Equal(t, service.CategorySourceMerchantHistory, expense.CategorySource)
+
+		expense = spend("Taxi to the airport", "Yellow Cab Co 42", travel.ID)
+		assert.Equal(t, "Yellow Cab Co 42", expense.Merchant, "unknown merchants are kept")
+		assert.Zero(t, expense.MerchantID)
+		expense = spend("Taxi home", "", 0)
+		assert.Equal(t, travel.ID, expense.CategoryID)
+		assert.Equal(t, service.CategorySourceTitleHistory, expense.CategorySource)
+
+		expense = spend("Lunch", "Corner Deli", 0)
+		assert.Zero(t, expense.CategoryID)
+	})
+
+	t.Run("suggests categories", func(t *testing.T) {
+		w := call(user, "GET", "/api/expenses/suggestion?merchant=Amazon.com&title=Notebook", SuggestExpenseCategory, nil)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var suggestion service.CategorySuggestion
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &suggestion))
+		require.NotNil(t, suggestion.Merchant)
+		assert.Equal(t, "Amazon", suggestion.Merchant.Name)
+		assert.Equal(t, books.ID, suggestion.CategoryID)
+
+		w = call(admin, "GET", "/api/expenses/suggestion?merchant=Amazon.com", SuggestExpenseCategory, nil)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		suggestion = service.CategorySuggestion{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &suggestion))
+		assert.Equal(t, supplies.ID, suggestion.CategoryID, "other users' history is not used")
+		assert.Equal(t, service.CategorySourceMerchant, suggestion.Source)
+	})
+
+	t.Run("organizations do not share merchants", func(t *testing.T) {
+		rival := newTestUser(t, db, &models.User{Email: "merchant.rival@test.com", FirstName: "Rita", LastName: "Rival", IsAdmin: true})
+		org := &models.Organization{Name: "Merchant Rivals"}
+		_, err := service.CreateOrganization(context.Background(), db, org, rival.ID)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := db.NewDelete().Model(org).WherePK().Exec(context.Background())
+			require.NoError(t, err)
+		})
+
+		w := call(rival, "GET", "/api/merchants", ListMerchants, nil)
+		require.Equal(t, 200, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+
+		w = call(rival, "POST", "/api/expenses", CreateExpense, map[string]any{
+			"title": "Paper", "merchant": "AMZN", "amount": 25, "date": "2025-05-02", "categoryId": supplies.ID,
+		})
+		assert.Equal(t, 400, w.Code, "the categories of other organizations are rejected")
+		w = call(rival, "POST", "/api/expenses", CreateExpense, map[string]any{
+			"title": "Paper", "merchant": "AMZN", "merchantId": amazonID, "amount": 25, "date": "2025-05-02",
+		})
+		require.Equal(t, 201, w.Code, w.Body.String())
+		var expense models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+		assert.Zero(t, expense.MerchantID, "the merchants of other organizations are not matched")
+		assert.Zero(t, expense.CategoryID)
+
+		w = call(rival, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "Amazon", "defaultCategoryId": supplies.ID})
+		assert.Equal(t, 400, w.Code, "the categories of other organizations are rejected")
+		w = call(rival, "POST", "/api/merchants", CreateMerchant, map[string]any{"name": "Amazon", "aliases": []string{"AMZN"}})
+		require.Equal(t, 201, w.Code, "names are only unique within an organization")
+		var theirs map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &theirs))
+		merchantIDs = append(merchantIDs, int(theirs["id"].(float64)))
+		w = call(rival, "DELETE", "/api/merchants/x", DeleteMerchant, nil, idParam(amazonID))
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("updates and deletes merchants", func(t *testing.T) {
+		w := call(admin, "PUT", "/api/merchants/x", UpdateMerchant, map[string]any{
+			"name": "Amazon", "aliases": []string{"AMZN"},
+		}, idParam(amazonID))
+		require.Equal(t, 200, w.Code, w.Body.String())
+		expense := spend("Cables", "Amazon Marketplace", 0)
+		assert.Equal(t, amazonID, expense.MerchantID, "still matches the name")
+
+		w = call(user, "GET", "/api/merchants", ListMerchants, nil)
+		require.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"aliases":["AMZN"]`)
+
+		w = call(admin, "DELETE", "/api/merchants/x", DeleteMerchant, nil, idParam(amazonID))
+		require.Equal(t, 204, w.Code)
+		w = call(user, "GET", "/api/expenses/x", GetExpense, nil, idParam(expense.ID))
+		require.Equal(t, 200, w.Code)
+		var stored models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+		assert.Zero(t, stored.MerchantID)
+		assert.Equal(t, "Amazon", stored.Merchant)
+	})
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+const (
+	totpIssuer        = "Expense Manager"
+	recoveryCodeCount = 10
+)
+
+// secondFactor is either a code from the authenticator app or a recovery code.
+type secondFactor struct {
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" binding:"required_without=Code"`
+}
+
+type mfaLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	secondFactor
+}
+
+type mfaStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type mfaEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauthUri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type mfaActivateRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type mfaDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	secondFactor
+}
+
+func invalidSecondFactor(err error) error {
+	return &middleware.HTTPError{
+		Status:  http.StatusUnauthorized,
+		Code:    models.ErrorCodeUnauthorized,
+		Message: "invalid two-factor code",
+		Err:     err,
+	}
+}
+
+// verifySecondFactor checks a TOTP or recovery code for user and marks it as
+// used. Wrong codes are returned as a 401 error.
+func verifySecondFactor(ctx context.Context, db *bun.DB, user *models.User, factor secondFactor) error {
+	if factor.RecoveryCode != "" {
+		err := service.UseRecoveryCode(ctx, db, user.ID, factor.RecoveryCode)
+		if errors.Is(err, service.ErrInvalid) {
+			return invalidSecondFactor(err)
+		}
+		return err
+	}
+
+	secret, err := utils.Decrypt(config.Current.EncryptionKey, user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := utils.ValidateTOTP(secret, factor.Code, time.Now())
+	if !ok {
+		return invalidSecondFactor(nil)
+	}
+	err = service.UseTOTPStep(ctx, db, user.ID, step)
+	if errors.Is(err, service.ErrInvalid) {
+		return invalidSecondFactor(err)
+	}
+	return err
+}
+
+// UserLoginMFA
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token returned by /auth/login and a TOTP or recovery code for an access token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body mfaLoginRequest true "Challenge token and second factor"
+// @Success 200 {object} userLoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/login/2fa [post]
+func UserLoginMFA(ctx *gin.Context) {
+	var req mfaLoginRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	userID, err := middleware.ValidateMFAChallengeToken(req.ChallengeToken)
+	if err != nil {
+		middleware.AbortWithError(ctx, &middleware.HTTPError{
+			Status:  http.StatusUnauthorized,
+			Code:    models.ErrorCodeUnauthorized,
+			Message: "invalid or expired challenge token",
+			Err:     err,
+		})
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	entity, err := service.GetUserById(ctx, db, userID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("user retrieval error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	now := time.Now()
+	if entity.IsLocked(now) {
+		telemetry.RecordLogin(telemetry.LoginLocked)
+		middleware.AbortWithError(ctx, accountLocked(entity.LockedUntil.Sub(now)))
+		return
+	}
+	if !entity.TOTPEnabled {
+		middleware.AbortWithError(ctx, middleware.BadRequest("two-factor authentication is not enabled"))
+		return
+	}
+
+	if err := verifySecondFactor(ctx, db, entity, req.secondFactor); err != nil {
+		var httpErr *middleware.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Status == http.StatusUnauthorized {
+			if err := service.RecordFailedLogin(ctx, db, entity, lockoutPolicy()); err != nil {
+				log.Ctx(ctx).Err(err).Int("user", entity.ID).Msg("failed login tracking error")
+			}
+			telemetry.RecordLogin(telemetry.LoginFailure)
+		} else {
+			log.Ctx(ctx).Err(err).Int("user", entity.ID).Msg("second factor verification error")
+		}
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	completeLogin(ctx, db, entity)
+}
+
+// GetMFAStatus
+// @Summary Two-factor authentication status
+// @Description Tell whether two-factor authentication is enabled for the current user
+// @Tags Auth
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} mfaStatusResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa [get]
+func GetMFAStatus(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	remaining := 0
+	if currentUser.TOTPEnabled {
+		count, err := service.CountRecoveryCodes(ctx, db, currentUser.ID)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("recovery code count error")
+			middleware.AbortWithError(ctx, err)
+			return
+		}
+		remaining = count
+	}
+
+	ctx.JSON(http.StatusOK, mfaStatusResponse{Enabled: currentUser.TOTPEnabled, RecoveryCodesRemaining: remaining})
+}
+
+// EnrollMFA
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret and recovery codes. They are only shown once; two-factor authentication is enforced after /auth/2fa/activate.
+// @Tags Auth
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} mfaEnrollmentResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/enroll [post]
+func EnrollMFA(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	encrypted, err := utils.Encrypt(config.Current.EncryptionKey, secret)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	if err := service.StartTOTPEnrollment(ctx, db, currentUser, encrypted, codes); err != nil {
+		log.Ctx(ctx).Err(err).Msg("two-factor enrollment error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mfaEnrollmentResponse{
+		Secret:        secret,
+		OTPAuthURI:    utils.TOTPURI(totpIssuer, currentUser.Email, secret),
+		RecoveryCodes: codes,
+	})
+}
+
+// ActivateMFA
+// @Summary Activate two-factor authentication
+// @Description Confirm enrollment with a code from the authenticator app
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body mfaActivateRequest true "Authenticator code"
+// @Success 200 {object} mfaStatusResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/activate [post]
+func ActivateMFA(ctx *gin.Context) {
+	var req mfaActivateRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if currentUser.TOTPEnabled {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(
+			http.StatusConflict, models.ErrorCodeConflict, "two-factor authentication is already enabled"))
+		return
+	}
+	if currentUser.TOTPSecret == "" {
+		middleware.AbortWithError(ctx, middleware.BadRequest("two-factor enrollment has not been started"))
+		return
+	}
+
+	secret, err := utils.Decrypt(config.Current.EncryptionKey, currentUser.TOTPSecret)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		middleware.AbortWithError(ctx, invalidSecondFactor(nil))
+		return
+	}
+
+	if err := service.ActivateTOTP(ctx, db, currentUser, step); err != nil {
+		log.Ctx(ctx).Err(err).Msg("two-factor activation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mfaStatusResponse{Enabled: true, RecoveryCodesRemaining: recoveryCodeCount})
+}
+
+// DisableMFA
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor authentication. Requires the password and a TOTP or recovery code; wrong ones count as failed logins.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body mfaDisableRequest true "Password and second factor"
+// @Success 200 {object} mfaStatusResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/disable [post]
+func DisableMFA(ctx *gin.Context) {
+	var req mfaDisableRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if !currentUser.TOTPEnabled {
+		middleware.AbortWithError(ctx, middleware.BadRequest("two-factor authentication is not enabled"))
+		return
+	}
+
+	if !checkCurrentPassword(ctx, db, currentUser, req.Password) {
+		return
+	}
+	if err := verifySecondFactor(ctx, db, currentUser, req.secondFactor); err != nil {
+		var httpErr *middleware.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Status == http.StatusUnauthorized {
+			if err := service.RecordFailedLogin(ctx, db, currentUser, lockoutPolicy()); err != nil {
+				log.Ctx(ctx).Err(err).Int("user", currentUser.ID).Msg("failed login tracking error")
+			}
+		}
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	if err := service.DisableTOTP(ctx, db, currentUser); err != nil {
+		log.Ctx(ctx).Err(err).Msg("two-factor disable error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mfaStatusResponse{Enabled: false})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	hashedPassword, err := utils.HashPassword("secret123")
+	require.NoError(t, err)
+	user := &models.User{
+		Email:     "two.factor@test.com",
+		Password:  hashedPassword,
+		FirstName: "Tess",
+		LastName:  "Factor",
+	}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+	})
+
+	// call runs handler as the current user, reloaded like JWTMiddleware does
+	call := func(handler gin.HandlerFunc, payload any) *httptest.ResponseRecorder {
+		current, err := service.GetUserById(context.Background(), db, user.ID)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(payload)
+		ctx.Request = httptest.NewRequest("POST", "/api/auth/2fa", bytes.NewBuffer(body))
+		ctx.Set("db", db)
+		ctx.Set("user", current)
+		handler(ctx)
+		return w
+	}
+
+	w := call(ActivateMFA, map[string]any{"code": "123456"})
+	assert.Equal(t, 400, w.Code, "enrollment must be started first")
+
+	w = call(EnrollMFA, nil)
+	require.Equal(t, 200, w.Code)
+	var enrollment mfaEnrollmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/")
+	assert.Len(t, enrollment.RecoveryCodes, recoveryCodeCount)
+
+	stored, err := service.GetUserById(context.Background(), db, user.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.TOTPSecret, enrollment.Secret, "the secret is encrypted at rest")
+	assert.False(t, stored.TOTPEnabled)
+
+	// not enforced until activated
+	w = postJSON(db, nil, UserLogin, map[string]any{"email": user.Email, "password": "secret123"})
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"token"`)
+
+	step := utils.TOTPStep(time.Now())
+	code, err := utils.TOTPCode(enrollment.Secret, step)
+	require.NoError(t, err)
+	w = call(ActivateMFA, map[string]any{"code": "000000"})
+	assert.Equal(t, 401, w.Code)
+	w = call(ActivateMFA, map[string]any{"code": code})
+	require.Equal(t, 200, w.Code)
+
+	// the password alone now only yields a challenge
+	w = postJSON(db, nil, UserLogin, map[string]any{"email": user.Email, "password": "secret123"})
+	require.Equal(t, 200, w.Code)
+	var login userLoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.True(t, login.MFARequired)
+	assert.Empty(t, login.Token)
+	require.NotEmpty(t, login.ChallengeToken)
+
+	// the challenge is not an access token
+	w = httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/api/expenses", nil)
+	ctx.Request.Header.Set("Authorization", "Bearer "+login.ChallengeToken)
+	ctx.Set("db", db)
+	middleware.JWTMiddleware()(ctx)
+	assert.Equal(t, 401, w.Code)
+
+	w = postJSON(db, nil, UserLoginMFA, map[string]any{"challengeToken": login.ChallengeToken})
+	assert.Equal(t, 400, w.Code, "a code or a recovery code is required")
+
+	w = postJSON(db, nil, UserLoginMFA, map[string]any{"challengeToken": login.ChallengeToken, "code": code})
+	assert.Equal(t, 401, w.Code, "the code used for activation cannot be replayed")
+
+	nextCode, err := utils.TOTPCode(enrollment.Secret, step+1)
+	require.NoError(t, err)
+	w = postJSON(db, nil, UserLoginMFA, map[string]any{"challengeToken": login.ChallengeToken, "code": nextCode})
+	require.Equal(t, 200, w.Code)
+	var completed userLoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &completed))
+	assert.NotEmpty(t, completed.Token)
+
+	recoveryCode := enrollment.RecoveryCodes[0]
+	w = postJSON(db, nil, UserLoginMFA, map[string]any{"challengeToken": login.ChallengeToken, "recoveryCode": recoveryCode})
+	require.Equal(t, 200, w.Code)
+	w = postJSON(db, nil, UserLoginMFA, map[string]any{"challengeToken": login.ChallengeToken, "recoveryCode": recoveryCode})
+	assert.Equal(t, 401, w.Code, "recovery codes are single use")
+
+	w = call(GetMFAStatus, nil)
+	require.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"enabled":true,"recoveryCodesRemaining":9}`, w.Body.String())
+
+	w = call(EnrollMFA, nil)
+	assert.Equal(t, 409, w.Code, "enrolling again requires disabling first")
+
+	stored, err = service.GetUserById(context.Background(), db, user.ID)
+	require.NoError(t, err)
+	attempts := stored.FailedLoginAttempts
+	w = call(DisableMFA, map[string]any{"password": "wrong-password", "recoveryCode": enrollment.RecoveryCodes[1]})
+	assert.Equal(t, 401, w.Code)
+	w = call(DisableMFA, map[string]any{"password": "secret123", "recoveryCode": "guessed"})
+	assert.Equal(t, 401, w.Code)
+	stored, err = service.GetUserById(context.Background(), db, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, attempts+2, stored.FailedLoginAttempts, "wrong passwords and codes count as failed logins")
+
+	// a locked account cannot disable it, even with the right password
+	_, err = db.NewUpdate().Model(stored).Set("locked_until = ?", time.Now().Add(time.Minute)).WherePK().Exec(context.Background())
+	require.NoError(t, err)
+	w = call(DisableMFA, map[string]any{"password": "secret123", "recoveryCode": enrollment.RecoveryCodes[1]})
+	assert.Equal(t, 429, w.Code)
+	_, err = db.NewUpdate().Model(stored).Set("locked_until = NULL").WherePK().Exec(context.Background())
+	require.NoError(t, err)
+
+	w = call(DisableMFA, map[string]any{"password": "secret123", "recoveryCode": enrollment.RecoveryCodes[1]})
+	require.Equal(t, 200, w.Code)
+
+	w = postJSON(db, nil, UserLogin, map[string]any{"email": user.Email, "password": "secret123"})
+	require.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "challengeToken")
+}
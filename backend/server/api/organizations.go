@@ -0,0 +1,469 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type createOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type membershipResponse struct {
+	Organization *models.Organization `json:"organization"`
+	Role         string               `json:"role"`
+}
+
+type inviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner manager member"`
+}
+
+type updateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner manager member"`
+}
+
+type teamQuery struct {
+	From     string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To       string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	MemberID int    `form:"member" binding:"omitempty,min=1"`
+}
+
+// bindTeamFilter reads the from, to and member query parameters, writing a
+// validation error response and returning false when they are invalid.
+func bindTeamFilter(ctx *gin.Context) (service.TeamFilter, bool) {
+	var query teamQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return service.TeamFilter{}, false
+	}
+
+	filter := service.TeamFilter{MemberID: query.MemberID}
+	// the dates were validated by the binding
+	if query.From != "" {
+		filter.From, _ = time.Parse("2006-01-02", query.From)
+	}
+	if query.To != "" {
+		filter.To, _ = time.Parse("2006-01-02", query.To)
+	}
+	return filter, true
+}
+
+// currentMembership loads the organization membership of the current user,
+// writing an error response and returning false when they have none or lack
+// the permission checked by allowed.
+func currentMembership(ctx *gin.Context, allowed func(*models.OrganizationMember) bool) (*models.OrganizationMember, bool) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	member, err := service.GetMembership(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("membership retrieval error")
+		middleware.AbortWithError(ctx, err)
+		return nil, false
+	}
+	if allowed != nil && !allowed(member) {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(
+			http.StatusForbidden, models.ErrorCodeForbidden, "your role in the organization does not allow this"))
+		return nil, false
+	}
+	return member, true
+}
+
+// currentOrganization returns the ID of the current user's organization, whose
+// categories, merchants, rates and policy rules they use, or zero when they
+// have none. It writes an error response and returns false on failure.
+func currentOrganization(ctx *gin.Context) (int, bool) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	orgID, err := service.OrganizationOf(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("organization retrieval error")
+		middleware.AbortWithError(ctx, err)
+		return 0, false
+	}
+	return orgID, true
+}
+
+// CreateOrganization
+// @Summary Create an organization
+// @Description Create an organization owned by the current user. Users belong to at most one organization.
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body createOrganizationRequest true "Organization"
+// @Success 201 {object} membershipResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization [post]
+func CreateOrganization(ctx *gin.Context) {
+	var req createOrganizationRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	member, err := service.CreateOrganization(ctx, db, &models.Organization{Name: req.Name}, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("organization creation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, membershipResponse{Organization: member.Organization, Role: member.Role})
+}
+
+// GetOrganization
+// @Summary Current organization
+// @Description Get the organization of the current user and their role in it
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} membershipResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization [get]
+func GetOrganization(ctx *gin.Context) {
+	member, ok := currentMembership(ctx, nil)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, membershipResponse{Organization: member.Organization, Role: member.Role})
+}
+
+// ListMembers
+// @Summary List organization members
+// @Description List the members of the current user's organization
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} service.TeamMember
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/members [get]
+func ListMembers(ctx *gin.Context) {
+	member, ok := currentMembership(ctx, nil)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	members, err := service.ListMembers(ctx, db, member.OrganizationID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("member listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, members)
+}
+
+// InviteMember
+// @Summary Invite a member
+// @Description Invite the owner of an email address to join the organization. They become a member once they accept the invitation, signed in with that address. The response is the same whether or not the address is registered or already belongs to an organization. Only owners can manage members.
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body inviteMemberRequest true "Invitation"
+// @Success 202 {object} models.OrganizationInvitation
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/invitations [post]
+func InviteMember(ctx *gin.Context) {
+	var req inviteMemberRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	member, ok := currentMembership(ctx, (*models.OrganizationMember).CanManageMembers)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	m := ctx.MustGet("mailer").(mailer.Mailer)
+	currentUser := ctx.MustGet("user").(*models.User)
+	invitation, err := service.InviteMember(ctx, db, member.OrganizationID, currentUser.ID, req.Email, req.Role, config.Current.InvitationTTL)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("invitation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	if err := sendInvitationEmail(ctx, m, currentUser, member.Organization, invitation); err != nil {
+		log.Ctx(ctx).Err(err).Int("invitation", invitation.ID).Msg("invitation email error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, invitation)
+}
+
+func sendInvitationEmail(ctx context.Context, m mailer.Mailer, from *models.User, org *models.Organization, invitation *models.OrganizationInvitation) error {
+	return m.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: "Invitation to join " + org.Name,
+		Body: fmt.Sprintf("Hello,\n\n"+
+			"%s invited you to join %s on Expense Manager as a %s. Sign in with this address, or create an account with it,\n"+
+			"and accept the invitation from the page below:\n\n%s\n\n"+
+			"The invitation expires in %s. If you do not want to join, you can ignore this email.\n",
+			from.FullName(), org.Name, invitation.Role, config.Current.AppBaseURL+"/invitations", config.Current.InvitationTTL),
+	})
+}
+
+// ListInvitations
+// @Summary List my invitations
+// @Description List the pending invitations to join an organization sent to the current user's email address
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.OrganizationInvitation
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/invitations [get]
+func ListInvitations(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	invitations, err := service.ListInvitations(ctx, db, currentUser.Email)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("invitation listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitation
+// @Summary Accept an invitation
+// @Description Join the organization that sent an invitation to the current user's email address, which must be verified. Users belong to at most one organization.
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Invitation ID"
+// @Success 201 {object} membershipResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/invitations/{id}/accept [post]
+func AcceptInvitation(ctx *gin.Context) {
+	id, ok := paramID(ctx, "id", "invalid invitation ID")
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	// the address proves the invitation is for them
+	if !currentUser.IsEmailVerified() {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(
+			http.StatusForbidden, models.ErrorCodeEmailNotVerified, "email address is not verified"))
+		return
+	}
+
+	member, err := service.AcceptInvitation(ctx, db, id, currentUser)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("invitation acceptance error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, membershipResponse{Organization: member.Organization, Role: member.Role})
+}
+
+// DeclineInvitation
+// @Summary Decline an invitation
+// @Description Delete an invitation sent to the current user's email address
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Invitation ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/invitations/{id} [delete]
+func DeclineInvitation(ctx *gin.Context) {
+	id, ok := paramID(ctx, "id", "invalid invitation ID")
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if err := service.DeclineInvitation(ctx, db, id, currentUser.Email); err != nil {
+		log.Ctx(ctx).Err(err).Msg("invitation decline error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// UpdateMember
+// @Summary Change the role of a member
+// @Description Change the role of an organization member. Only owners can manage members and the last owner cannot be demoted.
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param userId path int true "User ID"
+// @Param request body updateMemberRequest true "Role"
+// @Success 200 {object} service.TeamMember
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/members/{userId} [patch]
+func UpdateMember(ctx *gin.Context) {
+	var req updateMemberRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	userID, ok := paramID(ctx, "userId", "invalid user ID")
+	if !ok {
+		return
+	}
+	member, ok := currentMembership(ctx, (*models.OrganizationMember).CanManageMembers)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	updated, err := service.UpdateMemberRole(ctx, db, member.OrganizationID, userID, req.Role)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("member update error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// RemoveMember
+// @Summary Remove a member
+// @Description Remove a member from the organization. Owners can remove anyone; other members can only leave. Their past expenses stay visible to the organization.
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param userId path int true "User ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/members/{userId} [delete]
+func RemoveMember(ctx *gin.Context) {
+	userID, ok := paramID(ctx, "userId", "invalid user ID")
+	if !ok {
+		return
+	}
+	member, ok := currentMembership(ctx, func(m *models.OrganizationMember) bool {
+		return m.CanManageMembers() || m.UserID == userID
+	})
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.RemoveMember(ctx, db, member.OrganizationID, userID); err != nil {
+		log.Ctx(ctx).Err(err).Msg("member removal error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListTeamExpenses
+// @Summary List the team's expenses
+// @Description List the expenses recorded by members of the organization. Only owners and managers can see the team's expenses.
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param member query int false "Only the expenses of this user"
+// @Param include query string false "Relations to embed, comma-separated: category, owner. Also accepted as expand."
+// @Success 200 {array} models.ExpenseResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/expenses [get]
+func ListTeamExpenses(ctx *gin.Context) {
+	filter, ok := bindTeamFilter(ctx)
+	if !ok {
+		return
+	}
+	include, ok := bindExpenseRelations(ctx)
+	if !ok {
+		return
+	}
+	member, ok := currentMembership(ctx, (*models.OrganizationMember).CanViewTeam)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	expenses, err := service.ListTeamExpenses(ctx, db, member.OrganizationID, filter, include)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("team expense listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, expenseResponses(expenses))
+}
+
+// GetTeamReport
+// @Summary Team spend report
+// @Description Total spend of the organization per member and per category. Only owners and managers can see the report.
+// @Tags organization
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param member query int false "Only the expenses of this user"
+// @Success 200 {object} service.TeamReport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organization/report [get]
+func GetTeamReport(ctx *gin.Context) {
+	filter, ok := bindTeamFilter(ctx)
+	if !ok {
+		return
+	}
+	member, ok := currentMembership(ctx, (*models.OrganizationMember).CanViewTeam)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	report, err := service.GetTeamReport(ctx, db, member.OrganizationID, filter)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("team report error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestOrganizationTeamReporting(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	newUser := func(email, first, last string) *models.User {
+		return newTestUser(t, db, &models.User{Email: email, FirstName: first, LastName: last, EmailVerifiedAt: time.Now()})
+	}
+	owner := newUser("team.owner@test.com", "Olivia", "Owner")
+	manager := newUser("team.manager@test.com", "Marc", "Manager")
+	member := newUser("team.member@test.com", "Mia", "Member")
+	outsider := newUser("team.outsider@test.com", "Oscar", "Outsider")
+
+	var orgIDs []int
+	t.Cleanup(func() {
+		if len(orgIDs) > 0 {
+			_, err := db.NewDelete().Model((*models.Organization)(nil)).Where("id IN (?)", bun.In(orgIDs)).Exec(context.Background())
+			require.NoError(t, err)
+		}
+	})
+
+	mailDir := t.TempDir()
+	mail := mailer.NewFileMailer(mailDir, "test@localhost")
+	call := func(user *models.User, method, target string, handler gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{
+			User: user, Method: method, Target: target, Payload: payload, Params: params,
+			Values: map[string]any{"mailer": mail},
+		}, handler)
+	}
+	userParam := func(user *models.User) gin.Param {
+		return gin.Param{Key: "userId", Value: strconv.Itoa(user.ID)}
+	}
+	idParam := func(id int) gin.Param {
+		return gin.Param{Key: "id", Value: strconv.Itoa(id)}
+	}
+	invite := func(email, role string) models.OrganizationInvitation {
+		w := call(owner, "POST", "/api/organization/invitations", InviteMember, map[string]any{"email": email, "role": role})
+		require.Equal(t, 202, w.Code)
+		var invitation models.OrganizationInvitation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+		return invitation
+	}
+	spend := func(user *models.User, categoryID int, amount float64, day int) {
+		title := "Team expense"
+		if categoryID == 0 {
+			// unlike the other titles, so no category is suggested
+			title = "Snacks"
+		}
+		expense := &models.Expense{
+			OwnerID:    user.ID,
+			CategoryID: categoryID,
+			Title:      title,
+			Date:       time.Date(2025, 3, day, 0, 0, 0, 0, time.UTC),
+			Amount:     models.Amount(amount),
+		}
+		require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+	}
+
+	w := call(owner, "GET", "/api/organization", GetOrganization, nil)
+	assert.Equal(t, 404, w.Code)
+
+	w = call(owner, "POST", "/api/organization", CreateOrganization, map[string]any{"name": "Rocket Team"})
+	require.Equal(t, 201, w.Code)
+	var membership membershipResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &membership))
+	assert.Equal(t, models.RoleOwner, membership.Role)
+	orgIDs = append(orgIDs, membership.Organization.ID)
+
+	w = call(outsider, "POST", "/api/organization", CreateOrganization, map[string]any{"name": "Other Team"})
+	require.Equal(t, 201, w.Code)
+	var other membershipResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &other))
+	orgIDs = append(orgIDs, other.Organization.ID)
+
+	// the organizations have categories of the same name
+	travel := &models.Category{OrganizationID: membership.Organization.ID, Name: "Team Travel"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, travel))
+	otherTravel := &models.Category{OrganizationID: other.Organization.ID, Name: "Team Travel"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, otherTravel))
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, travel))
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, otherTravel))
+	})
+
+	// personal expense recorded before joining stays private
+	spend(member, 0, 5, 1)
+
+	for user, role := range map[*models.User]string{manager: "manager", member: "member"} {
+		invite(user.Email, role)
+		w = call(user, "GET", "/api/organization/invitations", ListInvitations, nil)
+		require.Equal(t, 200, w.Code)
+		var invitations []models.OrganizationInvitation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitations))
+		require.Len(t, invitations, 1)
+		assert.Equal(t, "Rocket Team", invitations[0].Organization.Name)
+		w = call(user, "POST", "/api/organization/invitations/accept", AcceptInvitation, nil, idParam(invitations[0].ID))
+		require.Equal(t, 201, w.Code)
+	}
+
+	t.Run("invitation rules", func(t *testing.T) {
+		entries, err := os.ReadDir(mailDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "invitations are sent by email")
+
+		// the response does not tell registered emails apart
+		toOutsider := invite(outsider.Email, "member")
+		toNobody := invite("team.nobody@test.com", "member")
+		assert.Equal(t, toOutsider.Role, toNobody.Role)
+		assert.Equal(t, toOutsider.OrganizationID, toNobody.OrganizationID)
+
+		w := call(outsider, "POST", "/api/organization/invitations/accept", AcceptInvitation, nil, idParam(toNobody.ID))
+		assert.Equal(t, 404, w.Code, "invitations are only accepted by their recipient")
+		unverified := *outsider
+		unverified.EmailVerifiedAt = time.Time{}
+		w = call(&unverified, "POST", "/api/organization/invitations/accept", AcceptInvitation, nil, idParam(toOutsider.ID))
+		assert.Equal(t, 403, w.Code, "the email address proves who the invitation is for")
+		w = call(outsider, "POST", "/api/organization/invitations/accept", AcceptInvitation, nil, idParam(toOutsider.ID))
+		assert.Equal(t, 409, w.Code, "users belong to a single organization")
+		w = call(outsider, "DELETE", "/api/organization/invitations", DeclineInvitation, nil, idParam(toOutsider.ID))
+		assert.Equal(t, 204, w.Code)
+		w = call(outsider, "GET", "/api/organization/invitations", ListInvitations, nil)
+		assert.JSONEq(t, "[]", w.Body.String())
+
+		w = call(member, "POST", "/api/organization/invitations", InviteMember, map[string]any{"email": "someone@test.com", "role": "member"})
+		assert.Equal(t, 403, w.Code)
+	})
+
+	t.Run("membership rules", func(t *testing.T) {
+		w = call(owner, "PATCH", "/api/organization/members", UpdateMember, map[string]any{"role": "member"}, userParam(owner))
+		assert.Equal(t, 400, w.Code, "the last owner cannot be demoted")
+
+		w = call(outsider, "PATCH", "/api/organization/members", UpdateMember, map[string]any{"role": "member"}, userParam(member))
+		assert.Equal(t, 404, w.Code, "owners only manage their own organization")
+
+		w = call(owner, "GET", "/api/organization/members", ListMembers, nil)
+		require.Equal(t, 200, w.Code)
+		var members []service.TeamMember
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &members))
+		assert.Len(t, members, 3)
+	})
+
+	spend(owner, travel.ID, 100, 2)
+	spend(manager, travel.ID, 40.5, 3)
+	spend(manager, 0, 9.5, 4)
+	spend(member, travel.ID, 20, 5)
+	spend(outsider, otherTravel.ID, 1000, 5)
+	err := service.CreateExpense(context.Background(), db, &models.Expense{
+		OwnerID: outsider.ID, CategoryID: travel.ID, Title: "Team expense", Date: time.Now(), Amount: 1,
+	})
+	assert.ErrorIs(t, err, service.ErrInvalid, "the categories of other organizations cannot be used")
+
+	t.Run("report", func(t *testing.T) {
+		w := call(member, "GET", "/api/organization/report", GetTeamReport, nil)
+		assert.Equal(t, 403, w.Code)
+
+		w = call(manager, "GET", "/api/organization/report?from=2025-03-03", GetTeamReport, nil)
+		require.Equal(t, 200, w.Code)
+		var report service.TeamReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, 70.0, report.Total)
+		assert.Equal(t, 3, report.Count)
+		require.Len(t, report.Members, 2)
+		assert.Equal(t, manager.ID, report.Members[0].UserID)
+		assert.Equal(t, 50.0, report.Members[0].Total)
+		assert.Len(t, report.Members[0].Categories, 2)
+		assert.Equal(t, member.ID, report.Members[1].UserID)
+		require.Len(t, report.Categories, 2)
+		assert.Equal(t, service.CategorySpend{CategoryName: "", Total: 9.5, Count: 1}, report.Categories[0])
+		assert.Equal(t, service.CategorySpend{CategoryID: travel.ID, CategoryName: "Team Travel", Total: 60.5, Count: 2}, report.Categories[1])
+
+		w = call(manager, "GET", "/api/organization/report?from=March", GetTeamReport, nil)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"from"`)
+	})
+
+	t.Run("leaving keeps history", func(t *testing.T) {
+		w := call(member, "DELETE", "/api/organization/members", RemoveMember, nil, userParam(manager))
+		assert.Equal(t, 403, w.Code)
+
+		w = call(member, "DELETE", "/api/organization/members", RemoveMember, nil, userParam(member))
+		require.Equal(t, 204, w.Code)
+
+		w = call(owner, "GET", "/api/organization/expenses?member="+strconv.Itoa(member.ID), ListTeamExpenses, nil)
+		require.Equal(t, 200, w.Code)
+		var expenses []models.Expense
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expenses))
+		require.Len(t, expenses, 1)
+		assert.Equal(t, models.Amount(20), expenses[0].Amount)
+	})
+}
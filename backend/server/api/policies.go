@@ -0,0 +1,222 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type policyRuleRequest struct {
+	Name       string                   `json:"name" binding:"required,max=255"`
+	Message    string                   `json:"message" binding:"required"`
+	Severity   string                   `json:"severity" binding:"omitempty,oneof=info warning critical" enums:"info,warning,critical"`
+	Enabled    *bool                    `json:"enabled"`
+	Conditions []models.PolicyCondition `json:"conditions" binding:"required,min=1,dive"`
+}
+
+// apply copies the request onto rule. Rules are enabled and of warning
+// severity unless told otherwise.
+func (r *policyRuleRequest) apply(rule *models.PolicyRule) {
+	rule.Name = r.Name
+	rule.Message = r.Message
+	rule.Severity = r.Severity
+	if rule.Severity == "" {
+		rule.Severity = models.SeverityWarning
+	}
+	rule.Enabled = r.Enabled == nil || *r.Enabled
+	rule.Conditions = r.Conditions
+}
+
+type violationsQuery struct {
+	From     string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To       string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Severity string `form:"severity" binding:"omitempty,oneof=info warning critical"`
+}
+
+// ListPolicyRules
+// @Summary List policy rules
+// @Description List the expense policy rules of the administrator's organization. Administrators only.
+// @Tags policies
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.PolicyRule
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /policies [get]
+func ListPolicyRules(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rules, err := service.ListPolicyRules(ctx, db, orgID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("policy rule listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rules)
+}
+
+// CreatePolicyRule
+// @Summary Create a policy rule
+// @Description Create a rule flagging the expenses that match all its conditions. Conditions test a field (amount, distanceKm, days, category, merchant, title, description, type, vehicle, destination, weekday) with an operator (eq, neq, gt, gte, lt, lte for numbers; eq, neq, contains, in, not_in, empty, not_empty for text). Rules apply to the expenses of the administrator's organization created or updated afterwards. Administrators only.
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body policyRuleRequest true "Rule"
+// @Success 201 {object} models.PolicyRule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /policies [post]
+func CreatePolicyRule(ctx *gin.Context) {
+	var req policyRuleRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rule := &models.PolicyRule{OrganizationID: orgID}
+	req.apply(rule)
+	if err := service.CreatePolicyRule(ctx, db, rule); err != nil {
+		log.Ctx(ctx).Err(err).Msg("policy rule creation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, rule)
+}
+
+// UpdatePolicyRule
+// @Summary Update a policy rule
+// @Description Replace a policy rule. Violations already recorded are kept until their expense is updated. Administrators only.
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Rule ID"
+// @Param request body policyRuleRequest true "Rule"
+// @Success 200 {object} models.PolicyRule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /policies/{id} [put]
+func UpdatePolicyRule(ctx *gin.Context) {
+	var req policyRuleRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	ruleID, ok := paramID(ctx, "id", "invalid rule ID")
+	if !ok {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rule := &models.PolicyRule{ID: ruleID, OrganizationID: orgID}
+	req.apply(rule)
+	if err := service.UpdatePolicyRule(ctx, db, rule); err != nil {
+		log.Ctx(ctx).Err(err).Msg("policy rule update error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rule)
+}
+
+// DeletePolicyRule
+// @Summary Delete a policy rule
+// @Description Delete a policy rule and the violations it raised. Administrators only.
+// @Tags policies
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Rule ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /policies/{id} [delete]
+func DeletePolicyRule(ctx *gin.Context) {
+	ruleID, ok := paramID(ctx, "id", "invalid rule ID")
+	if !ok {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.DeletePolicyRule(ctx, db, orgID, ruleID); err != nil {
+		log.Ctx(ctx).Err(err).Msg("policy rule deletion error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetViolationsReport
+// @Summary Policy violations report
+// @Description List the expenses breaking the policy rules of the administrator's organization, with a summary per rule. Administrators only.
+// @Tags policies
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param severity query string false "Only violations of this severity" Enums(info, warning, critical)
+// @Success 200 {object} service.ViolationsReport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /policies/violations [get]
+func GetViolationsReport(ctx *gin.Context) {
+	var query violationsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return
+	}
+
+	filter := service.ViolationFilter{Severity: query.Severity}
+	// the dates were validated by the binding
+	if query.From != "" {
+		filter.From, _ = time.Parse("2006-01-02", query.From)
+	}
+	if query.To != "" {
+		filter.To, _ = time.Parse("2006-01-02", query.To)
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	report, err := service.GetViolationsReport(ctx, db, orgID, filter)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("violations report error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
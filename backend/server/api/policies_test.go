@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestPolicyViolations(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "policy.spender@test.com", FirstName: "Sam", LastName: "Spender"})
+	meals := &models.Category{Name: "Policy Meals"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, meals))
+
+	var ruleIDs []int
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, meals))
+		for _, id := range ruleIDs {
+			require.NoError(t, service.DeletePolicyRule(context.Background(), db, 0, id))
+		}
+	})
+
+	call := func(method, target string, handler gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: target, Payload: payload, Params: params}, handler)
+	}
+	createRule := func(payload map[string]any) models.PolicyRule {
+		w := call("POST", "/api/policies", CreatePolicyRule, payload)
+		require.Equal(t, 201, w.Code, w.Body.String())
+		var rule models.PolicyRule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+		ruleIDs = append(ruleIDs, rule.ID)
+		return rule
+	}
+
+	w := call("POST", "/api/policies", CreatePolicyRule, map[string]any{
+		"name": "Broken rule", "message": "never saved",
+		"conditions": []map[string]any{{"field": "amount", "op": "contains", "value": 3}},
+	})
+	assert.Equal(t, 400, w.Code)
+
+	expensiveMeal := createRule(map[string]any{
+		"name": "Policy test: meals over $75", "message": "Meals are capped at $75", "severity": "critical",
+		"conditions": []map[string]any{
+			{"field": "category", "op": "eq", "value": "Policy Meals"},
+			{"field": "amount", "op": "gt", "value": 75},
+		},
+	})
+	weekend := createRule(map[string]any{
+		"name": "Policy test: weekend", "message": "Weekend spending needs a justification",
+		"conditions": []map[string]any{
+			{"field": "weekday", "op": "in", "value": []string{"saturday", "sunday"}},
+			{"field": "title", "op": "contains", "value": "policy-test"},
+		},
+	})
+	createRule(map[string]any{
+		"name": "Policy test: disabled", "message": "Disabled rules are not evaluated", "enabled": false,
+		"conditions": []map[string]any{{"field": "title", "op": "contains", "value": "policy-test"}},
+	})
+
+	// Saturday 8 March 2025
+	w = call("POST", "/api/expenses", CreateExpense, map[string]any{
+		"title": "policy-test dinner", "amount": 120, "date": "2025-03-08", "categoryId": meals.ID,
+	})
+	require.Equal(t, 201, w.Code)
+	var expense models.Expense
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+	require.Len(t, expense.Violations, 2)
+	assert.Equal(t, expensiveMeal.ID, expense.Violations[0].RuleID)
+	assert.Equal(t, models.SeverityCritical, expense.Violations[0].Severity)
+	assert.Equal(t, weekend.ID, expense.Violations[1].RuleID)
+	assert.Equal(t, models.SeverityWarning, expense.Violations[1].Severity)
+
+	w = call("GET", "/api/expenses", ListExpenses, nil)
+	require.Equal(t, 200, w.Code)
+	var listed []models.Expense
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Len(t, listed[0].Violations, 2)
+
+	t.Run("report", func(t *testing.T) {
+		w := call("GET", "/api/policies/violations?from=2025-03-01&to=2025-03-31&severity=critical", GetViolationsReport, nil)
+		require.Equal(t, 200, w.Code)
+		var report service.ViolationsReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+
+		var flagged []service.FlaggedExpense
+		for _, v := range report.Violations {
+			if v.ExpenseID == expense.ID {
+				flagged = append(flagged, v)
+			}
+		}
+		require.Len(t, flagged, 1, "only critical violations")
+		assert.Equal(t, 120.0, flagged[0].Amount)
+		assert.Equal(t, "Meals are capped at $75", flagged[0].Message)
+
+		var summary *service.RuleViolations
+		for i := range report.Rules {
+			if report.Rules[i].RuleID == expensiveMeal.ID {
+				summary = &report.Rules[i]
+			}
+		}
+		require.NotNil(t, summary)
+		assert.Equal(t, 1, summary.Count)
+		assert.Equal(t, 120.0, summary.Total)
+	})
+
+	t.Run("missing receipt", func(t *testing.T) {
+		for _, condition := range []map[string]any{
+			{"field": "hasReceipt", "op": "gt", "value": false},
+			{"field": "hasReceipt", "op": "eq", "value": "no"},
+		} {
+			w := call("POST", "/api/policies", CreatePolicyRule, map[string]any{
+				"name": "Broken rule", "message": "never saved", "conditions": []map[string]any{condition},
+			})
+			assert.Equal(t, 400, w.Code, condition)
+		}
+		// the title keeps the rule away from the expenses of the other tests
+		missingReceipt := createRule(map[string]any{
+			"name": "Policy test: missing receipt", "message": "Attach the receipt above $25",
+			"conditions": []map[string]any{
+				{"field": "amount", "op": "gt", "value": 25},
+				{"field": "hasReceipt", "op": "eq", "value": false},
+				{"field": "title", "op": "contains", "value": "policy-test taxi"},
+			},
+		})
+		scan := &models.ReceiptScan{UserID: user.ID, FileName: "taxi.txt", ContentType: "text/plain", Content: []byte("TAXI\nTOTAL 40.00\n")}
+		require.NoError(t, service.CreateReceiptScan(context.Background(), db, scan))
+		other := newTestUser(t, db, &models.User{Email: "policy.other@test.com", FirstName: "Olly", LastName: "Other"})
+		otherScan := &models.ReceiptScan{UserID: other.ID, FileName: "taxi.txt", ContentType: "text/plain", Content: []byte("TAXI\n")}
+		require.NoError(t, service.CreateReceiptScan(context.Background(), db, otherScan))
+
+		create := func(amount float64, receiptID int) *httptest.ResponseRecorder {
+			// Monday 10 March 2025
+			return call("POST", "/api/expenses", CreateExpense, map[string]any{
+				"title": "policy-test taxi", "amount": amount, "date": "2025-03-10", "receiptId": receiptID,
+			})
+		}
+		violations := func(w *httptest.ResponseRecorder) []int {
+			require.Equal(t, 201, w.Code, w.Body.String())
+			var expense models.Expense
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+			ids := []int{}
+			for _, violation := range expense.Violations {
+				ids = append(ids, violation.RuleID)
+			}
+			return ids
+		}
+		assert.Equal(t, []int{missingReceipt.ID}, violations(create(40, 0)))
+		assert.Empty(t, violations(create(20, 0)))
+		assert.Empty(t, violations(create(40, scan.ID)))
+		assert.Equal(t, 400, create(40, otherScan.ID).Code, "receipts of other users cannot be attached")
+
+		// deleting the receipt flags the expense again
+		w := call("GET", "/api/expenses", ListExpenses, nil)
+		require.Equal(t, 200, w.Code)
+		var listed []models.ExpenseResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+		var attached *models.ExpenseResponse
+		for i := range listed {
+			if listed[i].ReceiptID == scan.ID {
+				attached = &listed[i]
+			}
+		}
+		require.NotNil(t, attached)
+		require.NoError(t, service.DeleteReceiptScan(context.Background(), db, scan.ID, user.ID))
+		stored, err := service.GetExpense(context.Background(), db, attached.ID, user.ID, service.ExpenseRelations{})
+		require.NoError(t, err)
+		assert.Zero(t, stored.ReceiptID)
+		require.Len(t, stored.Violations, 1)
+		assert.Equal(t, missingReceipt.ID, stored.Violations[0].RuleID)
+	})
+
+	t.Run("update re-evaluates", func(t *testing.T) {
+		w := call("PUT", "/api/expenses", UpdateExpense, map[string]any{
+			"title": "policy-test dinner", "amount": 60, "date": "2025-03-10",
+		}, gin.Param{Key: "id", Value: strconv.Itoa(expense.ID)})
+		require.Equal(t, 200, w.Code)
+
+		stored, err := service.GetExpense(context.Background(), db, expense.ID, user.ID, service.ExpenseRelations{})
+		require.NoError(t, err)
+		assert.Empty(t, stored.Violations)
+	})
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type mileageRateRequest struct {
+	RatePerKm float64 `json:"ratePerKm" binding:"gt=0"`
+}
+
+type perDiemRateRequest struct {
+	DailyRate float64 `json:"dailyRate" binding:"gt=0"`
+	MealRate  float64 `json:"mealRate" binding:"gte=0"`
+}
+
+// ListMileageRates
+// @Summary List mileage rates
+// @Description List the amount reimbursed per kilometre for each vehicle in the user's organization
+// @Tags rates
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.MileageRate
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/mileage [get]
+func ListMileageRates(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rates, err := service.ListMileageRates(ctx, db, orgID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("mileage rate listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rates)
+}
+
+// SetMileageRate
+// @Summary Set a mileage rate
+// @Description Create or replace the rate of a vehicle in the administrator's organization. Existing expenses keep the rate they were computed with. Administrators only.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param vehicle path string true "Vehicle"
+// @Param request body mileageRateRequest true "Rate"
+// @Success 200 {object} models.MileageRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/mileage/{vehicle} [put]
+func SetMileageRate(ctx *gin.Context) {
+	var req mileageRateRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rate := &models.MileageRate{OrganizationID: orgID, Vehicle: ctx.Param("vehicle"), RatePerKm: req.RatePerKm}
+	if err := service.SetMileageRate(ctx, db, rate); err != nil {
+		log.Ctx(ctx).Err(err).Msg("mileage rate update error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+// DeleteMileageRate
+// @Summary Delete a mileage rate
+// @Description Delete the rate of a vehicle. Administrators only.
+// @Tags rates
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param vehicle path string true "Vehicle"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/mileage/{vehicle} [delete]
+func DeleteMileageRate(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.DeleteMileageRate(ctx, db, orgID, ctx.Param("vehicle")); err != nil {
+		log.Ctx(ctx).Err(err).Msg("mileage rate deletion error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListPerDiemRates
+// @Summary List per-diem rates
+// @Description List the daily allowance and meal deduction for each destination in the user's organization
+// @Tags rates
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.PerDiemRate
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/per-diem [get]
+func ListPerDiemRates(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rates, err := service.ListPerDiemRates(ctx, db, orgID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("per-diem rate listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rates)
+}
+
+// SetPerDiemRate
+// @Summary Set a per-diem rate
+// @Description Create or replace the rates of a destination in the administrator's organization. Existing expenses keep the rate they were computed with. Administrators only.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param destination path string true "Destination"
+// @Param request body perDiemRateRequest true "Rates"
+// @Success 200 {object} models.PerDiemRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/per-diem/{destination} [put]
+func SetPerDiemRate(ctx *gin.Context) {
+	var req perDiemRateRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	rate := &models.PerDiemRate{OrganizationID: orgID, Destination: ctx.Param("destination"), DailyRate: req.DailyRate, MealRate: req.MealRate}
+	if err := service.SetPerDiemRate(ctx, db, rate); err != nil {
+		log.Ctx(ctx).Err(err).Msg("per-diem rate update error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+// DeletePerDiemRate
+// @Summary Delete a per-diem rate
+// @Description Delete the rates of a destination. Administrators only.
+// @Tags rates
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param destination path string true "Destination"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/per-diem/{destination} [delete]
+func DeletePerDiemRate(ctx *gin.Context) {
+	orgID, ok := currentOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	if err := service.DeletePerDiemRate(ctx, db, orgID, ctx.Param("destination")); err != nil {
+		log.Ctx(ctx).Err(err).Msg("per-diem rate deletion error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
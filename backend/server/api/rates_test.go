@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestComputedExpenseAmounts(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	admin := newTestUser(t, db, &models.User{Email: "rates.admin@test.com", FirstName: "Ada", LastName: "Admin", IsAdmin: true})
+	traveller := newTestUser(t, db, &models.User{Email: "rates.traveller@test.com", FirstName: "Tom", LastName: "Traveller"})
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteMileageRate(context.Background(), db, 0, "test-van"))
+		require.NoError(t, service.DeletePerDiemRate(context.Background(), db, 0, "Testville"))
+	})
+
+	call := func(user *models.User, method string, handlers []gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: "/api/rates", Payload: payload, Params: params}, handlers...)
+	}
+	idParam := func(id int) gin.Param {
+		return gin.Param{Key: "id", Value: strconv.Itoa(id)}
+	}
+	asAdmin := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return []gin.HandlerFunc{middleware.RequireAdmin(), handler}
+	}
+
+	t.Run("only admins manage rates", func(t *testing.T) {
+		w := call(traveller, "PUT", asAdmin(SetMileageRate), map[string]any{"ratePerKm": 5}, gin.Param{Key: "vehicle", Value: "test-van"})
+		assert.Equal(t, 403, w.Code)
+
+		w = call(admin, "PUT", asAdmin(SetMileageRate), map[string]any{"ratePerKm": 0}, gin.Param{Key: "vehicle", Value: "test-van"})
+		assert.Equal(t, 400, w.Code)
+	})
+
+	w := call(admin, "PUT", asAdmin(SetMileageRate), map[string]any{"ratePerKm": 0.61}, gin.Param{Key: "vehicle", Value: "test-van"})
+	require.Equal(t, 200, w.Code)
+	w = call(admin, "PUT", asAdmin(SetPerDiemRate), map[string]any{"dailyRate": 80, "mealRate": 20.5}, gin.Param{Key: "destination", Value: "Testville"})
+	require.Equal(t, 200, w.Code)
+
+	createExpense := func(payload map[string]any) (*httptest.ResponseRecorder, models.Expense) {
+		payload["title"] = "Trip"
+		payload["date"] = "2025-04-01"
+		w := call(traveller, "POST", []gin.HandlerFunc{CreateExpense}, payload)
+		var expense models.Expense
+		_ = json.Unmarshal(w.Body.Bytes(), &expense)
+		return w, expense
+	}
+
+	t.Run("mileage", func(t *testing.T) {
+		w, expense := createExpense(map[string]any{"type": "mileage", "distanceKm": 123.4, "vehicle": "test-van", "amount": 9999})
+		require.Equal(t, 201, w.Code)
+		assert.Equal(t, models.Amount(75.27), expense.Amount, "the amount sent by the client is ignored")
+		assert.Equal(t, 0.61, expense.Rate)
+
+		w, _ = createExpense(map[string]any{"type": "mileage", "distanceKm": 10, "vehicle": "rocket"})
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), "no mileage rate for vehicle rocket")
+
+		w, _ = createExpense(map[string]any{"type": "mileage", "vehicle": "test-van"})
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"distanceKm"`)
+
+		// a new rate does not change past claims
+		w = call(admin, "PUT", asAdmin(SetMileageRate), map[string]any{"ratePerKm": 0.7}, gin.Param{Key: "vehicle", Value: "test-van"})
+		require.Equal(t, 200, w.Code)
+		stored, err := service.GetExpense(context.Background(), db, expense.ID, traveller.ID, service.ExpenseRelations{})
+		require.NoError(t, err)
+		assert.Equal(t, models.Amount(75.27), stored.Amount)
+
+		// nor the claims edited without changing the distance or vehicle
+		edit := map[string]any{"title": "Client visit", "date": "2025-04-01", "type": "mileage", "distanceKm": 123.4, "vehicle": "test-van"}
+		w = call(traveller, "PUT", []gin.HandlerFunc{UpdateExpense}, edit, idParam(expense.ID))
+		require.Equal(t, 200, w.Code)
+		var edited models.Expense
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &edited))
+		assert.Equal(t, "Client visit", edited.Title)
+		assert.Equal(t, models.Amount(75.27), edited.Amount)
+		assert.Equal(t, 0.61, edited.Rate)
+
+		edit["distanceKm"] = 100
+		w = call(traveller, "PUT", []gin.HandlerFunc{UpdateExpense}, edit, idParam(expense.ID))
+		require.Equal(t, 200, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &edited))
+		assert.Equal(t, models.Amount(70), edited.Amount, "a new distance is priced at the current rate")
+		assert.Equal(t, 0.7, edited.Rate)
+	})
+
+	t.Run("per diem", func(t *testing.T) {
+		w, expense := createExpense(map[string]any{"type": "per_diem", "destination": "Testville", "days": 3, "mealsProvided": 2})
+		require.Equal(t, 201, w.Code)
+		assert.Equal(t, models.Amount(199), expense.Amount)
+		assert.Equal(t, 80.0, expense.Rate)
+
+		w = call(admin, "PUT", asAdmin(SetPerDiemRate), map[string]any{"dailyRate": 90, "mealRate": 25}, gin.Param{Key: "destination", Value: "Testville"})
+		require.Equal(t, 200, w.Code)
+		edit := map[string]any{"title": "Conference", "date": "2025-04-01", "type": "per_diem", "destination": "Testville", "days": 3, "mealsProvided": 2}
+		w = call(traveller, "PUT", []gin.HandlerFunc{UpdateExpense}, edit, idParam(expense.ID))
+		require.Equal(t, 200, w.Code)
+		var edited models.Expense
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &edited))
+		assert.Equal(t, models.Amount(199), edited.Amount, "editing the title keeps the rate of the claim")
+		assert.Equal(t, 80.0, edited.Rate)
+
+		w, _ = createExpense(map[string]any{"type": "per_diem", "destination": "Testville", "days": 1, "mealsProvided": 4})
+		assert.Equal(t, 400, w.Code)
+
+		w, expense = createExpense(map[string]any{"type": "receipt", "amount": 12.5, "destination": "Testville", "days": 2})
+		require.Equal(t, 201, w.Code)
+		assert.Equal(t, models.Amount(12.5), expense.Amount)
+		assert.Empty(t, expense.Destination, "fields of other types are dropped")
+	})
+}
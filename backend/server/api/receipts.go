@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// receiptTypes are the accepted receipt formats, as detected by
+// http.DetectContentType.
+var receiptTypes = map[string]bool{
+	"image/jpeg":                true,
+	"image/png":                 true,
+	"image/webp":                true,
+	"image/bmp":                 true,
+	"image/tiff":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+// receiptContentType returns the type of an uploaded receipt, or "" when it
+// is not supported.
+func receiptContentType(content []byte) string {
+	contentType := http.DetectContentType(content)
+	// TIFF is not detected by the standard library
+	if bytes.HasPrefix(content, []byte("II*\x00")) || bytes.HasPrefix(content, []byte("MM\x00*")) {
+		contentType = "image/tiff"
+	}
+	if !receiptTypes[contentType] {
+		return ""
+	}
+	return strings.TrimSuffix(contentType, "; charset=utf-8")
+}
+
+// UploadReceipt
+// @Summary Upload a receipt
+// @Description Upload a photo (JPEG, PNG, WebP, BMP or TIFF), PDF or text receipt. The receipt is read in the background: poll the returned scan until its status is done or failed, then review the draft and post its expense to /expenses with the receiptId of the scan to attach it.
+// @Tags receipts
+// @Accept multipart/form-data
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param file formData file true "Receipt"
+// @Success 202 {object} models.ReceiptScan
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /receipts [post]
+func UploadReceipt(ctx *gin.Context) {
+	maxSize := config.Current.Receipts.MaxSize
+	tooLarge := middleware.NewHTTPError(http.StatusRequestEntityTooLarge, models.ErrorCodeInvalidRequest, "receipt is too large")
+	// leave room for the multipart headers
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, int64(maxSize)+64<<10)
+
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			middleware.AbortWithError(ctx, tooLarge)
+			return
+		}
+		middleware.AbortWithError(ctx, middleware.BadRequest("file is required"))
+		return
+	}
+	if header.Size > int64(maxSize) {
+		middleware.AbortWithError(ctx, tooLarge)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	contentType := receiptContentType(content)
+	if contentType == "" {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(http.StatusUnsupportedMediaType, models.ErrorCodeInvalidRequest,
+			"receipts must be JPEG, PNG, WebP, BMP or TIFF images, PDFs or text"))
+		return
+	}
+	fileName := filepath.Base(header.Filename)
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	scan := &models.ReceiptScan{UserID: currentUser.ID, FileName: fileName, ContentType: contentType, Content: content}
+	if err := service.CreateReceiptScan(ctx, db, scan); err != nil {
+		log.Ctx(ctx).Err(err).Msg("receipt upload error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, scan)
+}
+
+// ListReceipts
+// @Summary List receipts
+// @Description List the user's 50 latest receipt scans, most recent first
+// @Tags receipts
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.ReceiptScan
+// @Failure 500 {object} models.ErrorResponse
+// @Router /receipts [get]
+func ListReceipts(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	scans, err := service.ListReceiptScans(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("receipt listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, scans)
+}
+
+// GetReceipt
+// @Summary Get a receipt
+// @Description Get a receipt scan. Once its status is done, draft holds the expense read from the receipt with a confidence score from 0 to 1 for each field.
+// @Tags receipts
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Receipt ID"
+// @Success 200 {object} models.ReceiptScan
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /receipts/{id} [get]
+func GetReceipt(ctx *gin.Context) {
+	receiptID, ok := paramID(ctx, "id", "invalid receipt ID")
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	scan, err := service.GetReceiptScan(ctx, db, receiptID, currentUser.ID)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, scan)
+}
+
+// DeleteReceipt
+// @Summary Delete a receipt
+// @Description Delete a receipt scan and the uploaded file. The expenses it was attached to are left without a receipt.
+// @Tags receipts
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Receipt ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /receipts/{id} [delete]
+func DeleteReceipt(ctx *gin.Context) {
+	receiptID, ok := paramID(ctx, "id", "invalid receipt ID")
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if err := service.DeleteReceiptScan(ctx, db, receiptID, currentUser.ID); err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
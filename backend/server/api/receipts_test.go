@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/jobs"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/receipt"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+type failingOCR struct{}
+
+func (failingOCR) Extract(context.Context, string, []byte) (string, error) {
+	return "", errors.New("tesseract: not found")
+}
+
+func TestReceipts(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	user := newTestUser(t, db, &models.User{Email: "receipt.owner@test.com", FirstName: "Rita", LastName: "Receipt"})
+	other := newTestUser(t, db, &models.User{Email: "receipt.other@test.com", FirstName: "Omar", LastName: "Other"})
+	coffee := &models.Category{Name: "Receipt Coffee"}
+	require.NoError(t, service.CreateCategory(context.Background(), db, 0, coffee))
+	merchant := &models.Merchant{Name: "Blue Bottle", DefaultCategoryID: coffee.ID}
+	require.NoError(t, service.CreateMerchant(context.Background(), db, merchant, nil))
+
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteMerchant(context.Background(), db, 0, merchant.ID))
+		require.NoError(t, service.DeleteCategory(context.Background(), db, 0, coffee))
+	})
+
+	call := func(user *models.User, method, target string, handler gin.HandlerFunc, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: target, Params: params}, handler)
+	}
+	upload := func(fileName string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		if content != nil {
+			part, err := form.CreateFormFile("file", fileName)
+			require.NoError(t, err)
+			_, err = part.Write(content)
+			require.NoError(t, err)
+		}
+		require.NoError(t, form.Close())
+
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("POST", "/api/receipts", &body)
+		ctx.Request.Header.Set("Content-Type", form.FormDataContentType())
+		ctx.Set("db", db)
+		ctx.Set("user", user)
+		UploadReceipt(ctx)
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+	get := func(user *models.User, id int) (int, models.ReceiptScan) {
+		w := call(user, "GET", "/api/receipts/x", GetReceipt, gin.Param{Key: "id", Value: strconv.Itoa(id)})
+		var scan models.ReceiptScan
+		if w.Code == 200 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scan))
+		}
+		return w.Code, scan
+	}
+
+	w := upload("coffee.txt", []byte("BLUE BOTTLE COFFEE #12\n2025-03-02 08:15\nLatte 4.50\nTOTAL 4.50\n"))
+	require.Equal(t, 202, w.Code, w.Body.String())
+	var text models.ReceiptScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &text))
+	assert.Equal(t, models.ReceiptScanPending, text.Status)
+	assert.Equal(t, "text/plain", text.ContentType)
+	assert.Equal(t, "coffee.txt", text.FileName)
+	assert.Nil(t, text.Draft)
+
+	w = upload("photo.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	require.Equal(t, 202, w.Code, w.Body.String())
+	var photo models.ReceiptScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &photo))
+	assert.Equal(t, "image/png", photo.ContentType)
+
+	t.Run("rejects other files", func(t *testing.T) {
+		w := upload("archive.zip", []byte("PK\x03\x04\x14\x00\x00\x00"))
+		assert.Equal(t, 415, w.Code)
+		w = upload("", nil)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	scanner := &receipt.Scanner{DB: db, Extractor: &receipt.Local{OCR: failingOCR{}}, Timeout: time.Second}
+	queue := &jobs.Queue{DB: db, Timeout: time.Minute}
+	jobs.Register(queue, models.JobTypeReceiptScan, scanner.Handle)
+	for {
+		ran, err := queue.RunNext(context.Background())
+		require.NoError(t, err)
+		if !ran {
+			break
+		}
+	}
+
+	t.Run("drafts the expense", func(t *testing.T) {
+		code, scan := get(user, text.ID)
+		require.Equal(t, 200, code)
+		assert.Equal(t, models.ReceiptScanDone, scan.Status)
+		require.NotNil(t, scan.Draft)
+		assert.Equal(t, models.ExpenseDraft{
+			Title: "Blue Bottle", Merchant: "Blue Bottle", Date: "2025-03-02", Amount: 4.5, CategoryID: coffee.ID,
+		}, scan.Draft.Expense)
+		assert.Equal(t, models.ReceiptConfidence{Amount: 0.85, Date: 0.9, Merchant: 0.9, Category: 0.7}, scan.Draft.Confidence)
+		assert.NotNil(t, scan.CompletedAt)
+	})
+
+	t.Run("reports unreadable receipts", func(t *testing.T) {
+		code, scan := get(user, photo.ID)
+		require.Equal(t, 200, code)
+		assert.Equal(t, models.ReceiptScanFailed, scan.Status)
+		assert.Equal(t, "the receipt could not be read", scan.Error)
+		assert.Nil(t, scan.Draft)
+	})
+
+	t.Run("lists and deletes the user's receipts", func(t *testing.T) {
+		w := call(user, "GET", "/api/receipts", ListReceipts)
+		require.Equal(t, 200, w.Code)
+		var scans []models.ReceiptScan
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scans))
+		require.Len(t, scans, 2)
+		assert.Equal(t, photo.ID, scans[0].ID)
+		assert.NotContains(t, w.Body.String(), "content\"")
+
+		code, _ := get(other, text.ID)
+		assert.Equal(t, 404, code)
+		w = call(other, "DELETE", "/api/receipts/x", DeleteReceipt, gin.Param{Key: "id", Value: strconv.Itoa(text.ID)})
+		assert.Equal(t, 404, w.Code)
+
+		w = call(user, "DELETE", "/api/receipts/x", DeleteReceipt, gin.Param{Key: "id", Value: strconv.Itoa(text.ID)})
+		assert.Equal(t, 204, w.Code)
+		code, _ = get(user, text.ID)
+		assert.Equal(t, 404, code)
+	})
+}
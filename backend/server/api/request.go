@@ -0,0 +1,30 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+)
+
+// bindJSON binds the request body into obj, writing a validation error
+// response and returning false when the body is invalid.
+func bindJSON(ctx *gin.Context, obj any) bool {
+	if err := ctx.ShouldBindJSON(obj); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return false
+	}
+	return true
+}
+
+// paramID parses the integer path parameter name, writing a 400 response and
+// returning false when it is not a number.
+func paramID(ctx *gin.Context, name, message string) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param(name))
+	if err != nil {
+		middleware.AbortWithError(ctx, middleware.BadRequest(message))
+		return 0, false
+	}
+	return id, true
+}
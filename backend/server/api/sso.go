@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/sso"
+)
+
+type oidcLoginResponse struct {
+	// AuthorizationURL is where the browser must be redirected to sign in.
+	AuthorizationURL string `json:"authorizationUrl"`
+	// State comes back in the callback URL. The frontend should keep it and
+	// check that it matches before calling /auth/oidc/callback.
+	State string `json:"state"`
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// oidcProvider returns the configured provider, answering 404 when single
+// sign-on is disabled.
+func oidcProvider(ctx *gin.Context) (*sso.Provider, bool) {
+	provider := ctx.MustGet("oidc").(*sso.Provider)
+	if provider == nil {
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(http.StatusNotFound, models.ErrorCodeNotFound, "single sign-on is not configured"))
+		return nil, false
+	}
+	return provider, true
+}
+
+func providerUnavailable(err error) error {
+	return &middleware.HTTPError{
+		Status:  http.StatusBadGateway,
+		Code:    models.ErrorCodeInternal,
+		Message: "identity provider unavailable",
+		Err:     err,
+	}
+}
+
+// StartOIDCLogin
+// @Summary Start single sign-on
+// @Description Return the URL of the identity provider to redirect the browser to. The provider sends the user back to the configured redirect URL with a code and the state.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} oidcLoginResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /auth/oidc/login [get]
+func StartOIDCLogin(ctx *gin.Context) {
+	provider, ok := oidcProvider(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*bun.DB)
+
+	login, err := service.StartOIDCLogin(ctx, db, config.Current.OIDC.StateTTL)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("oidc login state error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	url, err := provider.AuthCodeURL(ctx, login.State, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("oidc discovery error")
+		middleware.AbortWithError(ctx, providerUnavailable(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, oidcLoginResponse{AuthorizationURL: url, State: login.State})
+}
+
+// OIDCCallback
+// @Summary Complete single sign-on
+// @Description Exchange the code returned by the identity provider for an access token. Unknown users are linked to the account with the same verified email or provisioned. Users with two-factor authentication receive a challenge token instead.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body oidcCallbackRequest true "Callback parameters"
+// @Success 200 {object} userLoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /auth/oidc/callback [post]
+func OIDCCallback(ctx *gin.Context) {
+	var req oidcCallbackRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+	provider, ok := oidcProvider(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*bun.DB)
+
+	login, err := service.ConsumeOIDCLogin(ctx, db, req.State)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("oidc code exchange error")
+		if errors.Is(err, sso.ErrLoginFailed) {
+			middleware.AbortWithError(ctx, middleware.NewHTTPError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "single sign-on failed"))
+			return
+		}
+		middleware.AbortWithError(ctx, providerUnavailable(err))
+		return
+	}
+
+	entity, err := service.SignInWithIdentity(ctx, db, identity, config.Current.OIDC.Provision)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Str("subject", identity.Subject).Msg("oidc sign in error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	finishLogin(ctx, db, entity)
+}
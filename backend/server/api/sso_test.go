@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/sso"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+const mockClientID = "expense-manager-test"
+
+// mockIdP is a minimal OpenID Connect provider: discovery, JWKS, and a token
+// endpoint that checks the PKCE verifier of the codes it issued.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &mockIdP{key: key, codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize plays the user signing in at the provider: it checks the
+// authorization URL and returns the code sent back to the app.
+func (idp *mockIdP) authorize(t *testing.T, authorizationURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	query := u.Query()
+	require.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, mockClientID, query.Get("client_id"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.NotEmpty(t, query.Get("code_challenge"))
+	require.Contains(t, query.Get("scope"), "openid")
+
+	token := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   mockClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		token[name] = value
+	}
+
+	code, err := utils.GenerateSecureToken(16)
+	require.NoError(t, err)
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = authorization{challenge: query.Get("code_challenge"), claims: token}
+	return code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, auth.claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "unused", "token_type": "Bearer", "expires_in": 60, "id_token": signed,
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	idp := newMockIdP(t)
+	provider := sso.New(config.OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://localhost:3000/auth/oidc/callback",
+	}, idp.Client())
+
+	existing := newTestUser(t, db, &models.User{Email: "sso.existing@test.com", FirstName: "Ex", LastName: "Isting"})
+	protected := newTestUser(t, db, &models.User{Email: "sso.mfa@test.com", FirstName: "Two", LastName: "Factor", TOTPEnabled: true})
+
+	t.Cleanup(func() {
+		_, err := db.NewDelete().Model((*models.User)(nil)).
+			Where("email LIKE 'sso.%@test.com'").
+			Exec(context.Background())
+		require.NoError(t, err)
+	})
+
+	call := func(provider *sso.Provider, method string, handler gin.HandlerFunc, payload any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(payload)
+		ctx.Request = httptest.NewRequest(method, "/api/auth/oidc", bytes.NewBuffer(body))
+		ctx.Set("db", db)
+		ctx.Set("oidc", provider)
+		handler(ctx)
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+	start := func() oidcLoginResponse {
+		w := call(provider, "GET", StartOIDCLogin, nil)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var res oidcLoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+	// login runs the whole flow for a user with claims at the provider.
+	login := func(claims jwt.MapClaims) (*httptest.ResponseRecorder, userLoginResponse) {
+		res := start()
+		code := idp.authorize(t, res.AuthorizationURL, claims)
+		w := call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": res.State})
+		var body userLoginResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body
+	}
+	linkedUser := func(subject string) int {
+		var identity models.UserIdentity
+		require.NoError(t, db.NewSelect().Model(&identity).
+			Where("issuer = ? AND subject = ?", idp.URL, subject).
+			Scan(context.Background()))
+		return identity.UserID
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		w := call(nil, "GET", StartOIDCLogin, nil)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("provisions new users", func(t *testing.T) {
+		w, res := login(jwt.MapClaims{
+			"sub": "new-user", "email": "sso.new@test.com", "email_verified": true,
+			"given_name": "Nova", "family_name": "User",
+		})
+		require.Equal(t, 200, w.Code, w.Body.String())
+		assert.NotEmpty(t, res.Token)
+
+		user, err := service.GetUserByEmail(context.Background(), db, "sso.new@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, "Nova", user.FirstName)
+		assert.Equal(t, "User", user.LastName)
+		assert.True(t, user.IsEmailVerified())
+		assert.Equal(t, user.ID, linkedUser("new-user"))
+
+		// the subject identifies the user even if their email changes
+		w, _ = login(jwt.MapClaims{"sub": "new-user", "email": "sso.renamed@test.com", "email_verified": true})
+		require.Equal(t, 200, w.Code)
+		assert.Equal(t, user.ID, linkedUser("new-user"))
+	})
+
+	t.Run("links existing users by verified email", func(t *testing.T) {
+		w, _ := login(jwt.MapClaims{"sub": "unverified", "email": existing.Email, "email_verified": false})
+		assert.Equal(t, 403, w.Code)
+
+		w, res := login(jwt.MapClaims{"sub": "existing", "email": existing.Email, "email_verified": true})
+		require.Equal(t, 200, w.Code, w.Body.String())
+		assert.NotEmpty(t, res.Token)
+		assert.Equal(t, existing.ID, linkedUser("existing"))
+
+		user, err := service.GetUserById(context.Background(), db, existing.ID)
+		require.NoError(t, err)
+		assert.True(t, user.IsEmailVerified())
+	})
+
+	t.Run("provisioning can be disabled", func(t *testing.T) {
+		_, err := service.SignInWithIdentity(context.Background(), db, &service.ExternalIdentity{
+			Issuer: idp.URL, Subject: "stranger", Email: "sso.stranger@test.com", EmailVerified: true,
+		}, false)
+		assert.ErrorIs(t, err, service.ErrForbidden)
+	})
+
+	t.Run("two-factor users get a challenge", func(t *testing.T) {
+		w, res := login(jwt.MapClaims{"sub": "mfa", "email": protected.Email, "email_verified": true})
+		require.Equal(t, 200, w.Code)
+		assert.Empty(t, res.Token)
+		assert.True(t, res.MFARequired)
+		assert.NotEmpty(t, res.ChallengeToken)
+	})
+
+	t.Run("rejects replayed and forged callbacks", func(t *testing.T) {
+		res := start()
+		code := idp.authorize(t, res.AuthorizationURL, jwt.MapClaims{"sub": "replay", "email": "sso.replay@test.com", "email_verified": true})
+		w := call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": res.State})
+		require.Equal(t, 200, w.Code)
+		w = call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": res.State})
+		assert.Equal(t, 400, w.Code, "state is single use")
+
+		w = call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": "forged"})
+		assert.Equal(t, 400, w.Code)
+
+		// a code obtained in another attempt fails the PKCE check
+		first, second := start(), start()
+		code = idp.authorize(t, first.AuthorizationURL, jwt.MapClaims{"sub": "pkce", "email": "sso.pkce@test.com", "email_verified": true})
+		w = call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": second.State})
+		assert.Equal(t, 401, w.Code)
+		w = call(provider, "POST", OIDCCallback, map[string]string{"code": "unknown", "state": first.State})
+		assert.Equal(t, 401, w.Code)
+
+		// an ID token issued for another login attempt fails the nonce check
+		res = start()
+		code = idp.authorize(t, res.AuthorizationURL, jwt.MapClaims{"sub": "nonce", "nonce": "stolen", "email": "sso.nonce@test.com", "email_verified": true})
+		w = call(provider, "POST", OIDCCallback, map[string]string{"code": code, "state": res.State})
+		assert.Equal(t, 401, w.Code)
+
+		_, err := service.GetUserByEmail(context.Background(), db, "sso.pkce@test.com")
+		assert.ErrorIs(t, err, service.ErrNotFound)
+	})
+}
@@ -1,44 +1,293 @@
 package api
 
 import (
-	"github.com/Spiria-Digital/expense-manager/server/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
 )
 
-type userResponse struct {
-	ID        int    `json:"id"`
-	Email     string `json:"email"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+// accountDeletionTTL is how long the user has to confirm the deletion of
+// their account after downloading their data.
+const accountDeletionTTL = 15 * time.Minute
+
+type updateProfileRequest struct {
+	FirstName       *string `json:"firstName" binding:"omitempty,min=1,max=255"`
+	LastName        *string `json:"lastName" binding:"omitempty,min=1,max=255"`
+	DefaultCurrency *string `json:"defaultCurrency" binding:"omitempty,iso4217"`
+	Locale          *string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+type passwordConfirmationRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type accountDeletionResponse struct {
+	Export            *service.AccountExport `json:"export"`
+	ConfirmationToken string                 `json:"confirmationToken"`
+	ExpiresAt         time.Time              `json:"expiresAt"`
+}
+
+type deleteAccountRequest struct {
+	ConfirmationToken string `json:"confirmationToken" binding:"required"`
 }
 
 // ListUsers
 // @Summary List users
-// @Description List users
+// @Description List the members of the authenticated user's organization, or only the user when they do not belong to one
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Success 200 {array} models.OutgoingUser
+// @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users [get]
 func ListUsers(ctx *gin.Context) {
 	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
 
-	users, err := service.ListUsers(ctx, db)
+	users, err := service.ListUsers(ctx, db, currentUser.ID)
 	if err != nil {
-		log.Err(err).Msg("failed to list users")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "failed to list users",
-		})
+		log.Ctx(ctx).Err(err).Msg("failed to list users")
+		middleware.AbortWithError(ctx, err)
 		return
 	}
 
 	ctx.JSON(200, users)
 }
+
+// GetCurrentUser
+// @Summary Current user
+// @Description Get the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.UserProfile
+// @Failure 401 {object} models.ErrorResponse
+// @Router /users/me [get]
+func GetCurrentUser(ctx *gin.Context) {
+	currentUser := ctx.MustGet("user").(*models.User)
+	ctx.JSON(http.StatusOK, currentUser.Profile())
+}
+
+// UpdateCurrentUser
+// @Summary Update the current user
+// @Description Update the names, default currency or locale of the authenticated user. Omitted fields are left unchanged.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param profile body updateProfileRequest true "Fields to update"
+// @Success 200 {object} models.UserProfile
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me [patch]
+func UpdateCurrentUser(ctx *gin.Context) {
+	var req updateProfileRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	var columns []string
+	if req.FirstName != nil {
+		currentUser.FirstName = *req.FirstName
+		columns = append(columns, "first_name")
+	}
+	if req.LastName != nil {
+		currentUser.LastName = *req.LastName
+		columns = append(columns, "last_name")
+	}
+	if req.DefaultCurrency != nil {
+		currentUser.DefaultCurrency = *req.DefaultCurrency
+		columns = append(columns, "default_currency")
+	}
+	if req.Locale != nil {
+		currentUser.Locale = *req.Locale
+		columns = append(columns, "locale")
+	}
+
+	if len(columns) > 0 {
+		if err := service.UpdateUser(ctx, db, currentUser, columns...); err != nil {
+			log.Ctx(ctx).Err(err).Msg("failed to update user")
+			middleware.AbortWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, currentUser.Profile())
+}
+
+// ChangePassword
+// @Summary Change password
+// @Description Change the password of the authenticated user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body changePasswordRequest true "Current and new password"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/password [post]
+func ChangePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if !checkCurrentPassword(ctx, db, currentUser, req.CurrentPassword) {
+		return
+	}
+
+	hashedPw, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("password hashing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	currentUser.Password = hashedPw
+	if err := service.UpdateUser(ctx, db, currentUser, "password"); err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to update password")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RequestAccountDeletion
+// @Summary Export data before deleting the account
+// @Description First step of the account deletion: returns all the data of the authenticated user and a short-lived token to confirm the deletion with DELETE /users/me
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body passwordConfirmationRequest true "Current password"
+// @Success 200 {object} accountDeletionResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/deletion [post]
+func RequestAccountDeletion(ctx *gin.Context) {
+	var req passwordConfirmationRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if !checkCurrentPassword(ctx, db, currentUser, req.Password) {
+		return
+	}
+
+	export, err := service.ExportAccount(ctx, db, currentUser)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to export account")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	token, err := service.IssueUserToken(ctx, db, currentUser.ID, models.TokenPurposeAccountDeletion, accountDeletionTTL)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to issue deletion token")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, accountDeletionResponse{
+		Export:            export,
+		ConfirmationToken: token,
+		ExpiresAt:         time.Now().UTC().Add(accountDeletionTTL),
+	})
+}
+
+// ExportCurrentUser
+// @Summary Download all the data of the current user
+// @Description Download a zip archive of everything stored about the authenticated user: account.json holds the profile, expenses, their categories, receipts, API keys, webhooks, linked identities, organization membership and audit events, expenses.csv lists the expenses and receipts/ holds the uploaded files. The export is recorded in the audit events.
+// @Tags users
+// @Produce application/zip
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {file} file
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/export [get]
+func ExportCurrentUser(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	export, err := service.ExportAccount(ctx, db, currentUser)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to export account")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	event := &models.AuditEvent{UserID: currentUser.ID, Action: models.AuditAccountExported, Actor: models.AuditActorUser}
+	if err := service.RecordAuditEvent(ctx, db, event); err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to record the export")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	fileName := "expense-manager-export-" + export.ExportedAt.Format("2006-01-02") + ".zip"
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	ctx.Status(http.StatusOK)
+	if err := service.WriteAccountArchive(ctx, db, export, ctx.Writer); err != nil {
+		// the archive is already partly sent, the client gets a corrupt file
+		log.Ctx(ctx).Err(err).Msg("failed to write the account archive")
+	}
+}
+
+// DeleteCurrentUser
+// @Summary Delete the current user
+// @Description Permanently delete the authenticated user and all their expenses, using the token returned by POST /users/me/deletion. The owner of an organization must transfer the ownership first, unless they are its last member.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body deleteAccountRequest true "Deletion confirmation token"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me [delete]
+func DeleteCurrentUser(ctx *gin.Context) {
+	var req deleteAccountRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	if err := service.DeleteAccount(ctx, db, currentUser.ID, req.ConfirmationToken); err != nil {
+		log.Ctx(ctx).Err(err).Msg("failed to delete account")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
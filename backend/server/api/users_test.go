@@ -1,75 +1,230 @@
 package api
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/json"
-	"github.com/Spiria-Digital/expense-manager/server/middleware"
-	"github.com/Spiria-Digital/expense-manager/server/models"
-	"github.com/Spiria-Digital/expense-manager/server/service"
-	"github.com/Spiria-Digital/expense-manager/server/storage"
-	"github.com/Spiria-Digital/expense-manager/server/utils"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"net/http/httptest"
-	"path/filepath"
-	"testing"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
 )
 
 func TestUserEndpoints(t *testing.T) {
 	t.Parallel()
 
-	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
-	db, err := storage.NewBunDB(filePath)
-	require.NoError(t, err)
+	db := openTestDB(t)
 
 	hashedPassword, err := utils.HashPassword("EarthIsFlat#123")
 	require.NoError(t, err)
-	user := &models.User{
+	user := newTestUser(t, db, &models.User{
 		Email:     "flatearth.1@space.com",
 		Password:  hashedPassword,
 		FirstName: "Flattie",
 		LastName:  "Earther",
+	})
+	teammate := newTestUser(t, db, &models.User{Email: "flatearth.2@space.com", Password: hashedPassword, FirstName: "Tina", LastName: "Teammate"})
+	// never listed
+	newTestUser(t, db, &models.User{Email: "roundearth.1@space.com", Password: hashedPassword, FirstName: "Sam", LastName: "Stranger"})
+	org := &models.Organization{Name: "Flat Earth Society"}
+
+	t.Cleanup(func() {
+		_, err := db.NewDelete().Model(org).WherePK().Exec(context.Background())
+		require.NoError(t, err)
+	})
+
+	list := func() []models.OutgoingUser {
+		w := callHandler(db, testRequest{User: user, Target: "/api/users"}, ListUsers)
+		require.Equal(t, 200, w.Code)
+		assert.NotContains(t, w.Body.String(), "password", "password field should not be returned")
+		var users []models.OutgoingUser
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+		return users
 	}
+	names := func(users []models.OutgoingUser) []string {
+		var names []string
+		for _, u := range users {
+			names = append(names, u.FirstName)
+		}
+		return names
+	}
+
+	t.Run("lists only the user without an organization", func(t *testing.T) {
+		assert.Equal(t, []string{"Flattie"}, names(list()))
+	})
+
+	t.Run("lists the members of the user's organization", func(t *testing.T) {
+		_, err := service.CreateOrganization(context.Background(), db, org, user.ID)
+		require.NoError(t, err)
+		_, err = db.NewInsert().Model(&models.OrganizationMember{OrganizationID: org.ID, UserID: teammate.ID, Role: models.RoleMember}).Exec(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Flattie", "Tina"}, names(list()))
+	})
+}
+
+func TestCurrentUserEndpoints(t *testing.T) {
+	t.Parallel()
 
-	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	db := openTestDB(t)
 
-	token, err := middleware.GenerateToken(user.ID)
+	hashedPassword, err := utils.HashPassword("RoundEarth#1")
 	require.NoError(t, err)
+	// the account is normally deleted by the test itself
+	user := newTestUser(t, db, &models.User{
+		Email:     "me.myself@space.com",
+		Password:  hashedPassword,
+		FirstName: "Me",
+		LastName:  "Myself",
+	})
+	var lastEventID int
+	require.NoError(t, db.NewSelect().Model((*models.AuditEvent)(nil)).ColumnExpr("coalesce(max(id), 0)").Scan(context.Background(), &lastEventID))
 
 	t.Cleanup(func() {
-		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
-		require.NoError(t, db.Close())
+		// its events are kept, anonymized
+		_, err := db.NewDelete().Model((*models.AuditEvent)(nil)).Where("id > ? AND user_id IS NULL", lastEventID).Exec(context.Background())
+		require.NoError(t, err)
 	})
 
-	t.Run("create and list users", func(t *testing.T) {
-		t.Parallel()
+	// call runs handler as the current user, reloaded like JWTMiddleware does
+	call := func(method string, handler gin.HandlerFunc, payload any) *httptest.ResponseRecorder {
+		current, err := service.GetUserById(context.Background(), db, user.ID)
+		require.NoError(t, err)
 
-		// List users
-		w := httptest.NewRecorder()
-		ctx, _ := gin.CreateTestContext(w)
-		ctx.Set("db", db)
-		ctx.Request = httptest.NewRequest("GET", "/api/users", nil)
-		ctx.Request.Header.Set("Authorization", "Bearer "+token)
-		ListUsers(ctx)
+		return callHandler(db, testRequest{User: current, Method: method, Target: "/api/users/me", Payload: payload}, handler)
+	}
 
+	t.Run("profile", func(t *testing.T) {
+		w := call("GET", GetCurrentUser, nil)
 		require.Equal(t, 200, w.Code)
-		var users []map[string]interface{}
-		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
-		assert.GreaterOrEqual(t, len(users), 1)
+		var profile models.UserProfile
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		assert.Equal(t, user.ID, profile.ID)
+		assert.Equal(t, "me.myself@space.com", profile.Email)
+		assert.Equal(t, "USD", profile.DefaultCurrency)
+		assert.Equal(t, "en-US", profile.Locale)
+		assert.NotContains(t, w.Body.String(), "assword")
 
-		// check if the user is in the list
-		exists := false
-		for _, u := range users {
-			lastName := u["lastName"].(string)
-			firstName := u["firstName"].(string)
-			if lastName == user.LastName && firstName == user.FirstName {
-				exists = true
-			}
-			// check that password is not returned
-			_, ok := u["password"]
-			assert.False(t, ok, "password field should not be returned")
+		w = call("PATCH", UpdateCurrentUser, map[string]any{"defaultCurrency": "dollars", "locale": "not a locale"})
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"defaultCurrency"`)
+		assert.Contains(t, w.Body.String(), `"field":"locale"`)
+
+		w = call("PATCH", UpdateCurrentUser, map[string]any{"firstName": "Myself", "defaultCurrency": "CAD", "locale": "fr-CA"})
+		require.Equal(t, 200, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		assert.Equal(t, "Myself", profile.FirstName)
+		assert.Equal(t, "Myself", profile.LastName, "omitted fields are unchanged")
+		assert.Equal(t, "CAD", profile.DefaultCurrency)
+		assert.Equal(t, "fr-CA", profile.Locale)
+
+		stored, err := service.GetUserById(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "CAD", stored.DefaultCurrency)
+		assert.Equal(t, hashedPassword, stored.Password)
+	})
+
+	t.Run("change password", func(t *testing.T) {
+		w := call("POST", ChangePassword, map[string]any{"currentPassword": "wrong", "newPassword": "FlatEarth#2"})
+		assert.Equal(t, 401, w.Code)
+
+		w = call("POST", ChangePassword, map[string]any{"currentPassword": "RoundEarth#1", "newPassword": "FlatEarth#2"})
+		require.Equal(t, 204, w.Code)
+
+		stored, err := service.GetUserById(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		assert.True(t, utils.CheckPasswordHash("FlatEarth#2", stored.Password))
+	})
+
+	t.Run("wrong passwords lock the account", func(t *testing.T) {
+		threshold := config.Current.Security.LockoutThreshold
+		// the wrong password given to change it counts as well
+		for i := 1; i < threshold; i++ {
+			assert.Equal(t, 401, call("POST", RequestAccountDeletion, map[string]any{"password": "guessed"}).Code)
 		}
-		require.True(t, exists, "user not found in the list")
+		w := call("POST", ChangePassword, map[string]any{"currentPassword": "FlatEarth#2", "newPassword": "Guessed#3"})
+		assert.Equal(t, 429, w.Code)
+		assert.Contains(t, w.Body.String(), models.ErrorCodeAccountLocked)
+		assert.Equal(t, 429, call("POST", RequestAccountDeletion, map[string]any{"password": "FlatEarth#2"}).Code)
+
+		locked, err := service.GetUserById(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, threshold, locked.FailedLoginAttempts)
+		assert.True(t, utils.CheckPasswordHash("FlatEarth#2", locked.Password))
+
+		_, err = db.NewUpdate().Model(locked).
+			Set("failed_login_attempts = 0").
+			Set("locked_until = NULL").
+			WherePK().
+			Exec(context.Background())
+		require.NoError(t, err)
+	})
+
+	t.Run("export account", func(t *testing.T) {
+		w := call("GET", ExportCurrentUser, nil)
+		require.Equal(t, 200, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		assert.Equal(t, []string{"account.json", "expenses.csv"}, names)
+
+		events, err := service.ListAuditEvents(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, models.AuditAccountExported, events[0].Action)
+		assert.Equal(t, models.AuditActorUser, events[0].Actor)
+	})
+
+	t.Run("delete account", func(t *testing.T) {
+		expense := &models.Expense{
+			OwnerID: user.ID,
+			Title:   "Telescope",
+			Date:    time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			Amount:  499.99,
+		}
+		require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+
+		w := call("POST", RequestAccountDeletion, map[string]any{"password": "wrong"})
+		assert.Equal(t, 401, w.Code)
+
+		w = call("POST", RequestAccountDeletion, map[string]any{"password": "FlatEarth#2"})
+		require.Equal(t, 200, w.Code)
+		var deletion accountDeletionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deletion))
+		assert.Equal(t, user.ID, deletion.Export.Profile.ID)
+		require.Len(t, deletion.Export.Expenses, 1)
+		assert.Equal(t, "Telescope", deletion.Export.Expenses[0].Title)
+		require.NotEmpty(t, deletion.ConfirmationToken)
+
+		w = call("DELETE", DeleteCurrentUser, map[string]any{"confirmationToken": "guessed"})
+		assert.Equal(t, 400, w.Code)
+
+		w = call("DELETE", DeleteCurrentUser, map[string]any{"confirmationToken": deletion.ConfirmationToken})
+		require.Equal(t, 204, w.Code)
+
+		_, err := service.GetUserById(context.Background(), db, user.ID)
+		assert.ErrorIs(t, err, service.ErrNotFound)
+		_, err = service.GetExpense(context.Background(), db, expense.ID, user.ID, service.ExpenseRelations{})
+		assert.ErrorIs(t, err, service.ErrNotFound, "expenses are removed with the account")
+
+		var erased models.AuditEvent
+		require.NoError(t, db.NewSelect().Model(&erased).Where("id > ?", lastEventID).Where("action = ?", models.AuditAccountErased).Scan(context.Background()))
+		assert.Equal(t, models.AuditActorUser, erased.Actor)
+		assert.Equal(t, strconv.Itoa(user.ID), erased.Details["userId"])
 	})
 }
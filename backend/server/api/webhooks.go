@@ -0,0 +1,180 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+	"github.com/Spiria-Digital/expense-manager/server/webhook"
+)
+
+type createWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,http_url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=expense.created expense.updated expense.deleted"`
+	// Organization subscribes to the expenses of the whole organization
+	// instead of the user's own. Only owners and managers can do so.
+	Organization bool `json:"organization"`
+}
+
+type createWebhookResponse struct {
+	Webhook *models.WebhookSubscription `json:"webhook"`
+	// Secret signs the payloads. It is only returned once.
+	Secret string `json:"secret"`
+}
+
+type deliveriesQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// CreateWebhook
+// @Summary Subscribe to expense events
+// @Description Register a URL that receives a signed POST when an expense is created, updated or deleted. The URL must resolve to public addresses. See the README for the signature scheme.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body createWebhookRequest true "Subscription"
+// @Success 201 {object} createWebhookResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [post]
+func CreateWebhook(ctx *gin.Context) {
+	var req createWebhookRequest
+	if !bindJSON(ctx, &req) {
+		return
+	}
+
+	if err := webhook.CheckURL(ctx, req.URL); err != nil {
+		log.Ctx(ctx).Info().Err(err).Msg("webhook URL rejected")
+		middleware.AbortWithError(ctx, middleware.NewHTTPError(
+			http.StatusBadRequest, models.ErrorCodeValidation, "url must resolve to public addresses only"))
+		return
+	}
+
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+	subscription := &models.WebhookSubscription{UserID: currentUser.ID, URL: req.URL, Events: req.Events}
+	if req.Organization {
+		member, ok := currentMembership(ctx, (*models.OrganizationMember).CanViewTeam)
+		if !ok {
+			return
+		}
+		subscription.OrganizationID = member.OrganizationID
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	if subscription.Secret, err = utils.Encrypt(config.Current.EncryptionKey, secret); err != nil {
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+
+	if err := service.CreateWebhook(ctx, db, subscription); err != nil {
+		log.Ctx(ctx).Err(err).Msg("webhook creation error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, createWebhookResponse{Webhook: subscription, Secret: secret})
+}
+
+// ListWebhooks
+// @Summary List webhooks
+// @Description List the webhook subscriptions of the current user
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} models.WebhookSubscription
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [get]
+func ListWebhooks(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	subscriptions, err := service.ListWebhooks(ctx, db, currentUser.ID)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("webhook listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+// DeleteWebhook
+// @Summary Delete a webhook
+// @Description Delete a webhook subscription and its delivery log
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(ctx *gin.Context) {
+	webhookID, ok := paramID(ctx, "id", "invalid webhook ID")
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	if err := service.DeleteWebhook(ctx, db, webhookID, currentUser.ID); err != nil {
+		log.Ctx(ctx).Err(err).Msg("webhook deletion error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries
+// @Summary Webhook delivery log
+// @Description List the latest deliveries of a webhook with their status, attempts and last error
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "Number of deliveries, 50 by default"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func ListWebhookDeliveries(ctx *gin.Context) {
+	var query deliveriesQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		middleware.AbortWithError(ctx, middleware.ValidationError(err))
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	webhookID, ok := paramID(ctx, "id", "invalid webhook ID")
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*bun.DB)
+	currentUser := ctx.MustGet("user").(*models.User)
+
+	deliveries, err := service.ListWebhookDeliveries(ctx, db, webhookID, currentUser.ID, query.Limit)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("webhook delivery listing error")
+		middleware.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+func TestWebhookEndpoints(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+
+	owner := newTestUser(t, db, &models.User{Email: "webhooks.owner@test.com", FirstName: "Olga", LastName: "Owner"})
+	member := newTestUser(t, db, &models.User{Email: "webhooks.member@test.com", FirstName: "Mo", LastName: "Member"})
+
+	org := &models.Organization{Name: "Webhooks Inc"}
+	_, err := service.CreateOrganization(context.Background(), db, org, owner.ID)
+	require.NoError(t, err)
+	invitation, err := service.InviteMember(context.Background(), db, org.ID, owner.ID, member.Email, models.RoleMember, time.Hour)
+	require.NoError(t, err)
+	_, err = service.AcceptInvitation(context.Background(), db, invitation.ID, member)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := db.NewDelete().Model(org).WherePK().Exec(context.Background())
+		require.NoError(t, err)
+	})
+
+	call := func(user *models.User, method, target string, handler gin.HandlerFunc, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+		return callHandler(db, testRequest{User: user, Method: method, Target: target, Payload: payload, Params: params}, handler)
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		w := call(owner, "POST", "/api/webhooks", CreateWebhook, map[string]any{"url": "not a url", "events": []string{"expense.created"}})
+		assert.Equal(t, 400, w.Code)
+
+		w = call(owner, "POST", "/api/webhooks", CreateWebhook, map[string]any{"url": "https://example.com/hook", "events": []string{"expense.approved"}})
+		assert.Equal(t, 400, w.Code)
+
+		w = call(owner, "POST", "/api/webhooks", CreateWebhook, map[string]any{"url": "https://example.com/hook", "events": []string{}})
+		assert.Equal(t, 400, w.Code)
+
+		for _, url := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "https://intranet.example.com/hook"} {
+			w = call(owner, "POST", "/api/webhooks", CreateWebhook, map[string]any{"url": url, "events": []string{"expense.created"}})
+			assert.Equal(t, 400, w.Code, "%s is not public", url)
+		}
+	})
+
+	t.Run("members cannot subscribe to the organization", func(t *testing.T) {
+		w := call(member, "POST", "/api/webhooks", CreateWebhook, map[string]any{
+			"url": "https://example.com/hook", "events": []string{"expense.created"}, "organization": true,
+		})
+		assert.Equal(t, 403, w.Code)
+	})
+
+	w := call(owner, "POST", "/api/webhooks", CreateWebhook, map[string]any{
+		"url": "https://example.com/hook", "events": []string{"expense.created", "expense.deleted"}, "organization": true,
+	})
+	require.Equal(t, 201, w.Code)
+	var created createWebhookResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, org.ID, created.Webhook.OrganizationID)
+	assert.True(t, created.Webhook.Active)
+	assert.NotEmpty(t, created.Secret)
+	id := gin.Param{Key: "id", Value: strconv.Itoa(created.Webhook.ID)}
+
+	t.Run("secret is stored encrypted and never listed", func(t *testing.T) {
+		var stored models.WebhookSubscription
+		require.NoError(t, db.NewSelect().Model(&stored).Where("id = ?", created.Webhook.ID).Scan(context.Background()))
+		assert.NotEqual(t, created.Secret, stored.Secret)
+		secret, err := utils.Decrypt(config.Current.EncryptionKey, stored.Secret)
+		require.NoError(t, err)
+		assert.Equal(t, created.Secret, secret)
+
+		w := call(owner, "GET", "/api/webhooks", ListWebhooks, nil)
+		require.Equal(t, 200, w.Code)
+		assert.NotContains(t, w.Body.String(), created.Secret)
+		var list []models.WebhookSubscription
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list, 1)
+		assert.Equal(t, []string{"expense.created", "expense.deleted"}, list[0].Events)
+
+		w = call(member, "GET", "/api/webhooks", ListWebhooks, nil)
+		require.Equal(t, 200, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+
+	t.Run("delivery log", func(t *testing.T) {
+		w := call(owner, "GET", "/api/webhooks/1/deliveries", ListWebhookDeliveries, nil, id)
+		require.Equal(t, 200, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+
+		w = call(owner, "GET", "/api/webhooks/1/deliveries?limit=500", ListWebhookDeliveries, nil, id)
+		assert.Equal(t, 400, w.Code)
+
+		w = call(member, "GET", "/api/webhooks/1/deliveries", ListWebhookDeliveries, nil, id)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("demoted users lose organization webhooks", func(t *testing.T) {
+		w := call(member, "DELETE", "/api/webhooks/1", DeleteWebhook, nil, id)
+		assert.Equal(t, 404, w.Code)
+
+		_, err := service.UpdateMemberRole(context.Background(), db, org.ID, member.ID, models.RoleOwner)
+		require.NoError(t, err)
+		_, err = service.UpdateMemberRole(context.Background(), db, org.ID, owner.ID, models.RoleMember)
+		require.NoError(t, err)
+
+		list, err := service.ListWebhooks(context.Background(), db, owner.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.False(t, list[0].Active)
+
+		w = call(owner, "DELETE", "/api/webhooks/1", DeleteWebhook, nil, id)
+		assert.Equal(t, 204, w.Code)
+		w = call(owner, "GET", "/api/webhooks", ListWebhooks, nil)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+}
@@ -2,24 +2,36 @@ package server
 
 import (
 	"github.com/Spiria-Digital/expense-manager/server/api"
+	"github.com/Spiria-Digital/expense-manager/server/config"
 	"github.com/Spiria-Digital/expense-manager/server/docs"
 	"github.com/Spiria-Digital/expense-manager/server/middleware"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"time"
 )
 
-var Router = gin.Default()
+var Router = gin.New()
 
 func init() {
+	if err := Router.SetTrustedProxies(config.Current.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("invalid trusted proxies")
+	}
+	// pass the request context, and its trace, to the services
+	Router.ContextWithFallback = true
+	Router.Use(telemetry.Middleware(), middleware.RequestLogger(log.Logger), middleware.Recovery(), middleware.ErrorHandler())
+	Router.NoRoute(middleware.NotFound)
+	Router.GET("/metrics", telemetry.MetricsHandler(config.Current.Telemetry.MetricsToken))
+
 	apiGroup := Router.Group("/api")
 	corsConfig := cors.Config{
 		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Content-Length"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Authorization", middleware.APIKeyHeader, "Content-Type", "Content-Length", "Last-Event-ID", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           24 * time.Hour,
 	}
@@ -27,28 +39,67 @@ func init() {
 	docs.SwaggerInfo.BasePath = "/api"
 	apiGroup.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	apiGroup.GET("/status", func(context *gin.Context) {
-		context.JSON(200, gin.H{
-			"status": "ok",
-		})
-	})
+	apiGroup.GET("/health/live", api.Liveness)
 
-	// inject database
+	// inject database, mailer and identity provider
 	apiGroup.Use(func(context *gin.Context) {
 		context.Set("db", BunDB)
+		context.Set("mailer", Mailer)
+		context.Set("oidc", OIDCProvider)
 		context.Next()
 	})
 
+	apiGroup.GET("/health/ready", api.Readiness)
+	// kept for the clients polling it before the readiness probe existed
+	apiGroup.GET("/status", api.Readiness)
+
+	security := config.Current.Security
+	rateLimits := middleware.NewMemoryRateLimitStore()
+	accountLimit := middleware.RateLimit(rateLimits,
+		middleware.Rate{Burst: security.LoginAccountBurst, Interval: security.LoginAccountInterval},
+		middleware.EmailKey("auth"))
+
 	auth := apiGroup.Group("/auth")
 	{
-		auth.POST("/login", api.UserLogin)
+		auth.Use(middleware.RateLimit(rateLimits,
+			middleware.Rate{Burst: security.AuthIPBurst, Interval: security.AuthIPInterval},
+			middleware.ClientIPKey("auth")))
+		auth.POST("/login", accountLimit, api.UserLogin)
+		auth.POST("/login/2fa", api.UserLoginMFA)
 		auth.POST("/register", api.UserRegistration)
+		auth.POST("/verify-email/request", accountLimit, api.RequestEmailVerification)
+		auth.POST("/verify-email/confirm", api.ConfirmEmailVerification)
+		auth.POST("/password-reset/request", accountLimit, api.RequestPasswordReset)
+		auth.POST("/password-reset/confirm", api.ConfirmPasswordReset)
+		auth.GET("/oidc/login", api.StartOIDCLogin)
+		auth.POST("/oidc/callback", api.OIDCCallback)
+
+		mfa := auth.Group("/2fa")
+		mfa.Use(middleware.JWTMiddleware(), middleware.RequireSession())
+		mfa.GET("", api.GetMFAStatus)
+		mfa.POST("/enroll", api.EnrollMFA)
+		mfa.POST("/activate", api.ActivateMFA)
+		mfa.POST("/disable", api.DisableMFA)
 	}
 
 	user := apiGroup.Group("/users")
 	{
-		user.GET("/", api.ListUsers)
 		user.Use(middleware.JWTMiddleware())
+		user.GET("/", api.ListUsers)
+		user.GET("/me", api.GetCurrentUser)
+		user.PATCH("/me", api.UpdateCurrentUser)
+		user.DELETE("/me", middleware.RequireSession(), api.DeleteCurrentUser)
+		user.POST("/me/password", middleware.RequireSession(), api.ChangePassword)
+		user.POST("/me/deletion", middleware.RequireSession(), api.RequestAccountDeletion)
+		user.GET("/me/export", middleware.RequireSession(), api.ExportCurrentUser)
+	}
+
+	apiKeys := apiGroup.Group("/api-keys")
+	{
+		apiKeys.Use(middleware.JWTMiddleware(), middleware.RequireSession())
+		apiKeys.POST("", api.CreateAPIKey)
+		apiKeys.GET("", api.ListAPIKeys)
+		apiKeys.DELETE("/:id", api.RevokeAPIKey)
 	}
 
 	expense := apiGroup.Group("/expenses")
@@ -56,15 +107,101 @@ func init() {
 		expense.Use(middleware.JWTMiddleware())
 		expense.POST("/", api.CreateExpense)
 		expense.GET("/", api.ListExpenses)
+		expense.GET("/search", api.SearchExpenses)
+		expense.GET("/suggestion", api.SuggestExpenseCategory)
 		expense.GET("/:id", api.GetExpense)
 		expense.PUT("/:id", api.UpdateExpense)
 		expense.DELETE("/:id", api.DeleteExpense)
 	}
 
+	receipts := apiGroup.Group("/receipts")
+	{
+		receipts.Use(middleware.JWTMiddleware())
+		receipts.POST("", api.UploadReceipt)
+		receipts.GET("", api.ListReceipts)
+		receipts.GET("/:id", api.GetReceipt)
+		receipts.DELETE("/:id", api.DeleteReceipt)
+	}
+
+	jobGroup := apiGroup.Group("/jobs")
+	{
+		jobGroup.Use(middleware.JWTMiddleware())
+		jobGroup.GET("", api.ListJobs)
+		jobGroup.GET("/:id", api.GetJob)
+	}
+
+	eventGroup := apiGroup.Group("/events")
+	{
+		eventGroup.Use(middleware.JWTMiddleware())
+		eventGroup.GET("", api.StreamEvents)
+	}
+
+	organization := apiGroup.Group("/organization")
+	{
+		organization.Use(middleware.JWTMiddleware(), middleware.RequireSession())
+		organization.POST("", api.CreateOrganization)
+		organization.GET("", api.GetOrganization)
+		organization.GET("/members", api.ListMembers)
+		organization.POST("/invitations", api.InviteMember)
+		organization.GET("/invitations", api.ListInvitations)
+		organization.POST("/invitations/:id/accept", api.AcceptInvitation)
+		organization.DELETE("/invitations/:id", api.DeclineInvitation)
+		organization.PATCH("/members/:userId", api.UpdateMember)
+		organization.DELETE("/members/:userId", api.RemoveMember)
+		organization.GET("/expenses", api.ListTeamExpenses)
+		organization.GET("/report", api.GetTeamReport)
+	}
+
+	rates := apiGroup.Group("/rates")
+	{
+		rates.Use(middleware.JWTMiddleware())
+		rates.GET("/mileage", api.ListMileageRates)
+		rates.PUT("/mileage/:vehicle", middleware.RequireAdmin(), api.SetMileageRate)
+		rates.DELETE("/mileage/:vehicle", middleware.RequireAdmin(), api.DeleteMileageRate)
+		rates.GET("/per-diem", api.ListPerDiemRates)
+		rates.PUT("/per-diem/:destination", middleware.RequireAdmin(), api.SetPerDiemRate)
+		rates.DELETE("/per-diem/:destination", middleware.RequireAdmin(), api.DeletePerDiemRate)
+	}
+
+	merchants := apiGroup.Group("/merchants")
+	{
+		merchants.Use(middleware.JWTMiddleware())
+		merchants.GET("", api.ListMerchants)
+		merchants.POST("", middleware.RequireAdmin(), api.CreateMerchant)
+		merchants.PUT("/:id", middleware.RequireAdmin(), api.UpdateMerchant)
+		merchants.DELETE("/:id", middleware.RequireAdmin(), api.DeleteMerchant)
+	}
+
+	webhooks := apiGroup.Group("/webhooks")
+	{
+		webhooks.Use(middleware.JWTMiddleware(), middleware.RequireSession())
+		webhooks.POST("", api.CreateWebhook)
+		webhooks.GET("", api.ListWebhooks)
+		webhooks.DELETE("/:id", api.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", api.ListWebhookDeliveries)
+	}
+
+	policies := apiGroup.Group("/policies")
+	{
+		policies.Use(middleware.JWTMiddleware(), middleware.RequireAdmin())
+		policies.GET("", api.ListPolicyRules)
+		policies.POST("", api.CreatePolicyRule)
+		policies.GET("/violations", api.GetViolationsReport)
+		policies.PUT("/:id", api.UpdatePolicyRule)
+		policies.DELETE("/:id", api.DeletePolicyRule)
+	}
+
 	categories := apiGroup.Group("/categories")
 	{
 		categories.Use(middleware.JWTMiddleware())
 		categories.POST("/", api.CreateCategory)
 		categories.GET("/", api.ListCategories)
 	}
+
+	graphQL := apiGroup.Group("/graphql")
+	{
+		graphQL.Use(middleware.JWTMiddleware())
+		graphQL.GET("", api.GraphQL)
+		graphQL.POST("", api.GraphQL)
+	}
 }
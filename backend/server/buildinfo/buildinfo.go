@@ -0,0 +1,32 @@
+// Package buildinfo identifies the running build.
+package buildinfo
+
+import "runtime/debug"
+
+// Version and Commit are set when building the release images with
+//
+//	-ldflags "-X github.com/Spiria-Digital/expense-manager/server/buildinfo.Version=v1.2.0
+//	          -X github.com/Spiria-Digital/expense-manager/server/buildinfo.Commit=0123abc"
+//
+// Commit defaults to the revision recorded by the go command when building
+// from a git checkout.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	Commit = "unknown"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			Commit = setting.Value
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Config holds the runtime settings of the server. Every value can be
+// overridden with the environment variable named in its comment.
+type Config struct {
+	// AppBaseURL is the public URL of the frontend, used to build links sent
+	// by email (EXPENSE_APP_BASE_URL).
+	AppBaseURL string
+	// RequireEmailVerification blocks login until the user has confirmed
+	// their email address (EXPENSE_REQUIRE_EMAIL_VERIFICATION).
+	RequireEmailVerification bool
+	// EmailVerificationTTL is how long a verification token stays valid
+	// (EXPENSE_EMAIL_VERIFICATION_TTL).
+	EmailVerificationTTL time.Duration
+	// PasswordResetTTL is how long a password reset token stays valid
+	// (EXPENSE_PASSWORD_RESET_TTL).
+	PasswordResetTTL time.Duration
+	// InvitationTTL is how long an invitation to join an organization can be
+	// accepted (EXPENSE_INVITATION_TTL).
+	InvitationTTL time.Duration
+
+	// EncryptionKey is the 32 byte AES key protecting secrets stored in the
+	// database, base64 encoded (EXPENSE_ENCRYPTION_KEY). It is required,
+	// unless AllowDevelopmentKey is set.
+	EncryptionKey []byte
+	// AllowDevelopmentKey uses a fixed key, found in the source, when
+	// EncryptionKey is not set. Local development only
+	// (EXPENSE_ALLOW_DEVELOPMENT_KEY).
+	AllowDevelopmentKey bool
+	// MFAChallengeTTL is how long a user has to enter their second factor
+	// after a correct password (EXPENSE_MFA_CHALLENGE_TTL).
+	MFAChallengeTTL time.Duration
+
+	// TrustedProxies lists the proxies whose X-Forwarded-For header is used to
+	// find the client IP, comma separated (EXPENSE_TRUSTED_PROXIES).
+	TrustedProxies []string
+
+	Database  DatabaseConfig
+	Mail      MailConfig
+	Security  SecurityConfig
+	Webhooks  WebhookConfig
+	OIDC      OIDCConfig
+	Receipts  ReceiptConfig
+	Jobs      JobConfig
+	Events    EventConfig
+	Telemetry TelemetryConfig
+}
+
+// DatabaseConfig configures the database schema upgrades.
+type DatabaseConfig struct {
+	// AutoMigrate runs the pending migrations when the server starts
+	// (EXPENSE_AUTO_MIGRATE).
+	AutoMigrate bool
+	// MigrationLockTimeout is how long to wait for another process running
+	// the migrations (EXPENSE_MIGRATION_LOCK_TIMEOUT).
+	MigrationLockTimeout time.Duration
+}
+
+// TelemetryConfig configures the metrics and traces.
+type TelemetryConfig struct {
+	// MetricsToken, when set, must be sent as a bearer token to read /metrics
+	// (EXPENSE_METRICS_TOKEN).
+	MetricsToken string
+	// TraceExporter sends the traces to "stdout", to an OpenTelemetry
+	// collector with "otlp", or nowhere with "none" (EXPENSE_TRACE_EXPORTER).
+	TraceExporter string
+	// TraceSampleRatio is the share of the traces started by the server that
+	// are exported, from 0 to 1 (EXPENSE_TRACE_SAMPLE_RATIO).
+	TraceSampleRatio float64
+	// SlowQuery is the duration above which database queries are logged
+	// (EXPENSE_SLOW_QUERY).
+	SlowQuery time.Duration
+}
+
+// EventConfig configures the live event stream.
+type EventConfig struct {
+	// BufferSize events are kept for clients resuming the stream after a
+	// disconnection (EXPENSE_EVENTS_BUFFER).
+	BufferSize int
+	// KeepAlive is how often a comment is sent on idle streams so that
+	// proxies do not close them (EXPENSE_EVENTS_KEEPALIVE).
+	KeepAlive time.Duration
+}
+
+// JobConfig configures the background job queue.
+type JobConfig struct {
+	// Concurrency jobs run at the same time (EXPENSE_JOB_CONCURRENCY).
+	Concurrency int
+	// PollInterval is how often idle workers look for due jobs
+	// (EXPENSE_JOB_POLL_INTERVAL).
+	PollInterval time.Duration
+	// Failed jobs are retried after Backoff, doubling up to MaxBackoff
+	// (EXPENSE_JOB_BACKOFF, EXPENSE_JOB_MAX_BACKOFF).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt of a job (EXPENSE_JOB_TIMEOUT).
+	Timeout time.Duration
+	// ShutdownTimeout is how long running jobs have to finish when the
+	// server stops (EXPENSE_JOB_SHUTDOWN_TIMEOUT).
+	ShutdownTimeout time.Duration
+}
+
+// ReceiptConfig configures the reading of uploaded receipts.
+type ReceiptConfig struct {
+	// MaxSize is the largest receipt that can be uploaded, in bytes
+	// (EXPENSE_RECEIPT_MAX_SIZE).
+	MaxSize int
+	// Timeout bounds the text extraction of each receipt
+	// (EXPENSE_RECEIPT_TIMEOUT).
+	Timeout time.Duration
+	// Tesseract is the tesseract command reading receipt photos
+	// (EXPENSE_TESSERACT_PATH) and TesseractLanguages the language packs it
+	// uses, such as "eng+fra" (EXPENSE_TESSERACT_LANGUAGES).
+	Tesseract          string
+	TesseractLanguages string
+}
+
+// OIDCConfig configures single sign-on with an OpenID Connect provider. It is
+// disabled unless Issuer and ClientID are set.
+type OIDCConfig struct {
+	// Issuer is the URL of the provider, used for discovery
+	// (EXPENSE_OIDC_ISSUER).
+	Issuer string
+	// ClientID and ClientSecret identify the app at the provider
+	// (EXPENSE_OIDC_CLIENT_ID, EXPENSE_OIDC_CLIENT_SECRET). The secret can be
+	// left empty for public clients, PKCE is always used.
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the frontend page the provider sends the user back to
+	// (EXPENSE_OIDC_REDIRECT_URL).
+	RedirectURL string
+	// Provision creates an account on the first login of an unknown user
+	// (EXPENSE_OIDC_PROVISION).
+	Provision bool
+	// StateTTL is how long the user has to sign in at the provider
+	// (EXPENSE_OIDC_STATE_TTL).
+	StateTTL time.Duration
+}
+
+// Enabled reports whether single sign-on is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+type WebhookConfig struct {
+	// Interval is how often the outbox is checked for due deliveries
+	// (EXPENSE_WEBHOOK_INTERVAL).
+	Interval time.Duration
+	// Timeout bounds each POST to a receiver (EXPENSE_WEBHOOK_TIMEOUT).
+	Timeout time.Duration
+	// MaxAttempts deliveries are attempted before giving up
+	// (EXPENSE_WEBHOOK_MAX_ATTEMPTS).
+	MaxAttempts int
+	// Failed deliveries are retried after Backoff, doubling up to MaxBackoff
+	// (EXPENSE_WEBHOOK_BACKOFF, EXPENSE_WEBHOOK_MAX_BACKOFF).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type SecurityConfig struct {
+	// AuthIPBurst requests per IP can be made to /api/auth before being
+	// throttled to one every AuthIPInterval (EXPENSE_AUTH_IP_BURST,
+	// EXPENSE_AUTH_IP_INTERVAL).
+	AuthIPBurst    int
+	AuthIPInterval time.Duration
+	// LoginAccountBurst login attempts per account can be made before being
+	// throttled to one every LoginAccountInterval (EXPENSE_LOGIN_ACCOUNT_BURST,
+	// EXPENSE_LOGIN_ACCOUNT_INTERVAL).
+	LoginAccountBurst    int
+	LoginAccountInterval time.Duration
+	// LockoutThreshold consecutive failed logins lock the account for
+	// LockoutDuration, doubling with every further failure up to
+	// LockoutMaxDuration (EXPENSE_LOCKOUT_THRESHOLD, EXPENSE_LOCKOUT_DURATION,
+	// EXPENSE_LOCKOUT_MAX_DURATION).
+	LockoutThreshold   int
+	LockoutDuration    time.Duration
+	LockoutMaxDuration time.Duration
+}
+
+type MailConfig struct {
+	// Driver selects the mailer: "log", "file" or "smtp" (EXPENSE_MAIL_DRIVER).
+	Driver string
+	// From is the sender address (EXPENSE_MAIL_FROM).
+	From string
+	// Dir is where the file driver writes messages (EXPENSE_MAIL_DIR).
+	Dir string
+
+	SMTPHost     string // EXPENSE_SMTP_HOST
+	SMTPPort     int    // EXPENSE_SMTP_PORT
+	SMTPUsername string // EXPENSE_SMTP_USERNAME
+	SMTPPassword string // EXPENSE_SMTP_PASSWORD
+}
+
+// Current is the configuration loaded from the environment at startup.
+var Current = Load()
+
+// Load reads the configuration from the environment, falling back to
+// defaults suitable for local development.
+func Load() *Config {
+	appBaseURL := getString("EXPENSE_APP_BASE_URL", "http://localhost:3000")
+	allowDevelopmentKey := getBool("EXPENSE_ALLOW_DEVELOPMENT_KEY", false)
+	return &Config{
+		AppBaseURL:               appBaseURL,
+		RequireEmailVerification: getBool("EXPENSE_REQUIRE_EMAIL_VERIFICATION", false),
+		EmailVerificationTTL:     getDuration("EXPENSE_EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		PasswordResetTTL:         getDuration("EXPENSE_PASSWORD_RESET_TTL", time.Hour),
+		InvitationTTL:            getDuration("EXPENSE_INVITATION_TTL", 7*24*time.Hour),
+		EncryptionKey:            getKey("EXPENSE_ENCRYPTION_KEY", allowDevelopmentKey),
+		AllowDevelopmentKey:      allowDevelopmentKey,
+		MFAChallengeTTL:          getDuration("EXPENSE_MFA_CHALLENGE_TTL", 5*time.Minute),
+		TrustedProxies:           getList("EXPENSE_TRUSTED_PROXIES", nil),
+		Database: DatabaseConfig{
+			AutoMigrate:          getBool("EXPENSE_AUTO_MIGRATE", false),
+			MigrationLockTimeout: getDuration("EXPENSE_MIGRATION_LOCK_TIMEOUT", time.Minute),
+		},
+		Mail: MailConfig{
+			Driver:       getString("EXPENSE_MAIL_DRIVER", "log"),
+			From:         getString("EXPENSE_MAIL_FROM", "Expense Manager <no-reply@localhost>"),
+			Dir:          getString("EXPENSE_MAIL_DIR", "mail"),
+			SMTPHost:     getString("EXPENSE_SMTP_HOST", "localhost"),
+			SMTPPort:     getInt("EXPENSE_SMTP_PORT", 587),
+			SMTPUsername: getString("EXPENSE_SMTP_USERNAME", ""),
+			SMTPPassword: getString("EXPENSE_SMTP_PASSWORD", ""),
+		},
+		Security: SecurityConfig{
+			AuthIPBurst:          getInt("EXPENSE_AUTH_IP_BURST", 20),
+			AuthIPInterval:       getDuration("EXPENSE_AUTH_IP_INTERVAL", 3*time.Second),
+			LoginAccountBurst:    getInt("EXPENSE_LOGIN_ACCOUNT_BURST", 10),
+			LoginAccountInterval: getDuration("EXPENSE_LOGIN_ACCOUNT_INTERVAL", 30*time.Second),
+			LockoutThreshold:     getInt("EXPENSE_LOCKOUT_THRESHOLD", 5),
+			LockoutDuration:      getDuration("EXPENSE_LOCKOUT_DURATION", time.Minute),
+			LockoutMaxDuration:   getDuration("EXPENSE_LOCKOUT_MAX_DURATION", time.Hour),
+		},
+		Webhooks: WebhookConfig{
+			Interval:    getDuration("EXPENSE_WEBHOOK_INTERVAL", 5*time.Second),
+			Timeout:     getDuration("EXPENSE_WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts: getInt("EXPENSE_WEBHOOK_MAX_ATTEMPTS", 8),
+			Backoff:     getDuration("EXPENSE_WEBHOOK_BACKOFF", 30*time.Second),
+			MaxBackoff:  getDuration("EXPENSE_WEBHOOK_MAX_BACKOFF", 6*time.Hour),
+		},
+		OIDC: OIDCConfig{
+			Issuer:       getString("EXPENSE_OIDC_ISSUER", ""),
+			ClientID:     getString("EXPENSE_OIDC_CLIENT_ID", ""),
+			ClientSecret: getString("EXPENSE_OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getString("EXPENSE_OIDC_REDIRECT_URL", appBaseURL+"/auth/oidc/callback"),
+			Provision:    getBool("EXPENSE_OIDC_PROVISION", true),
+			StateTTL:     getDuration("EXPENSE_OIDC_STATE_TTL", 10*time.Minute),
+		},
+		Receipts: ReceiptConfig{
+			MaxSize:            getInt("EXPENSE_RECEIPT_MAX_SIZE", 10<<20),
+			Timeout:            getDuration("EXPENSE_RECEIPT_TIMEOUT", time.Minute),
+			Tesseract:          getString("EXPENSE_TESSERACT_PATH", "tesseract"),
+			TesseractLanguages: getString("EXPENSE_TESSERACT_LANGUAGES", "eng"),
+		},
+		Jobs: JobConfig{
+			Concurrency:     getInt("EXPENSE_JOB_CONCURRENCY", 4),
+			PollInterval:    getDuration("EXPENSE_JOB_POLL_INTERVAL", time.Second),
+			Backoff:         getDuration("EXPENSE_JOB_BACKOFF", 10*time.Second),
+			MaxBackoff:      getDuration("EXPENSE_JOB_MAX_BACKOFF", time.Hour),
+			Timeout:         getDuration("EXPENSE_JOB_TIMEOUT", 10*time.Minute),
+			ShutdownTimeout: getDuration("EXPENSE_JOB_SHUTDOWN_TIMEOUT", 30*time.Second),
+		},
+		Events: EventConfig{
+			BufferSize: getInt("EXPENSE_EVENTS_BUFFER", 500),
+			KeepAlive:  getDuration("EXPENSE_EVENTS_KEEPALIVE", 25*time.Second),
+		},
+		Telemetry: TelemetryConfig{
+			MetricsToken:     getString("EXPENSE_METRICS_TOKEN", ""),
+			TraceExporter:    getString("EXPENSE_TRACE_EXPORTER", "none"),
+			TraceSampleRatio: getFloat("EXPENSE_TRACE_SAMPLE_RATIO", 1),
+			SlowQuery:        getDuration("EXPENSE_SLOW_QUERY", 200*time.Millisecond),
+		},
+	}
+}
+
+func getString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// Validate reports the settings the server cannot run without. It is checked
+// by the server at startup rather than by Load, so that the tools and tests
+// sharing the configuration do not need them.
+func (c *Config) Validate() error {
+	if c.EncryptionKey == nil {
+		return errors.New("EXPENSE_ENCRYPTION_KEY is not set, generate one with `openssl rand -base64 32` " +
+			"or set EXPENSE_ALLOW_DEVELOPMENT_KEY=true for local development")
+	}
+	return nil
+}
+
+// developmentKey is only meant for local runs: anyone reading the source can
+// decrypt the secrets it protects.
+var developmentKey = sha256.Sum256([]byte("expense-manager-development-key"))
+
+// getKey returns the key set in the environment, the development key when it
+// is not set and allowDevelopmentKey is, or nil.
+func getKey(key string, allowDevelopmentKey bool) []byte {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		if !allowDevelopmentKey {
+			return nil
+		}
+		log.Warn().Str("key", key).Msg("encryption key not set, using the development key")
+		return developmentKey[:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) != 32 {
+		log.Fatal().Err(err).Str("key", key).Msg("encryption key must be 32 bytes, base64 encoded")
+	}
+	return decoded
+}
+
+func getList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("invalid boolean in environment, using default")
+		return fallback
+	}
+	return parsed
+}
+
+func getInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("invalid integer in environment, using default")
+		return fallback
+	}
+	return parsed
+}
+
+func getFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("invalid number in environment, using default")
+		return fallback
+	}
+	return parsed
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("invalid duration in environment, using default")
+		return fallback
+	}
+	return parsed
+}
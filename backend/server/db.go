@@ -1,21 +1,76 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/service"
 	"github.com/Spiria-Digital/expense-manager/server/storage"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
 )
 
 var BunDB *bun.DB
 
+// DatabasePath is the SQLite file holding the data.
+var DatabasePath = filepath.Join(storage.GetRootDir(), "expenses.db")
+
+// ServerLockPath is the file the servers hold a shared lock on while they
+// run, so that the maintenance commands can tell when one is running, even
+// idle with no connection to the database open.
+var ServerLockPath = DatabasePath + ".lock"
+
 func init() {
-	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
-	db, err := storage.NewBunDB(filePath)
+	db, err := storage.NewBunDB(DatabasePath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create bun db")
 	}
+	db.AddQueryHook(telemetry.QueryHook{SlowQuery: config.Current.Telemetry.SlowQuery})
+	telemetry.RegisterDB(db, "expenses")
 	BunDB = db
 }
+
+// LockDatabase takes the shared lock of a running server on ServerLockPath.
+// It is held until the returned file is closed.
+func LockDatabase() (io.Closer, error) {
+	lock, err := storage.LockFile(ServerLockPath, false)
+	if errors.Is(err, storage.ErrLocked) {
+		return nil, errors.New("the database is being restored")
+	}
+	return lock, err
+}
+
+// PrepareDatabase checks the database schema before the server starts. It
+// runs the pending migrations when EXPENSE_AUTO_MIGRATE is set, and fails when
+// the database was migrated by a newer version.
+func PrepareDatabase(ctx context.Context) error {
+	if config.Current.Database.AutoMigrate {
+		group, err := service.Migrate(ctx, BunDB, migrations.Migrations, config.Current.Database.MigrationLockTimeout)
+		if err != nil {
+			return err
+		}
+		if !group.IsZero() {
+			log.Info().Msgf("migrations applied: (%s)", group)
+		}
+		return nil
+	}
+
+	pending, unknown, err := service.MigrationStatus(ctx, BunDB, migrations.Migrations)
+	switch {
+	case err != nil:
+		log.Warn().Err(err).Msg("the database is not initialized, run \"bun db init\" and \"bun db migrate\" or set EXPENSE_AUTO_MIGRATE")
+	case len(unknown) > 0:
+		return fmt.Errorf("%w: unknown migrations %s", service.ErrDatabaseAhead, strings.Join(unknown, ", "))
+	case len(pending) > 0:
+		log.Warn().Strs("pending", pending).Msg("migrations are not applied, run \"bun db migrate\" or set EXPENSE_AUTO_MIGRATE")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/events"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// Events broadcasts the committed changes to the event streams. main closes
+// it when the server shuts down, ending the streams.
+var Events *events.Broker
+
+func init() {
+	Events = events.NewBroker(config.Current.Events.BufferSize)
+	service.Events = Events
+}
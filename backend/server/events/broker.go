@@ -0,0 +1,178 @@
+// Package events broadcasts the changes committed by the service layer to the
+// users following them live.
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// Event types. Expense events share their names with the webhook events.
+const (
+	ExpenseCreated  = models.WebhookEventExpenseCreated
+	ExpenseUpdated  = models.WebhookEventExpenseUpdated
+	ExpenseDeleted  = models.WebhookEventExpenseDeleted
+	CategoryCreated = "category.created"
+	CategoryUpdated = "category.updated"
+	CategoryDeleted = "category.deleted"
+)
+
+// DefaultBufferSize is the number of events kept by brokers created with a
+// size of 0.
+const DefaultBufferSize = 500
+
+// subscriberBuffer is the number of events a subscriber can fall behind
+// before being dropped.
+const subscriberBuffer = 64
+
+// Event is a change published to the users.
+type Event struct {
+	ID   int64
+	Type string
+	// UserID is the user the event is for, or 0 for every user.
+	UserID int
+	// Data is the changed object, encoded as JSON.
+	Data json.RawMessage
+}
+
+// For reports whether the event is for the user.
+func (e *Event) For(userID int) bool {
+	return e.UserID == 0 || e.UserID == userID
+}
+
+// Broker is an in-process pub/sub of events. It keeps the latest events so
+// that subscribers reconnecting after a short disconnection can catch up.
+// A nil Broker drops the events.
+type Broker struct {
+	mu          sync.Mutex
+	size        int
+	buffer      []Event
+	lastID      int64
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewBroker returns a broker keeping the size latest events.
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Broker{
+		size: size,
+		// IDs grow across restarts, so that IDs sent by another process
+		// are never mistaken for buffered ones
+		lastID:      time.Now().UnixMicro(),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events of a user on C until it is unsubscribed.
+// C is closed when the subscriber falls too far behind or the broker is
+// closed.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	userID int
+}
+
+// Publish sends an event of the given type about data to the user, or to
+// every user when userID is 0.
+func (b *Broker) Publish(userID int, eventType string, data any) {
+	if b == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Err(err).Str("event", eventType).Msg("event encoding error")
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, UserID: userID, Data: payload}
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > b.size {
+		b.buffer = b.buffer[len(b.buffer)-b.size:]
+	}
+	for sub := range b.subscribers {
+		if !event.For(sub.userID) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			// the subscriber reconnects and catches up from the buffer
+			b.drop(sub)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the user. When
+// lastEventID is set, the buffered events published after it are returned
+// for the subscriber to catch up; ok is false when some of them are no
+// longer buffered, or the ID is unknown, and the subscriber should reload.
+func (b *Broker) Subscribe(userID int, lastEventID string) (sub *Subscription, missed []Event, ok bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, userID: userID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub, nil, true
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	after, err := strconv.ParseInt(lastEventID, 10, 64)
+	oldest := b.lastID + 1
+	if len(b.buffer) > 0 {
+		oldest = b.buffer[0].ID
+	}
+	if err != nil || after < oldest-1 || after > b.lastID {
+		return sub, nil, false
+	}
+	for _, event := range b.buffer {
+		if event.ID > after && event.For(userID) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, true
+}
+
+// Unsubscribe stops sending events to sub.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// Close ends all the subscriptions, for the server to shut down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.drop(sub)
+	}
+}
+
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker(3)
+	sub, missed, ok := b.Subscribe(1, "")
+	assert.True(t, ok)
+	assert.Empty(t, missed)
+
+	b.Publish(1, ExpenseCreated, map[string]int{"id": 10})
+	b.Publish(2, ExpenseCreated, map[string]int{"id": 20})
+	b.Publish(0, CategoryCreated, map[string]int{"id": 30})
+
+	first := <-sub.C
+	assert.Equal(t, ExpenseCreated, first.Type)
+	assert.JSONEq(t, `{"id":10}`, string(first.Data))
+	second := <-sub.C
+	assert.Equal(t, CategoryCreated, second.Type, "events of other users are skipped")
+	assert.Greater(t, second.ID, first.ID)
+
+	t.Run("resumes from the buffer", func(t *testing.T) {
+		resumed, missed, ok := b.Subscribe(1, strconv.FormatInt(first.ID, 10))
+		defer b.Unsubscribe(resumed)
+		require.True(t, ok)
+		require.Len(t, missed, 1)
+		assert.Equal(t, second.ID, missed[0].ID)
+
+		_, missed, ok = b.Subscribe(1, strconv.FormatInt(second.ID, 10))
+		assert.True(t, ok)
+		assert.Empty(t, missed)
+	})
+
+	t.Run("reports lost events", func(t *testing.T) {
+		b.Publish(0, CategoryUpdated, nil)
+		b.Publish(0, CategoryDeleted, nil)
+		for _, lastEventID := range []string{strconv.FormatInt(first.ID, 10), "1", "x", strconv.FormatInt(second.ID+10, 10)} {
+			_, missed, ok := b.Subscribe(1, lastEventID)
+			assert.False(t, ok, lastEventID)
+			assert.Empty(t, missed)
+		}
+	})
+
+	t.Run("drops slow subscribers", func(t *testing.T) {
+		slow, _, _ := b.Subscribe(3, "")
+		for range subscriberBuffer + 1 {
+			b.Publish(3, ExpenseUpdated, nil)
+		}
+		received := 0
+		for range slow.C {
+			received++
+		}
+		assert.Equal(t, subscriberBuffer, received)
+	})
+
+	t.Run("closes the subscriptions", func(t *testing.T) {
+		b.Close()
+		_, open := <-sub.C
+		for open {
+			_, open = <-sub.C
+		}
+		closed, _, _ := b.Subscribe(1, "")
+		_, open = <-closed.C
+		assert.False(t, open)
+		b.Unsubscribe(closed)
+	})
+}
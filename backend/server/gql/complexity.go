@@ -0,0 +1,196 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// MaxDepth is the deepest selection a query may make.
+	MaxDepth = 8
+	// MaxComplexity bounds the estimated number of fields a query resolves.
+	MaxComplexity = 5000
+	// defaultListSize is the estimated length of lists without a first
+	// argument.
+	defaultListSize = 10
+)
+
+// complexity estimates the cost of the operation of doc that will run: every
+// field costs one, and the selection of a list field is counted once per
+// expected item, given by its first argument. Introspection fields are free.
+func complexity(doc *ast.Document, operationName string, variables map[string]any) (cost, depth int, err error) {
+	a := analyzer{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	var operation *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	// graphql-go overflows the stack validating cyclic fragments
+	if name := a.fragmentCycle(); name != "" {
+		return 0, 0, fmt.Errorf("cannot spread fragment %q within itself", name)
+	}
+	if operation == nil {
+		// the executor reports unknown operations
+		return 0, 0, nil
+	}
+	if operation.Operation != ast.OperationTypeQuery {
+		return 0, 0, fmt.Errorf("unsupported operation %s", operation.Operation)
+	}
+	cost, depth = a.selectionSet(Schema.QueryType(), operation.SelectionSet, 1)
+	return cost, depth, nil
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// fragmentCycle returns the name of a fragment spreading itself, directly or
+// not, if any.
+func (a *analyzer) fragmentCycle() string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(name string) string
+	visit = func(name string) string {
+		fragment, ok := a.fragments[name]
+		if !ok || state[name] == done {
+			return ""
+		}
+		if state[name] == visiting {
+			return name
+		}
+		state[name] = visiting
+		for _, spread := range spreads(fragment.SelectionSet) {
+			if cycle := visit(spread); cycle != "" {
+				return cycle
+			}
+		}
+		state[name] = done
+		return ""
+	}
+	for name := range a.fragments {
+		if cycle := visit(name); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
+
+// spreads returns the names of the fragments spread anywhere in set.
+func spreads(set *ast.SelectionSet) []string {
+	if set == nil {
+		return nil
+	}
+	var names []string
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			names = append(names, spreads(selection.SelectionSet)...)
+		case *ast.InlineFragment:
+			names = append(names, spreads(selection.SelectionSet)...)
+		case *ast.FragmentSpread:
+			names = append(names, selection.Name.Value)
+		}
+	}
+	return names
+}
+
+// selectionSet returns the cost and depth of set selected on parent, at the
+// given depth. Fragments must not be cyclic.
+func (a *analyzer) selectionSet(parent *graphql.Object, set *ast.SelectionSet, depth int) (cost, maxDepth int) {
+	if set == nil || parent == nil {
+		return 0, depth - 1
+	}
+	maxDepth = depth
+	add := func(c, d int) {
+		cost += c
+		maxDepth = max(maxDepth, d)
+	}
+
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			name := selection.Name.Value
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+			definition, ok := parent.Fields()[name]
+			if !ok {
+				continue
+			}
+			childType, isList := unwrap(definition.Type)
+			childCost, childDepth := a.selectionSet(childType, selection.SelectionSet, depth+1)
+			if isList {
+				childCost *= a.listSize(selection, definition)
+			}
+			add(1+childCost, childDepth)
+		case *ast.InlineFragment:
+			add(a.selectionSet(parent, selection.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[selection.Name.Value]; ok {
+				add(a.selectionSet(parent, fragment.SelectionSet, depth))
+			}
+		}
+	}
+	return cost, maxDepth
+}
+
+// listSize returns the number of items a list field is expected to return.
+func (a *analyzer) listSize(field *ast.Field, definition *graphql.FieldDefinition) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				return max(n, 1)
+			}
+		case *ast.Variable:
+			switch n := a.variables[value.Name.Value].(type) {
+			case float64:
+				return max(int(n), 1)
+			case int:
+				return max(n, 1)
+			}
+		}
+	}
+	for _, argument := range definition.Args {
+		if n, ok := argument.DefaultValue.(int); ok && argument.Name() == "first" {
+			return n
+		}
+	}
+	return defaultListSize
+}
+
+// unwrap returns the object type of a field, if any, and whether it is a
+// list.
+func unwrap(t graphql.Type) (*graphql.Object, bool) {
+	isList := false
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			isList = true
+			t = wrapped.OfType
+		case *graphql.Object:
+			return wrapped, isList
+		default:
+			return nil, isList
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package gql serves a read-only GraphQL API over the expenses, categories
+// and users visible to the current user.
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// Request is a GraphQL request as posted by clients.
+type Request struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ErrTooComplex is returned for queries exceeding MaxDepth or MaxComplexity.
+var ErrTooComplex = errors.New("query too complex")
+
+// Execute runs req on behalf of user. Queries over the limits are rejected
+// with ErrTooComplex before anything is resolved; other failures are
+// reported in the errors of the result, as GraphQL clients expect.
+func Execute(ctx context.Context, db *bun.DB, user *models.User, req Request) (*graphql.Result, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, nil
+	}
+	cost, depth, err := complexity(doc, req.OperationName, req.Variables)
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, nil
+	}
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("%w: depth %d exceeds %d", ErrTooComplex, depth, MaxDepth)
+	}
+	if cost > MaxComplexity {
+		return nil, fmt.Errorf("%w: complexity %d exceeds %d", ErrTooComplex, cost, MaxComplexity)
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         Schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(ctx, contextKey{}, newRequest(db, user)),
+	})
+	for i := range result.Errors {
+		result.Errors[i] = sanitize(ctx, result.Errors[i])
+	}
+	return result, nil
+}
+
+// sanitize hides the details of unexpected resolver errors, which may come
+// from the database, behind a generic message. They are logged with the
+// request.
+func sanitize(ctx context.Context, formatted gqlerrors.FormattedError) gqlerrors.FormattedError {
+	err := formatted.OriginalError()
+	var located *gqlerrors.Error
+	if errors.As(err, &located) {
+		err = located.OriginalError
+	}
+	if err == nil {
+		// syntax and validation errors
+		return formatted
+	}
+
+	var qErr queryError
+	var sErr *service.Error
+	switch {
+	case errors.As(err, &qErr):
+	case errors.As(err, &sErr):
+		formatted.Message = sErr.Message
+	default:
+		log.Ctx(ctx).Err(err).Interface("path", formatted.Path).Msg("graphql resolver error")
+		formatted.Message = "internal error"
+	}
+	return formatted
+}
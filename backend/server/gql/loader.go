@@ -0,0 +1,58 @@
+package gql
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Loader batches the lookups requested while resolving one level of a query
+// into a single fetch, and caches the results for the rest of the request.
+//
+// Load only registers the key and returns a thunk. The executor resolves all
+// the fields of a level before calling their thunks, so the first thunk
+// called fetches every key registered so far.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	cache   map[K]V
+}
+
+// NewLoader returns a loader calling fetch with batches of keys. Keys missing
+// from the map fetch returns resolve to the zero value.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, cache: map[K]V{}}
+}
+
+// Load returns a thunk resolving to the value of key.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (any, error) {
+	l.mu.Lock()
+	if _, ok := l.cache[key]; !ok && !slices.Contains(l.pending, key) {
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (any, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if value, ok := l.cache[key]; ok {
+			return value, nil
+		}
+		keys := l.pending
+		l.pending = nil
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+		values, err := l.fetch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			l.cache[k] = values[k]
+		}
+		return l.cache[key], nil
+	}
+}
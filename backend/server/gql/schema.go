@@ -0,0 +1,314 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+const (
+	dateFormat = "2006-01-02"
+	// maxPageSize bounds the first argument of paginated fields.
+	maxPageSize = 100
+)
+
+// queryError is an error caused by the query itself, safe to return to the
+// client as is.
+type queryError string
+
+func (e queryError) Error() string {
+	return string(e)
+}
+
+type contextKey struct{}
+
+// request is the state shared by the resolvers of one request.
+type request struct {
+	db         *bun.DB
+	user       *models.User
+	categories *Loader[int, *models.Category]
+	users      *Loader[int, *models.User]
+}
+
+func newRequest(db *bun.DB, user *models.User) *request {
+	return &request{
+		db:   db,
+		user: user,
+		categories: NewLoader(func(ctx context.Context, ids []int) (map[int]*models.Category, error) {
+			return service.GetCategoriesByID(ctx, db, ids)
+		}),
+		users: NewLoader(func(ctx context.Context, ids []int) (map[int]*models.User, error) {
+			return service.GetUsersByID(ctx, db, ids)
+		}),
+	}
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(contextKey{}).(*request)
+}
+
+var categoryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Category",
+	Fields: graphql.Fields{
+		"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"firstName": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"email": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Only visible on the current user.",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				user := p.Source.(*models.User)
+				if user.ID != requestFrom(p.Context).user.ID {
+					return nil, nil
+				}
+				return user.Email, nil
+			},
+		},
+	},
+})
+
+var violationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PolicyViolation",
+	Fields: graphql.Fields{
+		"ruleName": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"message":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"severity": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// loadCategory resolves a category ID through the request loader, so the
+// categories of a whole list are fetched at once.
+func loadCategory(ctx context.Context, id int) (any, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	return requestFrom(ctx).categories.Load(ctx, id), nil
+}
+
+var expenseType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Expense",
+	Fields: graphql.Fields{
+		"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"description": &graphql.Field{Type: graphql.String},
+		"merchant":    &graphql.Field{Type: graphql.String},
+		"type":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"date": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Expense).Date.Format(dateFormat), nil
+			},
+		},
+		"amount": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return float64(p.Source.(*models.Expense).Amount), nil
+			},
+		},
+		"distanceKm":  &graphql.Field{Type: graphql.Float},
+		"vehicle":     &graphql.Field{Type: graphql.String},
+		"destination": &graphql.Field{Type: graphql.String},
+		"days":        &graphql.Field{Type: graphql.Int},
+		"category": &graphql.Field{
+			Type: categoryType,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return loadCategory(p.Context, p.Source.(*models.Expense).CategoryID)
+			},
+		},
+		"owner": &graphql.Field{
+			Type: graphql.NewNonNull(userType),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return requestFrom(p.Context).users.Load(p.Context, p.Source.(*models.Expense).OwnerID), nil
+			},
+		},
+		"violations": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(violationType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Expense).Violations, nil
+			},
+		},
+	},
+})
+
+var categoryTotalType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CategoryTotal",
+	Fields: graphql.Fields{
+		"category": &graphql.Field{
+			Type:        categoryType,
+			Description: "Null for uncategorized expenses.",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return loadCategory(p.Context, p.Source.(service.CategorySpend).CategoryID)
+			},
+		},
+		"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+var summaryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ExpenseSummary",
+	Fields: graphql.Fields{
+		"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"byCategory": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(categoryTotalType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*service.ExpenseSummary).Categories, nil
+			},
+		},
+	},
+})
+
+// filterArgs select the expenses of the listing and summary fields.
+func filterArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"team": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: false,
+			Description:  "Query the expenses of the whole organization. Owners and managers only.",
+		},
+		"from":       &graphql.ArgumentConfig{Type: graphql.String, Description: "YYYY-MM-DD"},
+		"to":         &graphql.ArgumentConfig{Type: graphql.String, Description: "YYYY-MM-DD, inclusive"},
+		"categoryId": &graphql.ArgumentConfig{Type: graphql.Int},
+	}
+}
+
+// expenseQuery builds the service query for the filter arguments, checking
+// that the user can see the team's expenses when asked for.
+func expenseQuery(p graphql.ResolveParams) (service.ExpenseQuery, error) {
+	r := requestFrom(p.Context)
+	q := service.ExpenseQuery{OwnerID: r.user.ID}
+
+	if team, _ := p.Args["team"].(bool); team {
+		member, err := service.GetMembership(p.Context, r.db, r.user.ID)
+		if errors.Is(err, service.ErrNotFound) || (err == nil && !member.CanViewTeam()) {
+			return q, queryError("only organization owners and managers can query team expenses")
+		}
+		if err != nil {
+			return q, err
+		}
+		q.OrganizationID = member.OrganizationID
+	}
+
+	for name, date := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		value, ok := p.Args[name].(string)
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(dateFormat, value)
+		if err != nil {
+			return q, queryError(fmt.Sprintf("%s must be a YYYY-MM-DD date", name))
+		}
+		*date = parsed
+	}
+	q.CategoryID, _ = p.Args["categoryId"].(int)
+	return q, nil
+}
+
+func pointers[T any](values []T) []*T {
+	result := make([]*T, len(values))
+	for i := range values {
+		result[i] = &values[i]
+	}
+	return result
+}
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"me": &graphql.Field{
+			Type: graphql.NewNonNull(userType),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return requestFrom(p.Context).user, nil
+			},
+		},
+		"categories": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(categoryType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				r := requestFrom(p.Context)
+				orgID, err := service.OrganizationOf(p.Context, r.db, r.user.ID)
+				if err != nil {
+					return nil, err
+				}
+				categories, err := service.GetCategories(p.Context, r.db, orgID)
+				return pointers(categories), err
+			},
+		},
+		"expense": &graphql.Field{
+			Type: expenseType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				r := requestFrom(p.Context)
+				expense, err := service.GetExpense(p.Context, r.db, p.Args["id"].(int), r.user.ID, service.ExpenseRelations{})
+				if errors.Is(err, service.ErrNotFound) {
+					return nil, nil
+				}
+				return expense, err
+			},
+		},
+		"expenses": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(expenseType))),
+			Description: "Expenses, most recent first.",
+			Args: func() graphql.FieldConfigArgument {
+				args := filterArgs()
+				args["first"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50, Description: "Page size, at most 100"}
+				args["offset"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0}
+				return args
+			}(),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				q, err := expenseQuery(p)
+				if err != nil {
+					return nil, err
+				}
+				q.Limit, _ = p.Args["first"].(int)
+				q.Offset, _ = p.Args["offset"].(int)
+				if q.Limit < 1 || q.Limit > maxPageSize {
+					return nil, queryError(fmt.Sprintf("first must be between 1 and %d", maxPageSize))
+				}
+				if q.Offset < 0 {
+					return nil, queryError("offset must not be negative")
+				}
+				expenses, err := service.QueryExpenses(p.Context, requestFrom(p.Context).db, q)
+				return pointers(expenses), err
+			},
+		},
+		"summary": &graphql.Field{
+			Type:        graphql.NewNonNull(summaryType),
+			Description: "Number and total of the expenses, overall and per category.",
+			Args:        filterArgs(),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				q, err := expenseQuery(p)
+				if err != nil {
+					return nil, err
+				}
+				return service.SummarizeExpenses(p.Context, requestFrom(p.Context).db, q)
+			},
+		},
+	},
+})
+
+// Schema is the GraphQL schema served at /api/graphql.
+var Schema = func() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}()
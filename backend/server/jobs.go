@@ -0,0 +1,33 @@
+package server
+
+import (
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/jobs"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/receipt"
+)
+
+// JobQueue runs the background jobs. It is started by main alongside the
+// HTTP server.
+var JobQueue *jobs.Queue
+
+func init() {
+	cfg := config.Current.Jobs
+	JobQueue = &jobs.Queue{
+		DB:              BunDB,
+		Concurrency:     cfg.Concurrency,
+		PollInterval:    cfg.PollInterval,
+		Backoff:         cfg.Backoff,
+		MaxBackoff:      cfg.MaxBackoff,
+		Timeout:         cfg.Timeout,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	}
+
+	receipts := config.Current.Receipts
+	scanner := &receipt.Scanner{
+		DB:        BunDB,
+		Extractor: receipt.NewLocal(receipts.Tesseract, receipts.TesseractLanguages),
+		Timeout:   receipts.Timeout,
+	}
+	jobs.Register(JobQueue, models.JobTypeReceiptScan, scanner.Handle)
+}
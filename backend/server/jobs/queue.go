@@ -0,0 +1,190 @@
+// Package jobs runs the background jobs stored in the database.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// Handler runs a job. Returning an error fails the attempt, which is retried
+// unless the error is Permanent. A handler can set job.Result for the user.
+type Handler func(ctx context.Context, job *models.Job) error
+
+// Register adds the handler of the jobType jobs, whose payload is decoded
+// into a T.
+func Register[T any](q *Queue, jobType string, handle func(ctx context.Context, job *models.Job, payload T) error) {
+	q.Handle(jobType, func(ctx context.Context, job *models.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return handle(ctx, job, payload)
+	})
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the job fails right away.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Queue runs the due jobs with a pool of Concurrency workers. It only runs
+// the types of jobs it has a handler for. Several queues can run on the same
+// database.
+type Queue struct {
+	DB *bun.DB
+
+	Concurrency int
+	// PollInterval is how long an idle worker waits before looking for due
+	// jobs again.
+	PollInterval time.Duration
+	// The first retry waits Backoff, then the delay doubles up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt. Running jobs locked for longer were
+	// abandoned by a stopped worker and are run again.
+	Timeout time.Duration
+	// ShutdownTimeout is how long running jobs have to finish once the queue
+	// is stopped. Jobs interrupted past it are run again on the next start.
+	ShutdownTimeout time.Duration
+
+	handlers map[string]Handler
+	types    []string
+	now      func() time.Time
+}
+
+// Handle adds the handler of the jobType jobs. It must be called before Run.
+func (q *Queue) Handle(jobType string, handler Handler) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]Handler)
+	}
+	if _, ok := q.handlers[jobType]; !ok {
+		q.types = append(q.types, jobType)
+	}
+	q.handlers[jobType] = handler
+}
+
+// Run runs jobs until ctx is cancelled, then waits for the running jobs.
+func (q *Queue) Run(ctx context.Context) {
+	// running jobs are only cancelled ShutdownTimeout after ctx
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(q.ShutdownTimeout, cancelJobs)
+	})
+	defer stop()
+
+	var workers sync.WaitGroup
+	for range q.Concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			q.work(ctx, jobCtx)
+		}()
+	}
+	workers.Wait()
+}
+
+func (q *Queue) work(ctx, jobCtx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		ran, err := q.runNext(ctx, jobCtx)
+		if err != nil && ctx.Err() == nil {
+			log.Err(err).Msg("job queue error")
+		}
+		if ran {
+			timer.Reset(0)
+		} else {
+			timer.Reset(q.PollInterval)
+		}
+	}
+}
+
+// RunNext runs the next due job, if any, and reports whether there was one.
+func (q *Queue) RunNext(ctx context.Context) (bool, error) {
+	return q.runNext(ctx, ctx)
+}
+
+func (q *Queue) runNext(ctx, jobCtx context.Context) (bool, error) {
+	now := q.clock()
+	job, err := service.ClaimJob(ctx, q.DB, q.types, now, now.Add(-q.Timeout))
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	err = q.run(jobCtx, job)
+	now = q.clock()
+	job.LockedAt = nil
+	switch {
+	case err == nil:
+		job.Status = models.JobStatusSucceeded
+		job.LastError = ""
+		job.FinishedAt = &now
+	case jobCtx.Err() != nil:
+		// interrupted by the shutdown, the attempt does not count
+		job.Status = models.JobStatusPending
+		job.Attempts--
+		job.RunAt = now
+	default:
+		job.LastError = err.Error()
+		var permanent *permanentError
+		if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+			job.Status = models.JobStatusFailed
+			job.FinishedAt = &now
+			log.Warn().Err(err).Int("job", job.ID).Str("type", job.Type).Msg("job failed, giving up")
+		} else {
+			job.Status = models.JobStatusPending
+			job.RunAt = now.Add(utils.Backoff(job.Attempts, q.Backoff, q.MaxBackoff))
+		}
+	}
+	// record the outcome even when stopping
+	return true, service.RecordJobAttempt(context.WithoutCancel(ctx), q.DB, job)
+}
+
+// run calls the handler of job, turning panics into errors.
+func (q *Queue) run(ctx context.Context, job *models.Job) (err error) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for %q jobs", job.Type))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+	return handler(ctx, job)
+}
+
+func (q *Queue) clock() time.Time {
+	if q.now != nil {
+		return q.now().UTC()
+	}
+	return time.Now().UTC()
+}
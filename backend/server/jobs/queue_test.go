@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+type testPayload struct {
+	Name string `json:"name"`
+}
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
+	db, err := storage.NewBunDB(filePath)
+	require.NoError(t, err)
+
+	user := &models.User{Email: "jobs.owner@test.com", Password: "unused", FirstName: "Joan", LastName: "Jobs"}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+		require.NoError(t, db.Close())
+	})
+
+	now := time.Now().UTC()
+	var mu sync.Mutex
+	var runs []string
+	q := &Queue{
+		DB:         db,
+		Backoff:    time.Minute,
+		MaxBackoff: time.Hour,
+		Timeout:    time.Hour,
+		now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	Register(q, "test.queue", func(ctx context.Context, job *models.Job, payload testPayload) error {
+		mu.Lock()
+		runs = append(runs, payload.Name)
+		mu.Unlock()
+		switch payload.Name {
+		case "flaky":
+			if job.Attempts == 1 {
+				return errors.New("temporary failure")
+			}
+		case "broken":
+			return Permanent(errors.New("cannot succeed"))
+		case "panics":
+			panic("boom")
+		}
+		job.Result = []byte(`{"done":true}`)
+		return nil
+	})
+
+	enqueue := func(name string, delay time.Duration) *models.Job {
+		job := &models.Job{UserID: user.ID, Type: "test.queue", RunAt: q.clock().Add(delay), MaxAttempts: 3}
+		require.NoError(t, service.EnqueueJob(context.Background(), db, job, testPayload{Name: name}))
+		return job
+	}
+	drain := func() {
+		for {
+			ran, err := q.RunNext(context.Background())
+			require.NoError(t, err)
+			if !ran {
+				return
+			}
+		}
+	}
+	status := func(job *models.Job) *models.Job {
+		stored, err := service.GetJob(context.Background(), db, job.ID, user.ID)
+		require.NoError(t, err)
+		return stored
+	}
+
+	t.Run("runs and retries jobs", func(t *testing.T) {
+		ok := enqueue("ok", 0)
+		flaky := enqueue("flaky", 0)
+		broken := enqueue("broken", 0)
+		panics := enqueue("panics", 0)
+		drain()
+		assert.Equal(t, []string{"ok", "flaky", "broken", "panics"}, runs)
+
+		stored := status(ok)
+		assert.Equal(t, models.JobStatusSucceeded, stored.Status)
+		assert.JSONEq(t, `{"done":true}`, string(stored.Result))
+		assert.NotNil(t, stored.FinishedAt)
+
+		stored = status(flaky)
+		assert.Equal(t, models.JobStatusPending, stored.Status)
+		assert.Equal(t, "temporary failure", stored.LastError)
+		assert.WithinDuration(t, now.Add(time.Minute), stored.RunAt, time.Second)
+		assert.Equal(t, models.JobStatusFailed, status(broken).Status, "permanent errors are not retried")
+		stored = status(panics)
+		assert.Equal(t, models.JobStatusPending, stored.Status)
+		assert.Equal(t, "job panicked: boom", stored.LastError)
+
+		advance(time.Minute)
+		drain()
+		assert.Equal(t, []string{"ok", "flaky", "broken", "panics", "flaky", "panics"}, runs)
+		assert.Equal(t, models.JobStatusSucceeded, status(flaky).Status)
+		assert.Equal(t, 2, status(flaky).Attempts)
+
+		advance(2 * time.Minute)
+		drain()
+		stored = status(panics)
+		assert.Equal(t, models.JobStatusFailed, stored.Status, "after MaxAttempts")
+		assert.Equal(t, 3, stored.Attempts)
+	})
+
+	t.Run("delays scheduled jobs", func(t *testing.T) {
+		runs = nil
+		later := enqueue("later", time.Hour)
+		drain()
+		assert.Empty(t, runs)
+		advance(time.Hour)
+		drain()
+		assert.Equal(t, []string{"later"}, runs)
+		assert.Equal(t, models.JobStatusSucceeded, status(later).Status)
+	})
+
+	t.Run("runs abandoned jobs again", func(t *testing.T) {
+		runs = nil
+		job := enqueue("abandoned", 0)
+		claimed, err := service.ClaimJob(context.Background(), db, []string{"test.queue"}, now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, job.ID, claimed.ID)
+		drain()
+		assert.Empty(t, runs, "still running")
+
+		advance(time.Hour + time.Second)
+		drain()
+		assert.Equal(t, []string{"abandoned"}, runs)
+		assert.Equal(t, models.JobStatusSucceeded, status(job).Status)
+	})
+
+	t.Run("ignores other job types", func(t *testing.T) {
+		other := &models.Job{UserID: user.ID, Type: "test.other"}
+		require.NoError(t, service.EnqueueJob(context.Background(), db, other, nil))
+		drain()
+		assert.Equal(t, models.JobStatusPending, status(other).Status)
+	})
+
+	t.Run("lists the user's jobs", func(t *testing.T) {
+		jobs, err := service.ListJobs(context.Background(), db, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, jobs, 7)
+		_, err = service.GetJob(context.Background(), db, jobs[0].ID, user.ID+1)
+		assert.ErrorIs(t, err, service.ErrNotFound)
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
+	db, err := storage.NewBunDB(filePath)
+	require.NoError(t, err)
+
+	user := &models.User{Email: "jobs.shutdown@test.com", Password: "unused", FirstName: "Stan", LastName: "Shutdown"}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+		require.NoError(t, db.Close())
+	})
+
+	started := make(chan string, 2)
+	q := &Queue{
+		DB:              db,
+		Concurrency:     2,
+		PollInterval:    10 * time.Millisecond,
+		Backoff:         time.Minute,
+		MaxBackoff:      time.Hour,
+		Timeout:         time.Hour,
+		ShutdownTimeout: 200 * time.Millisecond,
+	}
+	Register(q, "test.shutdown", func(ctx context.Context, job *models.Job, payload testPayload) error {
+		started <- payload.Name
+		if payload.Name == "quick" {
+			// finishes within the shutdown timeout
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var enqueued []*models.Job
+	for _, name := range []string{"quick", "stuck"} {
+		job := &models.Job{UserID: user.ID, Type: "test.shutdown"}
+		require.NoError(t, service.EnqueueJob(context.Background(), db, job, testPayload{Name: name}))
+		enqueued = append(enqueued, job)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	<-started
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queue did not stop")
+	}
+
+	quick, err := service.GetJob(context.Background(), db, enqueued[0].ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusSucceeded, quick.Status)
+	stuck, err := service.GetJob(context.Background(), db, enqueued[1].ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusPending, stuck.Status, "interrupted jobs run again")
+	assert.Zero(t, stuck.Attempts)
+}
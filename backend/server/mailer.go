@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/mailer"
+)
+
+var Mailer mailer.Mailer
+
+func init() {
+	m, err := mailer.New(config.Current.Mail)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create mailer")
+	}
+	Mailer = m
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// FileMailer writes every message as an .eml file into a directory instead
+// of sending it. Useful for local development and tests.
+type FileMailer struct {
+	Dir  string
+	from string
+	seq  atomic.Int64
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{Dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().UTC().Format("20060102T150405"), m.seq.Add(1), recipient)
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, formatMessage(m.from, msg), 0o600); err != nil {
+		return err
+	}
+
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Str("file", path).Msg("email written to file")
+	return nil
+}
+
+// LogMailer logs messages, including their body, instead of sending them.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	log.Info().
+		Str("from", m.from).
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("email not sent (log mailer)")
+	return nil
+}
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func init() {
+	// report validation failures with the JSON or query field names clients send
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "" {
+				name = strings.SplitN(field.Tag.Get("form"), ",", 2)[0]
+			}
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// HTTPError is an error that already knows how it should be rendered.
+type HTTPError struct {
+	Status  int
+	Code    string
+	Message string
+	Details []models.FieldError
+	Err     error
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func NewHTTPError(status int, code, message string) *HTTPError {
+	return &HTTPError{Status: status, Code: code, Message: message}
+}
+
+// BadRequest is a shorthand for a 400 invalid_request error.
+func BadRequest(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, message)
+}
+
+// AccountDisabled is a shorthand for the 403 error answered to disabled
+// accounts.
+func AccountDisabled() *HTTPError {
+	return NewHTTPError(http.StatusForbidden, models.ErrorCodeAccountDisabled, "account disabled by an administrator")
+}
+
+// ValidationError converts an error returned by gin's binding into a 400
+// response listing every invalid field, without exposing validator internals.
+func ValidationError(err error) *HTTPError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		details := make([]models.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			details = append(details, models.FieldError{
+				Field:   fe.Field(),
+				Code:    fe.Tag(),
+				Message: fieldErrorMessage(fe),
+			})
+		}
+		return &HTTPError{
+			Status:  http.StatusBadRequest,
+			Code:    models.ErrorCodeValidation,
+			Message: "invalid request body",
+			Details: details,
+			Err:     err,
+		}
+	}
+
+	httpErr := &HTTPError{
+		Status:  http.StatusBadRequest,
+		Code:    models.ErrorCodeInvalidRequest,
+		Message: "invalid request body",
+		Err:     err,
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		httpErr.Details = []models.FieldError{{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type.String()),
+		}}
+	}
+	return httpErr
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fe.Field() + " is required"
+	case "email":
+		return fe.Field() + " must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters long", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	default:
+		return fe.Field() + " is invalid"
+	}
+}
+
+// toHTTPError maps any error to the response that should be sent for it.
+// Service error kinds get their own statuses; anything unknown is a 500 whose
+// cause is logged but never sent to the client.
+func toHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	var serviceErr *service.Error
+	if errors.As(err, &serviceErr) {
+		switch {
+		case errors.Is(serviceErr.Kind, service.ErrNotFound):
+			return &HTTPError{Status: http.StatusNotFound, Code: models.ErrorCodeNotFound, Message: serviceErr.Message, Err: err}
+		case errors.Is(serviceErr.Kind, service.ErrConflict):
+			return &HTTPError{Status: http.StatusConflict, Code: models.ErrorCodeConflict, Message: serviceErr.Message, Err: err}
+		case errors.Is(serviceErr.Kind, service.ErrForbidden):
+			return &HTTPError{Status: http.StatusForbidden, Code: models.ErrorCodeForbidden, Message: serviceErr.Message, Err: err}
+		case errors.Is(serviceErr.Kind, service.ErrInvalid):
+			return &HTTPError{Status: http.StatusBadRequest, Code: models.ErrorCodeInvalidRequest, Message: serviceErr.Message, Err: err}
+		}
+	}
+
+	switch {
+	case errors.Is(err, service.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return &HTTPError{Status: http.StatusNotFound, Code: models.ErrorCodeNotFound, Message: "resource not found", Err: err}
+	case errors.Is(err, service.ErrConflict):
+		return &HTTPError{Status: http.StatusConflict, Code: models.ErrorCodeConflict, Message: "resource already exists", Err: err}
+	case errors.Is(err, service.ErrForbidden):
+		return &HTTPError{Status: http.StatusForbidden, Code: models.ErrorCodeForbidden, Message: "forbidden", Err: err}
+	}
+
+	return &HTTPError{Status: http.StatusInternalServerError, Code: models.ErrorCodeInternal, Message: "internal server error", Err: err}
+}
+
+func writeError(c *gin.Context, err error) {
+	httpErr := toHTTPError(err)
+	if httpErr.Status >= http.StatusInternalServerError {
+		log.Ctx(c).Err(err).Msg("request failed")
+	}
+	if httpErr.RetryAfter > 0 {
+		c.Header("Retry-After", retryAfterSeconds(httpErr.RetryAfter))
+	}
+
+	c.AbortWithStatusJSON(httpErr.Status, models.ErrorResponse{
+		Code:    httpErr.Code,
+		Error:   httpErr.Message,
+		Details: httpErr.Details,
+	})
+}
+
+// AbortWithError records err on the context and writes the matching
+// ErrorResponse. Handlers should return right after calling it.
+func AbortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	writeError(c, err)
+}
+
+// ErrorHandler renders errors that handlers attached with c.Error without
+// writing a response themselves.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		writeError(c, c.Errors.Last().Err)
+	}
+}
+
+// Recovery turns panics into a structured 500 response.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		AbortWithError(c, fmt.Errorf("panic: %v", recovered))
+	})
+}
+
+// NotFound answers requests that match no route.
+func NotFound(c *gin.Context) {
+	AbortWithError(c, NewHTTPError(http.StatusNotFound, models.ErrorCodeNotFound, "route not found"))
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+func TestErrorHandler(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedError  string
+	}{
+		"service not found": {
+			err:            &service.Error{Kind: service.ErrNotFound, Message: "expense not found", Err: sql.ErrNoRows},
+			expectedStatus: 404,
+			expectedCode:   models.ErrorCodeNotFound,
+			expectedError:  "expense not found",
+		},
+		"service conflict": {
+			err:            &service.Error{Kind: service.ErrConflict, Message: "email is already registered"},
+			expectedStatus: 409,
+			expectedCode:   models.ErrorCodeConflict,
+			expectedError:  "email is already registered",
+		},
+		"service forbidden": {
+			err:            fmt.Errorf("wrapped: %w", &service.Error{Kind: service.ErrForbidden, Message: "not your expense"}),
+			expectedStatus: 403,
+			expectedCode:   models.ErrorCodeForbidden,
+			expectedError:  "not your expense",
+		},
+		"bare no rows": {
+			err:            sql.ErrNoRows,
+			expectedStatus: 404,
+			expectedCode:   models.ErrorCodeNotFound,
+			expectedError:  "resource not found",
+		},
+		"http error": {
+			err:            BadRequest("invalid expense ID"),
+			expectedStatus: 400,
+			expectedCode:   models.ErrorCodeInvalidRequest,
+			expectedError:  "invalid expense ID",
+		},
+		"unknown error is hidden": {
+			err:            errors.New("disk I/O error"),
+			expectedStatus: 500,
+			expectedCode:   models.ErrorCodeInternal,
+			expectedError:  "internal server error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(ErrorHandler())
+			router.GET("/", func(c *gin.Context) {
+				_ = c.Error(tc.err)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			var response models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedCode, response.Code)
+			assert.Equal(t, tc.expectedError, response.Error)
+			assert.NotContains(t, w.Body.String(), "disk I/O")
+		})
+	}
+}
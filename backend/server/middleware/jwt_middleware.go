@@ -12,6 +12,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/models"
 	"github.com/Spiria-Digital/expense-manager/server/service"
 )
 
@@ -19,7 +20,17 @@ var (
 	singingKey = []byte("QUsIiwWh&8E8Qflbo^V1CoKqWn#mEndELkP")
 )
 
-const appName = "expense-manager-app"
+const (
+	appName = "expense-manager-app"
+
+	// apiAudience is the audience of access tokens. MFA challenge tokens use
+	// their own audience so they can never be used as access tokens.
+	apiAudience = "expense-manager-api"
+	mfaAudience = "expense-manager-mfa"
+
+	// APIKeyHeader carries a personal API key instead of a bearer token.
+	APIKeyHeader = "X-API-Key"
+)
 
 func validateAuthHeader(header string) (string, error) {
 	if header == "" {
@@ -36,12 +47,12 @@ func validateAuthHeader(header string) (string, error) {
 	return token, nil
 }
 
-func generateJWT(ownerId int, exp time.Time) (string, error) {
+func generateJWT(ownerId int, exp time.Time, audience string) (string, error) {
 	claims := &jwt.RegisteredClaims{
 		Subject:   strconv.Itoa(ownerId),
 		ExpiresAt: jwt.NewNumericDate(exp),
 		Issuer:    appName,
-		Audience:  jwt.ClaimStrings{"expense-manager-api"},
+		Audience:  jwt.ClaimStrings{audience},
 	}
 
 	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(singingKey)
@@ -49,20 +60,39 @@ func generateJWT(ownerId int, exp time.Time) (string, error) {
 
 func GenerateToken(owner int) (string, error) {
 	expiry := time.Now().Add(time.Hour * 24)
-	token, err := generateJWT(owner, expiry)
+	token, err := generateJWT(owner, expiry, apiAudience)
 	if err != nil {
 		return "", err
 	}
 	return token, nil
 }
 
-func validateJWT(signedToken string) (*jwt.RegisteredClaims, error) {
+// GenerateMFAChallengeToken returns the token proving that owner entered a
+// correct password and must now provide their second factor.
+func GenerateMFAChallengeToken(owner int, ttl time.Duration) (string, error) {
+	return generateJWT(owner, time.Now().Add(ttl), mfaAudience)
+}
+
+// ValidateMFAChallengeToken returns the user ID of a valid challenge token.
+func ValidateMFAChallengeToken(signedToken string) (int, error) {
+	claims, err := validateJWT(signedToken, mfaAudience)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+func validateJWT(signedToken, audience string) (*jwt.RegisteredClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&jwt.RegisteredClaims{},
 		func(token *jwt.Token) (interface{}, error) {
 			return singingKey, nil
-		})
+		},
+		jwt.WithAudience(audience),
+		jwt.WithIssuer(appName),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	)
 
 	if err != nil {
 		return nil, err
@@ -84,38 +114,120 @@ func validateJWT(signedToken string) (*jwt.RegisteredClaims, error) {
 	return claims, nil
 }
 
+func unauthorized(err error) *HTTPError {
+	return &HTTPError{
+		Status:  http.StatusUnauthorized,
+		Code:    models.ErrorCodeUnauthorized,
+		Message: "unauthorized",
+		Err:     err,
+	}
+}
+
+// JWTMiddleware authenticates the request with either a bearer token or a
+// personal API key sent in the X-API-Key header, and stores the user in the
+// context. Read-only keys are limited to safe methods.
 func JWTMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		authKey, err := validateAuthHeader(c.GetHeader("Authorization"))
 		if err != nil {
-			log.Err(err).Msg("failed to validate auth header")
-			c.AbortWithStatus(http.StatusUnauthorized)
+			log.Ctx(c).Err(err).Msg("failed to validate auth header")
+			AbortWithError(c, unauthorized(err))
 			return
 		}
 
-		claims, err := validateJWT(authKey)
+		claims, err := validateJWT(authKey, apiAudience)
 		if err != nil {
-			log.Err(err).Msg("failed to validate jwt")
-			c.AbortWithStatus(http.StatusUnauthorized)
+			log.Ctx(c).Err(err).Msg("failed to validate jwt")
+			AbortWithError(c, unauthorized(err))
 			return
 		}
 
 		ownerId, err := strconv.Atoi(claims.Subject)
 		if err != nil {
-			log.Err(err).Msg("failed to parse owner id")
-			c.AbortWithStatus(http.StatusUnauthorized)
+			log.Ctx(c).Err(err).Msg("failed to parse owner id")
+			AbortWithError(c, unauthorized(err))
 			return
 		}
 
 		db := c.MustGet("db").(*bun.DB)
 		user, err := service.GetUserById(c, db, ownerId)
 		if err != nil {
-			log.Err(err).Msg("failed to get user from db")
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			log.Ctx(c).Err(err).Msg("failed to get user from db")
+			if errors.Is(err, service.ErrNotFound) {
+				err = unauthorized(err)
+			}
+			AbortWithError(c, err)
+			return
+		}
+		if user.IsDisabled() {
+			AbortWithError(c, AccountDisabled())
 			return
 		}
 
 		c.Set("user", user)
+		logUser(c, user.ID)
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, token string) {
+	db := c.MustGet("db").(*bun.DB)
+	key, err := service.AuthenticateAPIKey(c, db, token)
+	if err != nil {
+		log.Ctx(c).Err(err).Msg("failed to validate api key")
+		if errors.Is(err, service.ErrInvalid) {
+			err = unauthorized(err)
+		}
+		AbortWithError(c, err)
+		return
+	}
+
+	if key.User.IsDisabled() {
+		AbortWithError(c, AccountDisabled())
+		return
+	}
+	if !key.CanWrite() && !isSafeMethod(c.Request.Method) {
+		AbortWithError(c, NewHTTPError(http.StatusForbidden, models.ErrorCodeForbidden, "API key is read-only"))
+		return
+	}
+
+	c.Set("user", key.User)
+	c.Set("apiKey", key)
+	logUser(c, key.User.ID)
+	c.Next()
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequireSession rejects requests authenticated with an API key, for
+// endpoints that manage credentials or the account itself. It must run after
+// JWTMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("apiKey"); ok {
+			AbortWithError(c, NewHTTPError(http.StatusForbidden, models.ErrorCodeForbidden, "this endpoint requires a login session"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects users who are not administrators. It must run after
+// JWTMiddleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*models.User)
+		if !user.IsAdmin {
+			AbortWithError(c, NewHTTPError(http.StatusForbidden, models.ErrorCodeForbidden, "administrator access required"))
+			return
+		}
 		c.Next()
 	}
 }
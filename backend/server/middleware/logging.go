@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID correlating the logs of a request. It is
+// taken from the caller, such as a proxy, when valid and generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+// loggerKey stores the request logger in the gin context, for logUser.
+const loggerKey = "logger"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func init() {
+	// code running outside of a request logs with the global logger
+	zerolog.DefaultContextLogger = &log.Logger
+}
+
+// RequestLogger stores in the request context a child of base carrying the
+// request ID, route and trace ID, then writes a JSON access log line once
+// the request is answered. Handlers log through it with log.Ctx(ctx), and
+// the user is added once authenticated.
+func RequestLogger(base zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		fields := base.With().
+			Str("request_id", requestID).
+			Str("method", c.Request.Method)
+		if route := c.FullPath(); route != "" {
+			fields = fields.Str("route", route)
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			fields = fields.Str("trace_id", span.TraceID().String())
+		}
+		ctx := fields.Logger().WithContext(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		logger := zerolog.Ctx(ctx)
+		c.Set(loggerKey, logger)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		event := logger.Info()
+		if status >= 500 {
+			event = logger.Error()
+		}
+		event.
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", c.Writer.Size()).
+			Str("client_ip", c.ClientIP()).
+			Str("user_agent", c.Request.UserAgent()).
+			Msg("request")
+	}
+}
+
+// logUser adds the authenticated user to the request logger.
+func logUser(c *gin.Context, userID int) {
+	if logger, ok := c.Get(loggerKey); ok {
+		logger.(*zerolog.Logger).UpdateContext(func(fields zerolog.Context) zerolog.Context {
+			return fields.Int("user_id", userID)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(RequestLogger(zerolog.New(&output)))
+	router.GET("/things/:id", func(c *gin.Context) {
+		logUser(c, 7)
+		log.Ctx(c).Info().Msg("handling")
+		c.Status(201)
+	})
+	serve := func(requestID string) (*httptest.ResponseRecorder, []map[string]any) {
+		output.Reset()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/things/42", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		router.ServeHTTP(w, req)
+
+		var lines []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &fields))
+			lines = append(lines, fields)
+		}
+		return w, lines
+	}
+
+	w, lines := serve("")
+	requestID := w.Header().Get(RequestIDHeader)
+	assert.Len(t, requestID, 36)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "handling", lines[0]["message"])
+	for _, fields := range lines {
+		assert.Equal(t, requestID, fields["request_id"])
+		assert.Equal(t, "/things/:id", fields["route"])
+		assert.Equal(t, float64(7), fields["user_id"])
+	}
+	access := lines[1]
+	assert.Equal(t, "request", access["message"])
+	assert.Equal(t, "info", access["level"])
+	assert.Equal(t, float64(201), access["status"])
+	assert.Equal(t, "/things/42", access["path"])
+	assert.Contains(t, access, "latency")
+
+	t.Run("propagates the caller's request ID", func(t *testing.T) {
+		w, lines := serve("edge-1234:5")
+		assert.Equal(t, "edge-1234:5", w.Header().Get(RequestIDHeader))
+		assert.Equal(t, "edge-1234:5", lines[1]["request_id"])
+
+		w, _ = serve("not an id\n")
+		assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+	})
+
+}
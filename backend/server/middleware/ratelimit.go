@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// Rate describes a token bucket: Burst requests can be made at once, then one
+// more every Interval.
+type Rate struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// RateLimitStore keeps the token buckets. The in-memory store is enough for a
+// single instance; a shared store is needed when running several replicas.
+type RateLimitStore interface {
+	// Take removes a token from the bucket identified by key. When the bucket
+	// is empty it returns false and how long to wait for the next token.
+	Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   Rate
+}
+
+// MemoryRateLimitStore is a RateLimitStore backed by a map. Full buckets are
+// dropped periodically so the map does not grow without bound.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.rate = rate
+	b.tokens = refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) * float64(rate.Interval))
+	return false, wait, nil
+}
+
+func refill(b *bucket, now time.Time) float64 {
+	if b.rate.Interval <= 0 {
+		return float64(b.rate.Burst)
+	}
+	elapsed := now.Sub(b.last)
+	return math.Min(float64(b.rate.Burst), b.tokens+float64(elapsed)/float64(b.rate.Interval))
+}
+
+// sweep removes buckets that have refilled completely, at most once a minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if refill(b, now) >= float64(b.rate.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimitKeyFunc returns the bucket key of a request, or false when the
+// request should not be limited.
+type RateLimitKeyFunc func(c *gin.Context) (string, bool)
+
+// ClientIPKey limits requests per client IP.
+func ClientIPKey(prefix string) RateLimitKeyFunc {
+	return func(c *gin.Context) (string, bool) {
+		return prefix + ":ip:" + c.ClientIP(), true
+	}
+}
+
+// EmailKey limits requests per account, using the "email" field of the JSON
+// body. The body is restored so handlers can still bind it.
+func EmailKey(prefix string) RateLimitKeyFunc {
+	return func(c *gin.Context) (string, bool) {
+		if c.Request.Body == nil {
+			return "", false
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			return "", false
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var payload struct {
+			Email string `json:"email"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.Email == "" {
+			return "", false
+		}
+		return prefix + ":account:" + strings.ToLower(strings.TrimSpace(payload.Email)), true
+	}
+}
+
+// RateLimit rejects requests with 429 once the bucket selected by key is
+// empty. A zero burst disables the limit. Store failures let the request
+// through rather than locking everyone out.
+func RateLimit(store RateLimitStore, rate Rate, key RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rate.Burst <= 0 {
+			c.Next()
+			return
+		}
+
+		k, ok := key(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		allowed, wait, err := store.Take(c, k, rate)
+		if err != nil {
+			log.Ctx(c).Err(err).Str("key", k).Msg("rate limit store error")
+			c.Next()
+			return
+		}
+		if !allowed {
+			AbortWithError(c, TooManyRequests(models.ErrorCodeRateLimited, "too many requests, try again later", wait))
+			return
+		}
+		c.Next()
+	}
+}
+
+// TooManyRequests builds a 429 error and sets the Retry-After header once it
+// is rendered.
+func TooManyRequests(code, message string, retryAfter time.Duration) *HTTPError {
+	return &HTTPError{
+		Status:     http.StatusTooManyRequests,
+		Code:       code,
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
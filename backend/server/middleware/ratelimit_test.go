@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	rate := Rate{Burst: 3, Interval: 10 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := store.Take(context.Background(), "a", rate)
+		require.NoError(t, err)
+		assert.True(t, allowed, "request %d is within the burst", i)
+	}
+
+	allowed, wait, err := store.Take(context.Background(), "a", rate)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// other keys have their own bucket
+	allowed, _, err = store.Take(context.Background(), "b", rate)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// one token is refilled per interval
+	now = now.Add(10 * time.Second)
+	allowed, _, _ = store.Take(context.Background(), "a", rate)
+	assert.True(t, allowed)
+	allowed, _, _ = store.Take(context.Background(), "a", rate)
+	assert.False(t, allowed)
+
+	// full buckets are swept
+	now = now.Add(time.Hour)
+	_, _, _ = store.Take(context.Background(), "c", rate)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryRateLimitStore()
+	router := gin.New()
+	router.POST("/login",
+		RateLimit(store, Rate{Burst: 2, Interval: time.Minute}, EmailKey("login")),
+		func(c *gin.Context) {
+			// the body must still be readable after the key was extracted
+			body, _ := io.ReadAll(c.Request.Body)
+			c.String(200, string(body))
+		})
+
+	login := func(email string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(map[string]string{"email": email, "password": "secret"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/login", bytes.NewBuffer(payload)))
+		return w
+	}
+
+	w := login("victim@test.com")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "victim@test.com")
+	assert.Equal(t, 200, login("VICTIM@test.com ").Code, "emails are normalized")
+
+	w = login("victim@test.com")
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	var response models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrorCodeRateLimited, response.Code)
+
+	assert.Equal(t, 200, login("other@test.com").Code)
+}
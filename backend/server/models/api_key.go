@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// API key scopes. Read keys can only make safe (GET) requests.
+const (
+	APIKeyScopeRead  = "read"
+	APIKeyScopeWrite = "write"
+)
+
+// APIKey lets scripts authenticate as a user without their password. Only
+// the SHA-256 hash of the key is stored; Prefix is kept in clear text so
+// users can tell their keys apart.
+type APIKey struct {
+	bun.BaseModel
+
+	ID         int        `bun:",pk,autoincrement" json:"id"`
+	UserID     int        `bun:",notnull" json:"-"`
+	Name       string     `bun:",notnull,type:varchar(100)" json:"name"`
+	Prefix     string     `bun:",notnull,type:varchar(16)" json:"prefix"`
+	KeyHash    string     `bun:",unique,notnull,type:varchar(64)" json:"-"`
+	Scope      string     `bun:",notnull,type:varchar(16)" json:"scope"`
+	ExpiresAt  *time.Time `bun:",nullzero" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `bun:",nullzero" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `bun:",nullzero" json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `bun:",notnull,default:current_timestamp" json:"createdAt"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id" json:"-"`
+}
+
+// CanWrite reports whether the key may change data.
+func (k *APIKey) CanWrite() bool {
+	return k.Scope == APIKeyScopeWrite
+}
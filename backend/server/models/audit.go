@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Audited actions on user accounts.
+const (
+	AuditUserCreated       = "user.created"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserPromoted      = "user.promoted"
+	AuditUserDemoted       = "user.demoted"
+	AuditUserDisabled      = "user.disabled"
+	AuditUserEnabled       = "user.enabled"
+	AuditAccountExported   = "account.exported"
+	AuditAccountErased     = "account.erased"
+)
+
+// Audit actors.
+const (
+	// AuditActorUser is the user the event is about, acting on their own
+	// account.
+	AuditActorUser = "user"
+	// AuditActorAdmin is an administrator using the bun CLI.
+	AuditActorAdmin = "admin"
+)
+
+// AuditEvent records an action taken on a user account. When the account is
+// erased, its events are kept without UserID and Details.
+type AuditEvent struct {
+	bun.BaseModel
+
+	ID int `bun:",pk,autoincrement" json:"id"`
+	// UserID is the user the event is about, or 0 once they are erased.
+	UserID  int               `bun:",nullzero" json:"-"`
+	Action  string            `bun:",notnull,type:varchar(64)" json:"action"`
+	Actor   string            `bun:",notnull,type:varchar(16)" json:"actor" enums:"user,admin"`
+	Details map[string]string `bun:",nullzero,type:json" json:"details,omitempty"`
+
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+}
@@ -2,9 +2,13 @@ package models
 
 import "github.com/uptrace/bun"
 
+// Category classifies expenses. Categories are shared by the members of an
+// organization, or by the users without organization when OrganizationID is
+// zero, and their names are unique within it.
 type Category struct {
 	bun.BaseModel
 
-	ID   int    `bun:",pk,autoincrement" json:"id,omitempty"`
-	Name string `bun:",unique,notnull" json:"name"`
+	ID             int    `bun:",pk,autoincrement" json:"id,omitempty"`
+	OrganizationID int    `bun:",nullzero" json:"-"`
+	Name           string `bun:",notnull" json:"name"`
 }
@@ -1,24 +1,154 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/uptrace/bun"
 )
 
+// Expense types. The amount of mileage and per-diem expenses is computed by
+// the server from the rate tables.
+const (
+	ExpenseTypeReceipt = "receipt"
+	ExpenseTypeMileage = "mileage"
+	ExpenseTypePerDiem = "per_diem"
+)
+
 type Expense struct {
 	bun.BaseModel
 
 	ID         int `bun:",pk,autoincrement" json:"id,omitempty"`
 	OwnerID    int `bun:",notnull"`
-	CategoryID int `bun:"category_id" json:"categoryId,omitempty"`
+	CategoryID int `bun:"category_id,nullzero" json:"categoryId,omitempty"`
+	// OrganizationID is the organization the owner belonged to when the
+	// expense was recorded.
+	OrganizationID int `bun:",nullzero" json:"organizationId,omitempty"`
+
+	Title       string `bun:",notnull,type:varchar(255)" json:"title"`
+	Description string `bun:",type:text" json:"description"`
+	Merchant    string `bun:",type:varchar(255)" json:"merchant"`
+	// MerchantID is the known merchant Merchant was matched with.
+	MerchantID int `bun:",nullzero" json:"merchantId,omitempty"`
+	// ReceiptID is the uploaded receipt scan attached to the expense.
+	ReceiptID int       `bun:",nullzero" json:"receiptId,omitempty"`
+	Date      time.Time `bun:",notnull,type:date" json:"date"`
+	Amount    Amount    `bun:",notnull,type:numeric(10,2)" json:"amount"`
+
+	Type string `bun:",notnull,type:varchar(16),default:'receipt'" json:"type"`
+	// Rate is the per-kilometre or daily rate in effect when the amount was
+	// computed, kept so later rate changes do not alter past claims.
+	Rate float64 `bun:",nullzero,type:real" json:"rate,omitempty"`
+
+	// mileage
+	DistanceKm float64 `bun:",nullzero,type:real" json:"distanceKm,omitempty"`
+	Vehicle    string  `bun:",nullzero,type:varchar(32)" json:"vehicle,omitempty"`
 
-	Title       string    `bun:",notnull,type:varchar(255)" json:"title"`
-	Description string    `bun:",type:text" json:"description"`
-	Merchant    string    `bun:",type:varchar(255)" json:"merchant"`
-	Date        time.Time `bun:",notnull,type:date" json:"date"`
-	Amount      float64   `bun:",notnull,type:numeric(10,2)" json:"amount"`
+	// per diem
+	Destination   string `bun:",nullzero,type:varchar(255)" json:"destination,omitempty"`
+	Days          int    `bun:",nullzero" json:"days,omitempty"`
+	MealsProvided int    `bun:",notnull,default:0" json:"mealsProvided,omitempty"`
+
+	// CategorySource tells how the category was chosen when it was assigned
+	// automatically on creation. It is not stored.
+	CategorySource string `bun:"-" json:"-"`
 
 	Category *Category `bun:"rel:belongs-to,join:category_id=id" json:"-"`
 	Owner    *User     `bun:"rel:belongs-to,join:owner_id=id" json:"-"`
+
+	Organization *Organization `bun:"rel:belongs-to,join:organization_id=id" json:"-"`
+
+	Violations []PolicyViolation `bun:"rel:has-many,join:id=expense_id" json:"violations,omitempty"`
+}
+
+// ExpenseResponse is the view clients get of an expense, kept separate from
+// the table so schema changes do not leak into the API.
+type ExpenseResponse struct {
+	ID             int       `json:"id"`
+	OwnerID        int       `json:"ownerId"`
+	CategoryID     int       `json:"categoryId,omitempty"`
+	MerchantID     int       `json:"merchantId,omitempty"`
+	ReceiptID      int       `json:"receiptId,omitempty"`
+	OrganizationID int       `json:"organizationId,omitempty"`
+	Type           string    `json:"type" enums:"receipt,mileage,per_diem"`
+	Title          string    `json:"title"`
+	Description    string    `json:"description"`
+	Merchant       string    `json:"merchant"`
+	Date           time.Time `json:"date"`
+	Amount         float64   `json:"amount"`
+
+	Rate          float64 `json:"rate,omitempty"`
+	DistanceKm    float64 `json:"distanceKm,omitempty"`
+	Vehicle       string  `json:"vehicle,omitempty"`
+	Destination   string  `json:"destination,omitempty"`
+	Days          int     `json:"days,omitempty"`
+	MealsProvided int     `json:"mealsProvided,omitempty"`
+
+	Violations []PolicyViolation `json:"violations,omitempty"`
+
+	// CategorySource is set in the response to the creation of an expense
+	// when its category was assigned automatically.
+	CategorySource string `json:"categorySource,omitempty" enums:"merchant_history,merchant,title_history"`
+
+	// Category and Owner are only set when the relations were loaded.
+	Category *Category    `json:"category,omitempty"`
+	Owner    *UserSummary `json:"owner,omitempty"`
+}
+
+func (e *Expense) Response() ExpenseResponse {
+	response := ExpenseResponse{
+		ID:             e.ID,
+		OwnerID:        e.OwnerID,
+		CategoryID:     e.CategoryID,
+		MerchantID:     e.MerchantID,
+		ReceiptID:      e.ReceiptID,
+		OrganizationID: e.OrganizationID,
+		Type:           e.Type,
+		Title:          e.Title,
+		Description:    e.Description,
+		Merchant:       e.Merchant,
+		Date:           e.Date,
+		Amount:         float64(e.Amount),
+		Rate:           e.Rate,
+		DistanceKm:     e.DistanceKm,
+		Vehicle:        e.Vehicle,
+		Destination:    e.Destination,
+		Days:           e.Days,
+		MealsProvided:  e.MealsProvided,
+		Violations:     e.Violations,
+		CategorySource: e.CategorySource,
+		Category:       e.Category,
+	}
+	if e.Owner != nil {
+		owner := e.Owner.Summary()
+		response.Owner = &owner
+	}
+	return response
+}
+
+// Amount is a monetary amount. SQLite gives whole amounts stored in a NUMERIC
+// column back as integers, which cannot be scanned into a plain float64.
+type Amount float64
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v)
+	case float64:
+		*a = Amount(v)
+	case []byte:
+		return a.Scan(string(v))
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*a = Amount(f)
+	default:
+		return fmt.Errorf("cannot scan %T into an amount", src)
+	}
+	return nil
 }
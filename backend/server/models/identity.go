@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect provider.
+type UserIdentity struct {
+	bun.BaseModel
+
+	ID        int       `bun:",pk,autoincrement"`
+	UserID    int       `bun:",notnull"`
+	Issuer    string    `bun:",notnull,unique:user_identities_issuer_subject,type:varchar(255)"`
+	Subject   string    `bun:",notnull,unique:user_identities_issuer_subject,type:varchar(255)"`
+	Email     string    `bun:",notnull"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp"`
+	LastLogin time.Time `bun:",nullzero"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id"`
+}
+
+// OIDCLoginState remembers a single sign-on attempt between the redirect to
+// the provider and the callback. Only the SHA-256 hash of the state is
+// stored; the nonce and PKCE verifier never leave the server.
+type OIDCLoginState struct {
+	bun.BaseModel `bun:"table:oidc_login_states"`
+
+	ID           int       `bun:",pk,autoincrement"`
+	StateHash    string    `bun:",unique,notnull,type:varchar(64)"`
+	Nonce        string    `bun:",notnull,type:varchar(64)"`
+	CodeVerifier string    `bun:",notnull,type:varchar(128)"`
+	ExpiresAt    time.Time `bun:",notnull"`
+	CreatedAt    time.Time `bun:",notnull,default:current_timestamp"`
+}
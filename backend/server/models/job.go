@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Job types.
+const (
+	JobTypeReceiptScan = "receipt.scan"
+)
+
+// Job is a unit of background work stored in the database until a worker
+// runs it. Failed runs are retried with backoff until MaxAttempts is reached.
+type Job struct {
+	bun.BaseModel
+
+	ID int `bun:",pk,autoincrement" json:"id"`
+	// UserID is the user the job was created for, who can follow it. It is 0
+	// for maintenance jobs.
+	UserID      int             `bun:",nullzero" json:"-"`
+	Type        string          `bun:",notnull,type:varchar(64)" json:"type"`
+	Payload     json.RawMessage `bun:",notnull,type:json" json:"payload" swaggertype:"object"`
+	Status      string          `bun:",notnull,type:varchar(16)" json:"status" enums:"pending,running,succeeded,failed"`
+	Attempts    int             `bun:",notnull,default:0" json:"attempts"`
+	MaxAttempts int             `bun:",notnull" json:"maxAttempts"`
+	// RunAt is when the job is due, or due again after a failed attempt.
+	RunAt time.Time `bun:",notnull" json:"runAt"`
+	// LockedAt is when the current attempt started.
+	LockedAt  *time.Time `bun:",nullzero" json:"-"`
+	LastError string     `bun:",nullzero,type:text" json:"-"`
+	// Result is set by the handlers whose jobs produce something for the user.
+	Result     json.RawMessage `bun:",nullzero,type:json" json:"result,omitempty" swaggertype:"object"`
+	CreatedAt  time.Time       `bun:",notnull,default:current_timestamp" json:"createdAt"`
+	FinishedAt *time.Time      `bun:",nullzero" json:"finishedAt,omitempty"`
+}
+
+// ReceiptScanPayload is the payload of JobTypeReceiptScan jobs.
+type ReceiptScanPayload struct {
+	ReceiptID int `json:"receiptId"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Merchant is the canonical name of a merchant. The merchant typed on an
+// expense is matched against the name and aliases of the merchants after
+// normalization, which ignores case, punctuation and store numbers. Like
+// categories, merchants are shared within an organization.
+type Merchant struct {
+	bun.BaseModel
+
+	ID             int    `bun:",pk,autoincrement" json:"id"`
+	OrganizationID int    `bun:",nullzero" json:"-"`
+	Name           string `bun:",notnull,type:varchar(255)" json:"name"`
+	// Key is the normalized name.
+	Key string `bun:",notnull,type:varchar(255)" json:"-"`
+	// DefaultCategoryID is assigned to new expenses at the merchant when the
+	// user has no history with it.
+	DefaultCategoryID int       `bun:",nullzero" json:"defaultCategoryId,omitempty"`
+	CreatedAt         time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+
+	Aliases []MerchantAlias `bun:"rel:has-many,join:id=merchant_id" json:"aliases" swaggertype:"array,string"`
+}
+
+// MerchantAlias is another name of a merchant, such as the label it uses on
+// card statements. It has the organization of its merchant, within which
+// keys are unique.
+type MerchantAlias struct {
+	bun.BaseModel
+
+	ID             int    `bun:",pk,autoincrement"`
+	MerchantID     int    `bun:",notnull"`
+	OrganizationID int    `bun:",nullzero"`
+	Alias          string `bun:",notnull,type:varchar(255)"`
+	Key            string `bun:",notnull,type:varchar(255)"`
+}
+
+func (a MerchantAlias) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.Alias)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Membership roles, from most to least privileged. Owners manage members and
+// roles, managers can see the whole team's spend and members only their own.
+const (
+	RoleOwner   = "owner"
+	RoleManager = "manager"
+	RoleMember  = "member"
+)
+
+// Organization is a team sharing expense visibility. Expenses recorded while a
+// user belongs to an organization are attributed to it.
+type Organization struct {
+	bun.BaseModel
+
+	ID        int       `bun:",pk,autoincrement" json:"id"`
+	Name      string    `bun:",notnull,type:varchar(255)" json:"name"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+}
+
+// OrganizationMember links a user to their organization. A user belongs to at
+// most one organization.
+type OrganizationMember struct {
+	bun.BaseModel
+
+	ID             int       `bun:",pk,autoincrement" json:"-"`
+	OrganizationID int       `bun:",notnull" json:"organizationId"`
+	UserID         int       `bun:",unique,notnull" json:"userId"`
+	Role           string    `bun:",notnull,type:varchar(16)" json:"role"`
+	CreatedAt      time.Time `bun:",notnull,default:current_timestamp" json:"joinedAt"`
+
+	Organization *Organization `bun:"rel:belongs-to,join:organization_id=id" json:"-"`
+	User         *User         `bun:"rel:belongs-to,join:user_id=id" json:"-"`
+}
+
+// OrganizationInvitation invites the owner of Email to join an organization
+// with Role. Users only become members by accepting it, signed in with that
+// address. Inviting the same address again replaces the invitation.
+type OrganizationInvitation struct {
+	bun.BaseModel
+
+	ID             int    `bun:",pk,autoincrement" json:"id"`
+	OrganizationID int    `bun:",notnull,unique:organization_invitations_organization_id_email" json:"organizationId"`
+	Email          string `bun:",notnull,unique:organization_invitations_organization_id_email,type:varchar(255)" json:"email"`
+	Role           string `bun:",notnull,type:varchar(16)" json:"role"`
+	// InvitedBy is the owner who sent the invitation, or 0 once they are
+	// deleted.
+	InvitedBy int       `bun:",nullzero" json:"-"`
+	ExpiresAt time.Time `bun:",notnull" json:"expiresAt"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+
+	// Organization is only set in the invitations listed to the invitee.
+	Organization *Organization `bun:"rel:belongs-to,join:organization_id=id" json:"organization,omitempty"`
+}
+
+// CanViewTeam reports whether the member may see other members' expenses.
+func (m *OrganizationMember) CanViewTeam() bool {
+	return m.Role == RoleOwner || m.Role == RoleManager
+}
+
+// CanManageMembers reports whether the member may add, remove and change the
+// role of other members.
+func (m *OrganizationMember) CanManageMembers() bool {
+	return m.Role == RoleOwner
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// PolicyRule flags expenses matching all of its conditions. Rules are
+// evaluated whenever an expense of their organization is created or updated.
+type PolicyRule struct {
+	bun.BaseModel
+
+	ID             int               `bun:",pk,autoincrement" json:"id"`
+	OrganizationID int               `bun:",nullzero" json:"-"`
+	Name           string            `bun:",notnull,type:varchar(255)" json:"name"`
+	Message        string            `bun:",notnull,type:text" json:"message"`
+	Severity       string            `bun:",notnull,type:varchar(16),default:'warning'" json:"severity"`
+	Enabled        bool              `bun:",notnull" json:"enabled"`
+	Conditions     []PolicyCondition `bun:",notnull,type:json" json:"conditions"`
+	CreatedAt      time.Time         `bun:",notnull,default:current_timestamp" json:"createdAt"`
+	UpdatedAt      time.Time         `bun:",notnull,default:current_timestamp" json:"updatedAt"`
+}
+
+// PolicyCondition compares a field of an expense with Value, for example
+// {"field": "amount", "op": "gt", "value": 75} or
+// {"field": "weekday", "op": "in", "value": ["saturday", "sunday"]}.
+type PolicyCondition struct {
+	Field    string          `json:"field" binding:"required"`
+	Operator string          `json:"op" binding:"required"`
+	Value    json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+// PolicyViolation records that an expense broke a rule. The rule name,
+// message and severity are copied so the violation reads the same after the
+// rule is edited.
+type PolicyViolation struct {
+	bun.BaseModel
+
+	ID        int       `bun:",pk,autoincrement" json:"-"`
+	ExpenseID int       `bun:",notnull" json:"-"`
+	RuleID    int       `bun:",notnull" json:"ruleId"`
+	RuleName  string    `bun:",notnull,type:varchar(255)" json:"ruleName"`
+	Message   string    `bun:",notnull,type:text" json:"message"`
+	Severity  string    `bun:",notnull,type:varchar(16)" json:"severity"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// MileageRate is the amount reimbursed per kilometre driven with a vehicle.
+// Rates are set per organization, like categories.
+type MileageRate struct {
+	bun.BaseModel
+
+	ID             int       `bun:",pk,autoincrement" json:"-"`
+	OrganizationID int       `bun:",nullzero" json:"-"`
+	Vehicle        string    `bun:",notnull,type:varchar(32)" json:"vehicle"`
+	RatePerKm      float64   `bun:",notnull,type:real" json:"ratePerKm"`
+	UpdatedAt      time.Time `bun:",notnull,default:current_timestamp" json:"updatedAt"`
+}
+
+// PerDiemRate is the daily allowance for travelling to a destination.
+// MealRate is deducted for every meal provided during the trip.
+type PerDiemRate struct {
+	bun.BaseModel
+
+	ID             int       `bun:",pk,autoincrement" json:"-"`
+	OrganizationID int       `bun:",nullzero" json:"-"`
+	Destination    string    `bun:",notnull,type:varchar(255)" json:"destination"`
+	DailyRate      float64   `bun:",notnull,type:real" json:"dailyRate"`
+	MealRate       float64   `bun:",notnull,type:real,default:0" json:"mealRate"`
+	UpdatedAt      time.Time `bun:",notnull,default:current_timestamp" json:"updatedAt"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ReceiptScanPending    = "pending"
+	ReceiptScanProcessing = "processing"
+	ReceiptScanDone       = "done"
+	ReceiptScanFailed     = "failed"
+)
+
+// ReceiptScan is an uploaded receipt waiting to be, or already, read by the
+// receipt scanner. The upload request returns as soon as the row is stored.
+type ReceiptScan struct {
+	bun.BaseModel
+
+	ID          int    `bun:",pk,autoincrement" json:"id"`
+	UserID      int    `bun:",notnull" json:"-"`
+	FileName    string `bun:",notnull,type:varchar(255)" json:"fileName"`
+	ContentType string `bun:",notnull,type:varchar(128)" json:"contentType"`
+	Size        int    `bun:",notnull" json:"size"`
+	Content     []byte `bun:",notnull" json:"-"`
+	Status      string `bun:",notnull,type:varchar(16)" json:"status" enums:"pending,processing,done,failed"`
+	// Draft is the expense read from the receipt, once the scan is done.
+	Draft       *ReceiptDraft `bun:",type:json" json:"draft,omitempty"`
+	Error       string        `bun:",nullzero,type:text" json:"error,omitempty"`
+	CreatedAt   time.Time     `bun:",notnull,default:current_timestamp" json:"createdAt"`
+	CompletedAt *time.Time    `bun:",nullzero" json:"completedAt,omitempty"`
+}
+
+// ReceiptDraft is what could be read from a receipt. Expense can be reviewed
+// and posted as is to create the expense.
+type ReceiptDraft struct {
+	Expense    ExpenseDraft      `json:"expense"`
+	Confidence ReceiptConfidence `json:"confidence"`
+	// Text is the text extracted from the receipt.
+	Text string `json:"text"`
+}
+
+// ExpenseDraft has the fields of an expense creation request that can be
+// read from a receipt. Fields that could not be read are left empty.
+type ExpenseDraft struct {
+	Title      string  `json:"title"`
+	Merchant   string  `json:"merchant,omitempty"`
+	Date       string  `json:"date,omitempty" example:"2025-04-12"`
+	Amount     float64 `json:"amount,omitempty"`
+	CategoryID int     `json:"categoryId,omitempty"`
+}
+
+// ReceiptConfidence scores, from 0 to 1, how likely each field of the draft
+// is to be right. A field that could not be read scores 0.
+type ReceiptConfidence struct {
+	Amount   float64 `json:"amount"`
+	Date     float64 `json:"date"`
+	Merchant float64 `json:"merchant"`
+	Category float64 `json:"category"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the user
+// lost their authenticator. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	bun.BaseModel
+
+	ID        int       `bun:",pk,autoincrement"`
+	UserID    int       `bun:",notnull"`
+	CodeHash  string    `bun:",unique,notnull,type:varchar(64)"`
+	UsedAt    time.Time `bun:",nullzero"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id"`
+}
@@ -1,6 +1,31 @@
 package models
 
+// Machine-readable error codes returned in ErrorResponse.Code. Clients should
+// branch on these rather than on the human-readable Error text.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeValidation       = "validation_failed"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeEmailNotVerified = "email_not_verified"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeAccountLocked    = "account_locked"
+	ErrorCodeAccountDisabled  = "account_disabled"
+	ErrorCodeInternal         = "internal_error"
+)
+
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Code    string       `json:"code"`
+	Error   string       `json:"error"`
+	Message string       `json:"message,omitempty"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes a single invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -11,19 +12,89 @@ type User struct {
 
 	ID        int    `bun:",pk,autoincrement" json:"id"`
 	Email     string `bun:",unique,notnull" json:"email" binding:"required"`
-	Password  string `bun:",type:varchar(255),notnull" binding:"required"`
+	Password  string `bun:",type:varchar(255),notnull" json:"-" binding:"required"`
 	FirstName string `bun:",notnull" json:"first_name" binding:"required"`
 	LastName  string `bun:",notnull" json:"last_name" binding:"required"`
 	IsAdmin   bool   `bun:",notnull,default:false"`
+
+	DefaultCurrency string `bun:",notnull,type:varchar(3),default:'USD'" json:"defaultCurrency"`
+	Locale          string `bun:",notnull,type:varchar(35),default:'en-US'" json:"locale"`
+
+	EmailVerifiedAt time.Time `bun:",nullzero" json:"-"`
+
+	FailedLoginAttempts int       `bun:",notnull,default:0" json:"-"`
+	LockedUntil         time.Time `bun:",nullzero" json:"-"`
+	// DisabledAt is when an administrator disabled the account, which can no
+	// longer be used until it is enabled again.
+	DisabledAt time.Time `bun:",nullzero" json:"-"`
+
+	// TOTPSecret is encrypted with the server encryption key. It is set as
+	// soon as enrollment starts but only enforced once TOTPEnabled is true.
+	TOTPSecret   string `bun:"totp_secret,nullzero" json:"-"`
+	TOTPEnabled  bool   `bun:"totp_enabled,notnull,default:false" json:"-"`
+	TOTPLastStep int64  `bun:"totp_last_step,notnull,default:0" json:"-"`
 }
 
 func (u *User) FullName() string {
 	return fmt.Sprintf("%s %s", u.FirstName, u.LastName)
 }
 
+func (u *User) IsEmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
+}
+
+// IsDisabled reports whether an administrator disabled the account.
+func (u *User) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+// IsLocked reports whether too many failed logins currently block the account.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil.After(now)
+}
+
 type OutgoingUser struct {
 	ID        int    `json:"id"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 	IsAdmin   bool   `json:"isAdmin"`
 }
+
+// UserSummary is the view users get of the owner of an expense.
+type UserSummary struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+func (u *User) Summary() UserSummary {
+	return UserSummary{ID: u.ID, Email: u.Email, FirstName: u.FirstName, LastName: u.LastName}
+}
+
+// UserProfile is the view users get of their own account.
+type UserProfile struct {
+	ID               int    `json:"id"`
+	Email            string `json:"email"`
+	FirstName        string `json:"firstName"`
+	LastName         string `json:"lastName"`
+	DefaultCurrency  string `json:"defaultCurrency"`
+	Locale           string `json:"locale"`
+	IsAdmin          bool   `json:"isAdmin"`
+	EmailVerified    bool   `json:"emailVerified"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled"`
+}
+
+func (u *User) Profile() UserProfile {
+	return UserProfile{
+		ID:               u.ID,
+		Email:            u.Email,
+		FirstName:        u.FirstName,
+		LastName:         u.LastName,
+		DefaultCurrency:  u.DefaultCurrency,
+		Locale:           u.Locale,
+		IsAdmin:          u.IsAdmin,
+		EmailVerified:    u.IsEmailVerified(),
+		TwoFactorEnabled: u.TOTPEnabled,
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeAccountDeletion   = "account_deletion"
+)
+
+// UserToken is a single-use secret proving a user asked for a sensitive
+// operation, usually sent by email. Only the SHA-256 hash of the token is
+// stored.
+type UserToken struct {
+	bun.BaseModel
+
+	ID        int       `bun:",pk,autoincrement"`
+	UserID    int       `bun:",notnull"`
+	Purpose   string    `bun:",notnull,type:varchar(32)"`
+	TokenHash string    `bun:",unique,notnull,type:varchar(64)"`
+	ExpiresAt time.Time `bun:",notnull"`
+	UsedAt    time.Time `bun:",nullzero"`
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id"`
+}
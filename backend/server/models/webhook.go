@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Webhook events. Approval events will be added with the approval workflow.
+const (
+	WebhookEventExpenseCreated = "expense.created"
+	WebhookEventExpenseUpdated = "expense.updated"
+	WebhookEventExpenseDeleted = "expense.deleted"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookSubscription asks for the events of the user's expenses, or of all
+// the expenses of their organization when OrganizationID is set, to be
+// posted to URL.
+type WebhookSubscription struct {
+	bun.BaseModel
+
+	ID             int       `bun:",pk,autoincrement" json:"id"`
+	UserID         int       `bun:",notnull" json:"-"`
+	OrganizationID int       `bun:",nullzero" json:"organizationId,omitempty"`
+	URL            string    `bun:",notnull,type:varchar(2048)" json:"url"`
+	Events         []string  `bun:",notnull,type:json" json:"events"`
+	Active         bool      `bun:",notnull" json:"active"`
+	CreatedAt      time.Time `bun:",notnull,default:current_timestamp" json:"createdAt"`
+	// Secret signs the payloads. It is encrypted with the server encryption
+	// key and only shown to the user when the subscription is created.
+	Secret string `bun:",notnull" json:"-"`
+}
+
+// Subscribes reports whether the subscription wants event.
+func (s *WebhookSubscription) Subscribes(event string) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the outbox of webhook notifications. A row is written in
+// the same transaction as the change it reports, then posted by the
+// dispatcher until it succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	bun.BaseModel
+
+	ID             int `bun:",pk,autoincrement" json:"id"`
+	SubscriptionID int `bun:",notnull" json:"subscriptionId"`
+	// OwnerID is the owner of the expense the event reports, so the
+	// deliveries can be deleted with their account.
+	OwnerID        int             `bun:",nullzero" json:"-"`
+	EventID        string          `bun:",notnull,type:varchar(64)" json:"eventId"`
+	Event          string          `bun:",notnull,type:varchar(64)" json:"event"`
+	Payload        json.RawMessage `bun:",notnull,type:json" json:"payload" swaggertype:"object"`
+	Status         string          `bun:",notnull,type:varchar(16)" json:"status"`
+	Attempts       int             `bun:",notnull,default:0" json:"attempts"`
+	NextAttemptAt  *time.Time      `bun:",nullzero" json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time      `bun:",nullzero" json:"lastAttemptAt,omitempty"`
+	ResponseStatus int             `bun:",nullzero" json:"responseStatus,omitempty"`
+	LastError      string          `bun:",nullzero,type:text" json:"lastError,omitempty"`
+	DeliveredAt    *time.Time      `bun:",nullzero" json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time       `bun:",notnull,default:current_timestamp" json:"createdAt"`
+
+	Subscription *WebhookSubscription `bun:"rel:belongs-to,join:subscription_id=id" json:"-"`
+}
@@ -0,0 +1,90 @@
+// Package receipt reads expenses from receipt photos and PDFs.
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned by extractors for content types they cannot
+	// read.
+	ErrUnsupported = errors.New("unsupported receipt format")
+	// ErrNoText is returned when a receipt contains no readable text.
+	ErrNoText = errors.New("no text found on the receipt")
+)
+
+// Extractor extracts the text of a receipt.
+type Extractor interface {
+	Extract(ctx context.Context, contentType string, content []byte) (string, error)
+}
+
+// Local extracts text without any external service: PDFs and plain text are
+// read in process and images are passed to OCR.
+type Local struct {
+	OCR Extractor
+}
+
+// NewLocal returns a Local extractor running the tesseract command for
+// images.
+func NewLocal(tesseract, languages string) *Local {
+	return &Local{OCR: &Tesseract{Command: tesseract, Languages: languages}}
+}
+
+func (l *Local) Extract(ctx context.Context, contentType string, content []byte) (string, error) {
+	var text string
+	switch {
+	case contentType == "application/pdf":
+		var err error
+		if text, err = PDFText(content); err != nil {
+			return "", err
+		}
+	case strings.HasPrefix(contentType, "text/plain"):
+		text = string(content)
+	case strings.HasPrefix(contentType, "image/") && l.OCR != nil:
+		var err error
+		if text, err = l.OCR.Extract(ctx, contentType, content); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrUnsupported
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+// Tesseract reads images with the tesseract command line tool.
+type Tesseract struct {
+	// Command is the path of the tesseract binary.
+	Command string
+	// Languages are the tesseract language packs to use, such as "eng+fra".
+	Languages string
+}
+
+func (t *Tesseract) Extract(ctx context.Context, contentType string, content []byte) (string, error) {
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", ErrUnsupported
+	}
+	args := []string{"stdin", "stdout"}
+	if t.Languages != "" {
+		args = append(args, "-l", t.Languages)
+	}
+	// receipts are a single column of lines of varying sizes
+	args = append(args, "--psm", "4")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Command, args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
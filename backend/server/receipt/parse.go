@@ -0,0 +1,267 @@
+package receipt
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// DefaultTitle is the title of drafts whose merchant could not be read.
+const DefaultTitle = "Receipt"
+
+// merchantLines is the number of lines at the top of a receipt searched for
+// the merchant name.
+const merchantLines = 5
+
+var (
+	// amounts with two decimals and optional thousands separators, such as
+	// 1,234.56 or 1.234,56. Spaces are not separators as quantities often
+	// precede prices.
+	amountPattern = regexp.MustCompile(`(?:^|[^\d.,])(\d{1,3}(?:[.,]\d{3})+|\d+)[.,](\d{2})(?:[^\d.,]|$)`)
+
+	isoDate     = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	numericDate = regexp.MustCompile(`\b(\d{1,2})[-/.](\d{1,2})[-/.](\d{4}|\d{2})\b`)
+	dayMonth    = regexp.MustCompile(`(?i)\b(\d{1,2})(?:er)?\s+([\p{L}]{3,9})\.?,?\s+(\d{4})\b`)
+	monthDay    = regexp.MustCompile(`(?i)\b([\p{L}]{3,9})\.?\s+(\d{1,2}),?\s+(\d{4})\b`)
+
+	phoneOrAddress = regexp.MustCompile(`^\d+[,\s]|\d{3}[-. )]+\d{3}[-. ]\d{4}|@|www\.|https?:|\.com\b`)
+)
+
+// total keywords, strongest first, and the confidence of an amount found on
+// their line
+var totalKeywords = []struct {
+	pattern    *regexp.Regexp
+	confidence float64
+}{
+	{regexp.MustCompile(`(?i)\b(grand total|total due|amount due|balance due|total ttc|montant total|total à payer|total a payer)\b`), 0.95},
+	{regexp.MustCompile(`(?i)(^|[^\p{L}-])total\b`), 0.85},
+}
+
+// lines mentioning a total that is not the amount paid
+var notTotal = regexp.MustCompile(`(?i)\b(sub-?\s?total|sous-?\s?total|total (tax|taxes|savings|discount|items|qty)|tax total|nombre d'articles)\b`)
+
+var months = map[string]time.Month{
+	"jan": time.January, "janv": time.January, "january": time.January, "janvier": time.January,
+	"feb": time.February, "févr": time.February, "fevr": time.February, "february": time.February, "février": time.February, "fevrier": time.February,
+	"mar": time.March, "march": time.March, "mars": time.March,
+	"apr": time.April, "avr": time.April, "april": time.April, "avril": time.April,
+	"may": time.May, "mai": time.May,
+	"jun": time.June, "june": time.June, "juin": time.June,
+	"jul": time.July, "juil": time.July, "july": time.July, "juillet": time.July,
+	"aug": time.August, "août": time.August, "aout": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September, "septembre": time.September,
+	"oct": time.October, "october": time.October, "octobre": time.October,
+	"nov": time.November, "november": time.November, "novembre": time.November,
+	"dec": time.December, "déc": time.December, "december": time.December, "décembre": time.December, "decembre": time.December,
+}
+
+// words of the header lines that are not the merchant name
+var headerNoise = regexp.MustCompile(`(?i)\b(receipt|reçu|recu|invoice|facture|welcome|bienvenue|thank you|merci|tel|tél|phone|store|magasin|cashier|caissier|order|commande|date|time|heure)\b`)
+
+// Parse reads the total, date and merchant of the receipt text. Dates after
+// now are ignored. The category is left for the caller to suggest.
+func Parse(text string, now time.Time) models.ReceiptDraft {
+	lines := receiptLines(text)
+	draft := models.ReceiptDraft{Text: text}
+	draft.Expense.Amount, draft.Confidence.Amount = parseTotal(lines)
+	var date time.Time
+	date, draft.Confidence.Date = parseDate(lines, now)
+	if !date.IsZero() {
+		draft.Expense.Date = date.Format(time.DateOnly)
+	}
+	draft.Expense.Merchant, draft.Confidence.Merchant = parseMerchant(lines)
+	draft.Expense.Title = draft.Expense.Merchant
+	if draft.Expense.Title == "" {
+		draft.Expense.Title = DefaultTitle
+	}
+	return draft
+}
+
+func receiptLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// amounts returns the amounts of a line, ignoring its dates.
+func amounts(line string) []float64 {
+	for _, pattern := range []*regexp.Regexp{isoDate, numericDate} {
+		line = pattern.ReplaceAllString(line, " ")
+	}
+	var found []float64
+	for _, m := range amountPattern.FindAllStringSubmatch(line, -1) {
+		whole := strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, m[1])
+		amount, err := strconv.ParseFloat(whole+"."+m[2], 64)
+		if err == nil && amount > 0 {
+			found = append(found, amount)
+		}
+	}
+	return found
+}
+
+// parseTotal returns the amount paid: the amount on the line of the
+// strongest total keyword, the largest one if several lines match. Without
+// keyword, the largest amount of the receipt is a weak guess.
+func parseTotal(lines []string) (float64, float64) {
+	var total, confidence float64
+	for i, line := range lines {
+		if notTotal.MatchString(line) {
+			continue
+		}
+		for _, keyword := range totalKeywords {
+			if !keyword.pattern.MatchString(line) {
+				continue
+			}
+			found, c := amounts(line), keyword.confidence
+			if len(found) == 0 && i+1 < len(lines) {
+				// the amount is often in a column read as the next line
+				found, c = amounts(lines[i+1]), c-0.15
+			}
+			if len(found) == 0 {
+				continue
+			}
+			amount := found[len(found)-1]
+			if c > confidence || c == confidence && amount > total {
+				total, confidence = amount, c
+			}
+			break
+		}
+	}
+	if confidence > 0 {
+		return total, confidence
+	}
+
+	count := 0
+	for _, line := range lines {
+		for _, amount := range amounts(line) {
+			total = math.Max(total, amount)
+			count++
+		}
+	}
+	switch count {
+	case 0:
+		return 0, 0
+	case 1:
+		return total, 0.5
+	}
+	return total, 0.35
+}
+
+// parseDate returns the most reliable date of the receipt, the first one on
+// ties, preferring the lines that mention a date. Ambiguous numeric dates, such as 04/05/2025,
+// are read as the most recent interpretation that is not in the future.
+func parseDate(lines []string, now time.Time) (time.Time, float64) {
+	var best time.Time
+	var confidence float64
+	for _, line := range lines {
+		date, c := lineDate(line, now)
+		if date.IsZero() {
+			continue
+		}
+		if strings.Contains(strings.ToLower(line), "date") {
+			c = min(c+0.05, 1)
+		}
+		if c > confidence {
+			best, confidence = date, c
+		}
+	}
+	return best, confidence
+}
+
+func lineDate(line string, now time.Time) (time.Time, float64) {
+	valid := func(year int, month time.Month, day int) (time.Time, bool) {
+		if year < 100 {
+			year += 2000
+		}
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		if date.Year() != year || date.Month() != month || date.Day() != day {
+			return time.Time{}, false
+		}
+		// receipts older than ten years or from the future are misreadings
+		if date.After(now.AddDate(0, 0, 1)) || date.Before(now.AddDate(-10, 0, 0)) {
+			return time.Time{}, false
+		}
+		return date, true
+	}
+
+	if m := isoDate.FindStringSubmatch(line); m != nil {
+		if date, ok := valid(atoi(m[1]), time.Month(atoi(m[2])), atoi(m[3])); ok {
+			return date, 0.9
+		}
+	}
+	for _, m := range dayMonth.FindAllStringSubmatch(line, -1) {
+		if month, ok := months[strings.ToLower(m[2])]; ok {
+			if date, ok := valid(atoi(m[3]), month, atoi(m[1])); ok {
+				return date, 0.9
+			}
+		}
+	}
+	for _, m := range monthDay.FindAllStringSubmatch(line, -1) {
+		if month, ok := months[strings.ToLower(m[1])]; ok {
+			if date, ok := valid(atoi(m[3]), month, atoi(m[2])); ok {
+				return date, 0.9
+			}
+		}
+	}
+	if m := numericDate.FindStringSubmatch(line); m != nil {
+		a, b, year := atoi(m[1]), atoi(m[2]), atoi(m[3])
+		dayFirst, dayFirstOK := valid(year, time.Month(b), a)
+		monthFirst, monthFirstOK := valid(year, time.Month(a), b)
+		switch {
+		case dayFirstOK && monthFirstOK && a != b:
+			return later(dayFirst, monthFirst), 0.5
+		case dayFirstOK:
+			return dayFirst, 0.8
+		case monthFirstOK:
+			return monthFirst, 0.8
+		}
+	}
+	return time.Time{}, 0
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parseMerchant returns the first line at the top of the receipt that looks
+// like a name rather than an address, phone number, greeting or price.
+func parseMerchant(lines []string) (string, float64) {
+	for i, line := range lines[:min(len(lines), merchantLines)] {
+		letters := 0
+		for _, r := range line {
+			if unicode.IsLetter(r) {
+				letters++
+			}
+		}
+		if letters < 3 || letters*3 < len([]rune(line)) || phoneOrAddress.MatchString(line) || headerNoise.MatchString(line) || amounts(line) != nil {
+			continue
+		}
+		if i == 0 {
+			return line, 0.6
+		}
+		return line, 0.45
+	}
+	return "", 0
+}
@@ -0,0 +1,88 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, time.June, 20, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		text       string
+		expense    models.ExpenseDraft
+		confidence models.ReceiptConfidence
+	}{
+		{
+			name: "grocery receipt",
+			text: `WHOLE FOODS MARKET
+1234 Main Street, Portland OR
+Tel 503-555-0142
+06/14/2025 18:32
+BANANAS            1.99
+2 @ 3.49           6.98
+SUBTOTAL           8.97
+TAX                0.72
+TOTAL              9.69
+VISA **** 4242     9.69
+THANK YOU`,
+			expense:    models.ExpenseDraft{Title: "WHOLE FOODS MARKET", Merchant: "WHOLE FOODS MARKET", Date: "2025-06-14", Amount: 9.69},
+			confidence: models.ReceiptConfidence{Amount: 0.85, Date: 0.8, Merchant: 0.6},
+		},
+		{
+			name: "french receipt with column amounts",
+			text: `Bienvenue
+Café de l'Époque
+12 rue Saint-Denis, Montréal
+Date : 3 juin 2025
+Croissant 3,25
+Sous-total 3,25
+Montant total
+1.234,50 $`,
+			expense:    models.ExpenseDraft{Title: "Café de l'Époque", Merchant: "Café de l'Époque", Date: "2025-06-03", Amount: 1234.5},
+			confidence: models.ReceiptConfidence{Amount: 0.8, Date: 0.95, Merchant: 0.45},
+		},
+		{
+			name: "ambiguous date and no total keyword",
+			text: `7-Eleven #2231
+05/04/25
+Coffee 2.10
+Muffin 3.45`,
+			expense:    models.ExpenseDraft{Title: "7-Eleven #2231", Merchant: "7-Eleven #2231", Date: "2025-05-04", Amount: 3.45},
+			confidence: models.ReceiptConfidence{Amount: 0.35, Date: 0.5, Merchant: 0.6},
+		},
+		{
+			name: "future dates and totals that are not paid",
+			text: `Receipt
+2026-01-01
+Total savings 5.00
+Amount due: $42.00
+Total 40.00`,
+			expense:    models.ExpenseDraft{Title: DefaultTitle, Amount: 42},
+			confidence: models.ReceiptConfidence{Amount: 0.95},
+		},
+		{
+			name:    "nothing to read",
+			text:    "%%%\n",
+			expense: models.ExpenseDraft{Title: DefaultTitle},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			draft := Parse(test.text, now)
+			assert.Equal(t, test.expense, draft.Expense)
+			assert.InDeltaMapValues(t, map[string]float64{
+				"amount": test.confidence.Amount, "date": test.confidence.Date, "merchant": test.confidence.Merchant,
+			}, map[string]float64{
+				"amount": draft.Confidence.Amount, "date": draft.Confidence.Date, "merchant": draft.Confidence.Merchant,
+			}, 0.001)
+			assert.Equal(t, test.text, draft.Text)
+		})
+	}
+}
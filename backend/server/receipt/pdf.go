@@ -0,0 +1,379 @@
+package receipt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxStreamSize bounds the size of a decompressed PDF stream.
+const maxStreamSize = 16 << 20
+
+var streamKeyword = regexp.MustCompile(`>>\s*stream\r?\n`)
+
+// dictNormalizer writes stream dictionaries as "/Key value/Key[/Item]" once
+// their whitespace is collapsed.
+var dictNormalizer = strings.NewReplacer(" /", "/", " [", "[", " ]", "]")
+
+// streams that never contain page text: images, cross-reference, object and
+// metadata streams, attachments and font programs
+var skippedStreams = []string{"/Subtype/Image", "/Type/XRef", "/Type/ObjStm", "/Type/Metadata", "/Type/EmbeddedFile", "/Length1 ", "/Length2 ", "/Length3 "}
+
+// PDFText returns the text drawn by the content streams of a PDF, one line
+// per text line. Only uncompressed and Flate compressed streams and fonts
+// with a single byte encoding are understood, which covers the receipts
+// generated by point of sale systems and online shops. Scanned PDFs have no
+// text and give an empty string.
+func PDFText(content []byte) (string, error) {
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return "", ErrUnsupported
+	}
+
+	var out strings.Builder
+	for _, loc := range streamKeyword.FindAllIndex(content, -1) {
+		start := loc[1]
+		end := bytes.Index(content[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := content[start : start+end]
+
+		objStart := bytes.LastIndex(content[:loc[0]], []byte("obj"))
+		if objStart < 0 {
+			continue
+		}
+		dict := dictNormalizer.Replace(string(bytes.Join(bytes.Fields(content[objStart:loc[0]]), []byte(" "))))
+		if skipStream(dict) {
+			continue
+		}
+		if strings.Contains(dict, "/Filter") {
+			if !strings.Contains(dict, "/Filter/FlateDecode") && !strings.Contains(dict, "/Filter[/FlateDecode]") {
+				continue
+			}
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// keep what could be read of truncated streams
+			data, _ = io.ReadAll(io.LimitReader(r, maxStreamSize))
+		}
+		contentText(data, &out)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func skipStream(dict string) bool {
+	for _, s := range skippedStreams {
+		if strings.Contains(dict, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentText writes the text shown by the operators of a content stream.
+// Text drawn on the same baseline, even by different text objects, ends up
+// on the same line. Transformations of the graphics state are ignored.
+func contentText(data []byte, out *strings.Builder) {
+	// vertical position of the current text line and of the last text shown
+	var lineY, leading, shownY float64
+	moved, shown := false, false
+	show := func(text string) {
+		switch {
+		case shown && lineY != shownY:
+			out.WriteByte('\n')
+		case shown && moved && !strings.HasSuffix(out.String(), " "):
+			out.WriteByte(' ')
+		}
+		out.WriteString(text)
+		shownY, moved, shown = lineY, false, true
+	}
+	nextLine := func() {
+		lineY -= max(leading, 1)
+		moved = true
+	}
+
+	lex := &pdfLexer{data: data}
+	var operands, array []pdfToken
+	inArray := false
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		switch tok.kind {
+		case tokenArrayStart:
+			inArray, array = true, nil
+			continue
+		case tokenArrayEnd:
+			inArray = false
+			operands = append(operands, pdfToken{kind: tokenArray, array: array})
+			continue
+		case tokenOperator:
+		default:
+			if inArray {
+				array = append(array, tok)
+			} else {
+				operands = append(operands, tok)
+			}
+			continue
+		}
+
+		last := func(n int) []pdfToken {
+			if len(operands) < n {
+				return nil
+			}
+			return operands[len(operands)-n:]
+		}
+		switch tok.text {
+		case "BT":
+			lineY, moved = 0, true
+		case "TL":
+			if args := last(1); args != nil {
+				leading = args[0].number
+			}
+		case "Td", "TD":
+			if args := last(2); args != nil {
+				lineY += args[1].number
+				if tok.text == "TD" {
+					leading = -args[1].number
+				}
+				moved = true
+			}
+		case "Tm":
+			if args := last(6); args != nil {
+				lineY, moved = args[5].number, true
+			}
+		case "T*":
+			nextLine()
+		case "Tj", "'", "\"":
+			if tok.text != "Tj" {
+				nextLine()
+			}
+			if args := last(1); args != nil {
+				show(decodePDFString(args[0].bytes))
+			}
+		case "TJ":
+			if args := last(1); args != nil {
+				var text strings.Builder
+				for _, item := range args[0].array {
+					switch {
+					case item.kind == tokenString:
+						text.WriteString(decodePDFString(item.bytes))
+					case item.kind == tokenNumber && item.number < -250:
+						// a kerning larger than a quarter of an em separates words
+						text.WriteByte(' ')
+					}
+				}
+				show(text.String())
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	if shown {
+		out.WriteByte('\n')
+	}
+}
+
+// windows-1252 characters that differ from Latin-1
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+}
+
+// decodePDFString decodes a string shown with a single byte font, assuming
+// the standard Windows encoding. Control characters, such as the glyph IDs
+// of composite fonts, are dropped.
+func decodePDFString(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		switch r, ok := winAnsi[c]; {
+		case ok:
+			s.WriteRune(r)
+		case c == '\t':
+			s.WriteByte(' ')
+		case c >= 0x20 && c < 0x7f || c >= 0xa0:
+			s.WriteRune(rune(c))
+		}
+	}
+	return s.String()
+}
+
+type pdfTokenKind int
+
+const (
+	tokenOther pdfTokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenArrayStart
+	tokenArrayEnd
+	tokenArray
+)
+
+type pdfToken struct {
+	kind   pdfTokenKind
+	text   string
+	number float64
+	bytes  []byte
+	array  []pdfToken
+}
+
+// pdfLexer splits a content stream into tokens.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return isPDFSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			l.pos++
+			return pdfToken{kind: tokenString, bytes: l.literalString()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<',
+			c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return pdfToken{kind: tokenOther}, true
+		case c == '<':
+			l.pos++
+			return pdfToken{kind: tokenString, bytes: l.hexString()}, true
+		case c == '[':
+			l.pos++
+			return pdfToken{kind: tokenArrayStart}, true
+		case c == ']':
+			l.pos++
+			return pdfToken{kind: tokenArrayEnd}, true
+		case c == '/' || c == '{' || c == '}' || c == ')' || c == '>':
+			l.pos++
+			if c == '/' {
+				l.word()
+			}
+			return pdfToken{kind: tokenOther}, true
+		default:
+			word := l.word()
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				return pdfToken{kind: tokenNumber, number: n}, true
+			}
+			return pdfToken{kind: tokenOperator, text: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literalString reads a string after its opening parenthesis.
+func (l *pdfLexer) literalString() []byte {
+	var s []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// line continuation
+				if c == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// hexString reads a string after its opening angle bracket.
+func (l *pdfLexer) hexString() []byte {
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return nil
+		}
+		s = append(s, byte(n))
+	}
+	return s
+}
+
+// skipInlineImage skips the data of an inline image, up to its EI operator.
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if isPDFSpace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 == len(l.data) || isPDFDelimiter(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,91 @@
+package receipt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPDF builds a PDF with an image and a page whose content stream is
+// compressed when compress is set.
+func testPDF(t *testing.T, content string, compress bool) []byte {
+	stream, filter := []byte(content), ""
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		_, err := w.Write(stream)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		stream, filter = buf.Bytes(), " /Filter [ /FlateDecode ]"
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	pdf.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /Im1 5 0 R >> >> >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(stream), filter)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("5 0 obj\n<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /Length 12 >>\nstream\nBT (x) Tj ET\nendstream\nendobj\n")
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestPDFText(t *testing.T) {
+	t.Parallel()
+
+	content := `
+BT /F1 12 Tf 72 720 Td (Caf\351 \(Downtown\)) Tj ET
+BT /F1 10 Tf 1 0 0 1 72 700 Tm [(Go)-30(pher )(Mug)] TJ 1 0 0 1 300 700 Tm (12.50) Tj ET
+q 100 0 0 100 0 0 cm /Im1 Do Q
+BT 14 TL 72 680 Td [(TOTAL)-400(TTC)] TJ T* <31322E3530> Tj ET
+BI /W 1 /H 1 /BPC 8 /CS /G ID ` + "\x00\xff" + ` EI
+`
+	want := "Café (Downtown)\nGopher Mug 12.50\nTOTAL TTC\n12.50"
+
+	text, err := PDFText(testPDF(t, content, true))
+	require.NoError(t, err)
+	assert.Equal(t, want, text)
+	text, err = PDFText(testPDF(t, content, false))
+	require.NoError(t, err)
+	assert.Equal(t, want, text)
+
+	_, err = PDFText([]byte("not a pdf"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+type fakeOCR string
+
+func (f fakeOCR) Extract(context.Context, string, []byte) (string, error) {
+	return string(f), nil
+}
+
+func TestLocalExtract(t *testing.T) {
+	t.Parallel()
+
+	local := &Local{OCR: fakeOCR("TOTAL 3.00")}
+	text, err := local.Extract(context.Background(), "image/png", []byte("png"))
+	require.NoError(t, err)
+	assert.Equal(t, "TOTAL 3.00", text)
+
+	text, err = local.Extract(context.Background(), "text/plain", []byte("TOTAL 4.00"))
+	require.NoError(t, err)
+	assert.Equal(t, "TOTAL 4.00", text)
+
+	text, err = local.Extract(context.Background(), "application/pdf", testPDF(t, "BT (TOTAL 5.00) Tj ET", true))
+	require.NoError(t, err)
+	assert.Equal(t, "TOTAL 5.00", text)
+
+	_, err = local.Extract(context.Background(), "application/pdf", testPDF(t, "q /Im1 Do Q", true))
+	assert.ErrorIs(t, err, ErrNoText, "scanned PDF")
+	_, err = local.Extract(context.Background(), "application/zip", []byte("PK"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = (&Local{}).Extract(context.Background(), "image/png", []byte("png"))
+	assert.ErrorIs(t, err, ErrUnsupported, "without OCR")
+}
@@ -0,0 +1,122 @@
+package receipt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+)
+
+// Confidence of the merchant when it matches a known merchant.
+const knownMerchantConfidence = 0.9
+
+// Confidence of the suggested category, by suggestion source.
+var categoryConfidence = map[string]float64{
+	service.CategorySourceMerchantHistory: 0.8,
+	service.CategorySourceMerchant:        0.7,
+	service.CategorySourceTitleHistory:    0.4,
+}
+
+// Scanner runs the JobTypeReceiptScan jobs: it reads the uploaded receipts
+// and saves the expense drafts.
+type Scanner struct {
+	DB        *bun.DB
+	Extractor Extractor
+	// Timeout bounds the text extraction of each receipt.
+	Timeout time.Duration
+
+	now func() time.Time
+}
+
+// Handle reads the receipt of a JobTypeReceiptScan job. Receipts deleted in
+// the meantime are skipped. Database errors are retried, and the scan is
+// marked as failed after the last attempt.
+func (s *Scanner) Handle(ctx context.Context, job *models.Job, payload models.ReceiptScanPayload) error {
+	scan, err := service.GetReceiptScanContent(ctx, s.DB, payload.ReceiptID)
+	if errors.Is(err, service.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := service.StartReceiptScan(ctx, s.DB, scan); err != nil {
+		return err
+	}
+
+	if err := s.scan(ctx, scan); err != nil {
+		if job.Attempts < job.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		scan.Status = models.ReceiptScanFailed
+		scan.Error = "the receipt could not be read"
+	}
+	return service.CompleteReceiptScan(ctx, s.DB, scan)
+}
+
+func (s *Scanner) clock() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// scan reads the receipt of scan and sets the draft, or why it could not be
+// read. It only returns an error when the scan should be retried.
+func (s *Scanner) scan(ctx context.Context, scan *models.ReceiptScan) error {
+	extractCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	text, err := s.Extractor.Extract(extractCtx, scan.ContentType, scan.Content)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		scan.Status = models.ReceiptScanFailed
+		scan.Error = err.Error()
+		if !errors.Is(err, ErrUnsupported) && !errors.Is(err, ErrNoText) {
+			log.Warn().Err(err).Int("receipt", scan.ID).Msg("receipt extraction failed")
+			scan.Error = "the receipt could not be read"
+		}
+		return nil
+	}
+
+	draft := Parse(text, s.clock())
+	if err := s.suggest(ctx, scan.UserID, &draft); err != nil {
+		return err
+	}
+	scan.Status = models.ReceiptScanDone
+	scan.Draft = &draft
+	return nil
+}
+
+// suggest replaces the merchant read on the receipt with the known merchant
+// it matches and suggests a category, as for expenses typed by hand.
+func (s *Scanner) suggest(ctx context.Context, userID int, draft *models.ReceiptDraft) error {
+	ctx, cancel := context.WithTimeout(ctx, service.SQLTimeoutDuration)
+	defer cancel()
+
+	orgID, err := service.OrganizationOf(ctx, s.DB, userID)
+	if err != nil {
+		return err
+	}
+	merchant, err := service.ResolveMerchant(ctx, s.DB, orgID, draft.Expense.Merchant)
+	if err != nil {
+		return err
+	}
+	if merchant != nil {
+		draft.Expense.Merchant, draft.Expense.Title = merchant.Name, merchant.Name
+		draft.Confidence.Merchant = knownMerchantConfidence
+	}
+
+	suggestion, err := service.SuggestCategory(ctx, s.DB, userID, orgID, merchant, draft.Expense.Title)
+	if err != nil {
+		return err
+	}
+	draft.Expense.CategoryID = suggestion.CategoryID
+	draft.Confidence.Category = categoryConfidence[suggestion.Source]
+	return nil
+}
@@ -0,0 +1,138 @@
+// Package seed fills a database with demo data for local development.
+package seed
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// Password is the password of the demo users.
+const Password = "demo-password"
+
+// Users are the demo accounts. The first one is an administrator.
+var Users = []models.User{
+	{Email: "alice@example.com", FirstName: "Alice", LastName: "Martin", IsAdmin: true},
+	{Email: "bob@example.com", FirstName: "Bob", LastName: "Tremblay"},
+	{Email: "chloe@example.com", FirstName: "Chloé", LastName: "Roy"},
+}
+
+// expenseKind describes a kind of expense: its category, where it is made,
+// what it costs and how many are made in a month.
+type expenseKind struct {
+	category  string
+	titles    []string
+	merchants []string
+	min, max  float64
+	perMonth  int
+}
+
+var kinds = []expenseKind{
+	{"Meals", []string{"Client lunch", "Team dinner", "Breakfast meeting"}, []string{"Café Olimpico", "Joe Beef", "Tim Hortons", "Pizzeria Napoletana"}, 8, 120, 4},
+	{"Transport", []string{"Taxi to the airport", "Uber to client site", "Train ticket"}, []string{"Uber", "Taxi Diamond", "VIA Rail"}, 12, 180, 2},
+	{"Travel", []string{"Flight to Toronto", "Flight to New York", "Conference trip"}, []string{"Air Canada", "Porter Airlines", "WestJet"}, 220, 900, 1},
+	{"Lodging", []string{"Hotel", "Conference hotel"}, []string{"Marriott", "Hilton Garden Inn", "Hôtel Le Germain"}, 150, 450, 1},
+	{"Office Supplies", []string{"Notebooks and pens", "Printer paper", "Desk lamp"}, []string{"Staples", "Bureau en Gros", "Amazon"}, 5, 90, 1},
+	{"Software", []string{"Design tool subscription", "Cloud hosting", "IDE license"}, []string{"Figma", "DigitalOcean", "JetBrains"}, 15, 250, 1},
+}
+
+// Summary counts the records created by Run.
+type Summary struct {
+	Users      int
+	Categories int
+	Expenses   int
+}
+
+// Run creates the demo users and categories, and a year of expenses ending
+// at now for each user, picked with rng. Users that already exist are left
+// untouched, so that running it again does not duplicate their expenses.
+func Run(ctx context.Context, db *bun.DB, rng *rand.Rand, now time.Time) (*Summary, error) {
+	summary := new(Summary)
+	categories, err := createCategories(ctx, db, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := utils.HashPassword(Password)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range Users {
+		_, err := service.GetUserByEmail(ctx, db, user.Email)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, service.ErrNotFound) {
+			return nil, err
+		}
+		user.Password = password
+		user.EmailVerifiedAt = now
+		if err := service.CreateUser(ctx, db, &user); err != nil {
+			return nil, err
+		}
+		summary.Users++
+
+		for month := 11; month >= 0; month-- {
+			first := time.Date(now.Year(), now.Month()-time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			days := first.AddDate(0, 1, -1).Day()
+			if month == 0 {
+				days = now.Day()
+			}
+			for _, kind := range kinds {
+				for range rng.IntN(kind.perMonth*2 + 1) {
+					expense := &models.Expense{
+						OwnerID:    user.ID,
+						CategoryID: categories[kind.category],
+						Title:      pick(rng, kind.titles),
+						Merchant:   pick(rng, kind.merchants),
+						Date:       first.AddDate(0, 0, rng.IntN(days)),
+						Amount:     models.Amount(math.Round((kind.min+rng.Float64()*(kind.max-kind.min))*100) / 100),
+					}
+					if err := service.CreateExpense(ctx, db, expense); err != nil {
+						return nil, err
+					}
+					summary.Expenses++
+				}
+			}
+		}
+	}
+	return summary, nil
+}
+
+// createCategories creates the missing categories of the expense kinds and
+// returns the IDs of the categories by name. They are the categories of the
+// users without organization, like the demo users.
+func createCategories(ctx context.Context, db *bun.DB, summary *Summary) (map[string]int, error) {
+	existing, err := service.GetCategories(ctx, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int)
+	for _, category := range existing {
+		ids[category.Name] = category.ID
+	}
+	for _, kind := range kinds {
+		if _, ok := ids[kind.category]; ok {
+			continue
+		}
+		category := &models.Category{Name: kind.category}
+		if err := service.CreateCategory(ctx, db, 0, category); err != nil {
+			return nil, err
+		}
+		ids[category.Name] = category.ID
+		summary.Categories++
+	}
+	return ids, nil
+}
+
+func pick(rng *rand.Rand, values []string) string {
+	return values[rng.IntN(len(values))]
+}
@@ -0,0 +1,52 @@
+package seed
+
+import (
+	"context"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	db, err := storage.NewBunDB(filepath.Join(t.TempDir(), "expenses.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	_, err = service.Migrate(ctx, db, migrations.Migrations, 0)
+	require.NoError(t, err)
+	require.NoError(t, service.CreateCategory(ctx, db, 0, &models.Category{Name: "Meals"}))
+
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	summary, err := Run(ctx, db, rand.New(rand.NewPCG(1, 1)), now)
+	require.NoError(t, err)
+	assert.Equal(t, len(Users), summary.Users)
+	assert.Equal(t, len(kinds)-1, summary.Categories, "existing categories are reused")
+	assert.Greater(t, summary.Expenses, 100)
+
+	alice, err := service.GetUserByEmail(ctx, db, Users[0].Email)
+	require.NoError(t, err)
+	assert.True(t, alice.IsAdmin)
+	assert.True(t, alice.IsEmailVerified())
+	assert.True(t, utils.CheckPasswordHash(Password, alice.Password))
+
+	var first, last time.Time
+	require.NoError(t, db.NewSelect().Model((*models.Expense)(nil)).ColumnExpr("min(date), max(date)").Scan(ctx, &first, &last))
+	assert.False(t, first.Before(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)), first)
+	assert.False(t, last.After(now), last)
+
+	again, err := Run(ctx, db, rand.New(rand.NewPCG(1, 1)), now)
+	require.NoError(t, err)
+	assert.Equal(t, &Summary{}, again, "existing users are skipped")
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// expenseColumns are the columns of expenses.csv.
+var expenseColumns = []string{
+	"id", "date", "type", "title", "description", "merchant", "category", "amount",
+	"distance_km", "vehicle", "destination", "days", "organization_id",
+}
+
+// WriteAccountArchive writes export to w as a zip archive holding
+// account.json with all the data, expenses.csv for spreadsheets and the
+// uploaded receipts under receipts/.
+func WriteAccountArchive(ctx context.Context, db *bun.DB, export *AccountExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("account.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	if file, err = archive.Create("expenses.csv"); err != nil {
+		return err
+	}
+	if err := writeExpensesCSV(file, export); err != nil {
+		return err
+	}
+
+	for _, receipt := range export.Receipts {
+		scan, err := GetReceiptScanContent(ctx, db, receipt.ID)
+		if err != nil {
+			return err
+		}
+		if file, err = archive.Create(receiptPath(receipt.ID, receipt.FileName)); err != nil {
+			return err
+		}
+		if _, err := file.Write(scan.Content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeExpensesCSV(w io.Writer, export *AccountExport) error {
+	categories := make(map[int]string, len(export.Categories))
+	for _, category := range export.Categories {
+		categories[category.ID] = category.Name
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(expenseColumns); err != nil {
+		return err
+	}
+	for _, expense := range export.Expenses {
+		record := []string{
+			strconv.Itoa(expense.ID),
+			expense.Date.Format("2006-01-02"),
+			expense.Type,
+			expense.Title,
+			expense.Description,
+			expense.Merchant,
+			categories[expense.CategoryID],
+			strconv.FormatFloat(float64(expense.Amount), 'f', 2, 64),
+			optionalFloat(expense.DistanceKm),
+			expense.Vehicle,
+			expense.Destination,
+			optionalInt(expense.Days),
+			optionalInt(expense.OrganizationID),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// receiptPath returns the path of a receipt in the archive. The ID keeps
+// receipts uploaded under the same name apart.
+func receiptPath(id int, fileName string) string {
+	name := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = "receipt"
+	}
+	return fmt.Sprintf("receipts/%d-%s", id, name)
+}
+
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func optionalFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
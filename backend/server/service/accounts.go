@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// AccountExport is everything the application stores for a user, handed to
+// them on request and before their account is deleted.
+type AccountExport struct {
+	ExportedAt time.Time                `json:"exportedAt"`
+	Profile    models.UserProfile       `json:"profile"`
+	Expenses   []models.ExpenseResponse `json:"expenses"`
+	// Categories are the categories of the expenses. Categories are shared
+	// by all the users and do not record who created them.
+	Categories []models.Category `json:"categories"`
+	// Receipts are the uploaded receipts, without their content.
+	Receipts    []models.ReceiptScan         `json:"receipts"`
+	APIKeys     []models.APIKey              `json:"apiKeys"`
+	Webhooks    []models.WebhookSubscription `json:"webhooks"`
+	Identities  []AccountIdentity            `json:"identities"`
+	Membership  *models.OrganizationMember   `json:"membership,omitempty"`
+	AuditEvents []models.AuditEvent          `json:"auditEvents"`
+}
+
+// AccountIdentity is a single sign-on identity linked to the account.
+type AccountIdentity struct {
+	Issuer    string     `json:"issuer"`
+	Subject   string     `json:"subject"`
+	Email     string     `json:"email"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastLogin *time.Time `json:"lastLogin,omitempty"`
+}
+
+// ExportAccount collects the user's data.
+func ExportAccount(ctx context.Context, db *bun.DB, user *models.User) (*AccountExport, error) {
+	export := &AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    user.Profile(),
+		Categories: []models.Category{},
+		Identities: []AccountIdentity{},
+	}
+
+	expenses, err := ListExpenses(ctx, db, user.ID, ExpenseRelations{})
+	if err != nil {
+		return nil, err
+	}
+	export.Expenses = make([]models.ExpenseResponse, len(expenses))
+	for i := range expenses {
+		export.Expenses[i] = expenses[i].Response()
+	}
+	var categoryIDs []int
+	for _, expense := range export.Expenses {
+		if expense.CategoryID != 0 && !slices.Contains(categoryIDs, expense.CategoryID) {
+			categoryIDs = append(categoryIDs, expense.CategoryID)
+		}
+	}
+	if len(categoryIDs) > 0 {
+		categories, err := GetCategoriesByID(ctx, db, categoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(categoryIDs)
+		for _, id := range categoryIDs {
+			if category, ok := categories[id]; ok {
+				export.Categories = append(export.Categories, *category)
+			}
+		}
+	}
+
+	if export.Receipts, err = listAccountReceipts(ctx, db, user.ID); err != nil {
+		return nil, err
+	}
+	if export.APIKeys, err = ListAPIKeys(ctx, db, user.ID); err != nil {
+		return nil, err
+	}
+	if export.Webhooks, err = ListWebhooks(ctx, db, user.ID); err != nil {
+		return nil, err
+	}
+	identities, err := listAccountIdentities(ctx, db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		linked := AccountIdentity{
+			Issuer:    identity.Issuer,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		}
+		if !identity.LastLogin.IsZero() {
+			linked.LastLogin = &identity.LastLogin
+		}
+		export.Identities = append(export.Identities, linked)
+	}
+	membership, err := GetMembership(ctx, db, user.ID)
+	switch {
+	case err == nil:
+		export.Membership = membership
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	}
+	if export.AuditEvents, err = ListAuditEvents(ctx, db, user.ID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// listAccountReceipts returns all the receipts of the user, without their
+// content, oldest first.
+func listAccountReceipts(ctx context.Context, db *bun.DB, userID int) ([]models.ReceiptScan, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scans := []models.ReceiptScan{}
+	err := db.NewSelect().Model(&scans).
+		ExcludeColumn("content").
+		Where("user_id = ?", userID).
+		OrderExpr("id").
+		Scan(ctx)
+	return scans, err
+}
+
+func listAccountIdentities(ctx context.Context, db *bun.DB, userID int) ([]models.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var identities []models.UserIdentity
+	err := db.NewSelect().Model(&identities).Where("user_id = ?", userID).OrderExpr("id").Scan(ctx)
+	return identities, err
+}
+
+// DeleteAccount redeems the deletion confirmation token issued to the user
+// and erases their account.
+func DeleteAccount(ctx context.Context, db *bun.DB, userID int, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, err := consumeUserToken(ctx, tx, models.TokenPurposeAccountDeletion, token)
+		if err != nil {
+			return err
+		}
+		if userToken.UserID != userID {
+			return invalid("invalid or expired token", nil)
+		}
+		return eraseAccount(ctx, tx, userID, models.AuditActorUser)
+	})
+}
+
+// EraseAccount deletes the user and their personal data on behalf of actor.
+func EraseAccount(ctx context.Context, db *bun.DB, userID int, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return eraseAccount(ctx, tx, userID, actor)
+	})
+}
+
+// eraseAccount deletes the user. Their expenses, receipts, tokens, keys,
+// identities, webhooks and jobs are removed by the ON DELETE CASCADE foreign
+// keys. The webhook deliveries reporting their expenses to other members of
+// their organization are deleted too, and so are the invitations sent to their
+// email address. The owner of an organization must transfer the ownership
+// first, unless they are its last member. Their audit events are kept,
+// detached from the account and without details, and the erasure is recorded.
+func eraseAccount(ctx context.Context, tx bun.Tx, userID int, actor string) error {
+	if err := leaveOrganization(ctx, tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.NewDelete().Model((*models.WebhookDelivery)(nil)).
+		Where("owner_id = ?", userID).
+		Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.NewDelete().Model((*models.OrganizationInvitation)(nil)).
+		Where("email = (SELECT lower(trim(email)) FROM users WHERE id = ?)", userID).
+		Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.NewUpdate().Model((*models.AuditEvent)(nil)).
+		Set("user_id = NULL").
+		Set("details = NULL").
+		Where("user_id = ?", userID).
+		Exec(ctx); err != nil {
+		return err
+	}
+
+	res, err := tx.NewDelete().Model((*models.User)(nil)).Where("id = ?", userID).Exec(ctx)
+	if err := expectAffected(res, err, "user not found"); err != nil {
+		return err
+	}
+	// the ID alone does not identify anyone once the account is gone
+	return RecordAuditEvent(ctx, tx, &models.AuditEvent{
+		Action:  models.AuditAccountErased,
+		Actor:   actor,
+		Details: map[string]string{"userId": strconv.Itoa(userID)},
+	})
+}
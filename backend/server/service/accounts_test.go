@@ -0,0 +1,144 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+func TestAccountExportAndErasure(t *testing.T) {
+	t.Parallel()
+
+	db, err := storage.NewBunDB(filepath.Join(t.TempDir(), "expenses.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	_, err = Migrate(ctx, db, migrations.Migrations, 0)
+	require.NoError(t, err)
+
+	owner := &models.User{Email: "gdpr.owner@test.com", Password: "unused", FirstName: "Olga", LastName: "Owner"}
+	require.NoError(t, CreateUser(ctx, db, owner))
+	user := &models.User{Email: "gdpr.member@test.com", Password: "unused", FirstName: "Gina", LastName: "Gdpr"}
+	require.NoError(t, CreateUser(ctx, db, user))
+	org := &models.Organization{Name: "Privacy Inc"}
+	_, err = CreateOrganization(ctx, db, org, owner.ID)
+	require.NoError(t, err)
+	invitation, err := InviteMember(ctx, db, org.ID, owner.ID, user.Email, models.RoleMember, time.Hour)
+	require.NoError(t, err)
+	_, err = AcceptInvitation(ctx, db, invitation.ID, user)
+	require.NoError(t, err)
+	// the owner is notified of the member's expenses
+	hook := &models.WebhookSubscription{
+		UserID: owner.ID, OrganizationID: org.ID, URL: "https://example.com/hook",
+		Events: []string{models.WebhookEventExpenseCreated}, Secret: "unused",
+	}
+	require.NoError(t, CreateWebhook(ctx, db, hook))
+
+	books := &models.Category{OrganizationID: org.ID, Name: "Books"}
+	require.NoError(t, CreateCategory(ctx, db, 0, books))
+	expense := &models.Expense{
+		OwnerID: user.ID, CategoryID: books.ID, Title: "Privacy, \"a\" handbook",
+		Date: time.Date(2025, 5, 4, 0, 0, 0, 0, time.UTC), Amount: 42.5,
+	}
+	require.NoError(t, CreateExpense(ctx, db, expense))
+	scan := &models.ReceiptScan{UserID: user.ID, FileName: "../../handbook.txt", ContentType: "text/plain", Content: []byte("TOTAL 42.50")}
+	require.NoError(t, CreateReceiptScan(ctx, db, scan))
+	require.NoError(t, RecordAuditEvent(ctx, db, &models.AuditEvent{
+		UserID: user.ID, Action: models.AuditUserPasswordReset, Actor: models.AuditActorAdmin,
+		Details: map[string]string{"reason": "forgotten"},
+	}))
+
+	t.Run("exports the user's data", func(t *testing.T) {
+		export, err := ExportAccount(ctx, db, user)
+		require.NoError(t, err)
+		assert.Equal(t, user.Email, export.Profile.Email)
+		require.Len(t, export.Expenses, 1)
+		assert.Equal(t, []models.Category{*books}, export.Categories)
+		require.Len(t, export.Receipts, 1)
+		assert.Nil(t, export.Receipts[0].Content)
+		require.NotNil(t, export.Membership)
+		assert.Equal(t, org.ID, export.Membership.OrganizationID)
+		require.Len(t, export.AuditEvents, 1)
+		assert.Equal(t, models.AuditUserPasswordReset, export.AuditEvents[0].Action)
+		assert.Empty(t, export.Webhooks, "the organization webhook belongs to the owner")
+
+		var archive bytes.Buffer
+		require.NoError(t, WriteAccountArchive(ctx, db, export, &archive))
+		reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+		require.NoError(t, err)
+		files := map[string]string{}
+		for _, file := range reader.File {
+			f, err := file.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(f)
+			require.NoError(t, err)
+			files[file.Name] = string(content)
+		}
+		require.Len(t, files, 3)
+		var decoded AccountExport
+		require.NoError(t, json.Unmarshal([]byte(files["account.json"]), &decoded))
+		assert.Equal(t, user.ID, decoded.Profile.ID)
+		assert.Equal(t, "id,date,type,title,description,merchant,category,amount,distance_km,vehicle,destination,days,organization_id\n"+
+			"1,2025-05-04,receipt,\"Privacy, \"\"a\"\" handbook\",,,Books,42.50,,,,,1\n", files["expenses.csv"])
+		assert.Equal(t, "TOTAL 42.50", files["receipts/1-handbook.txt"])
+	})
+
+	t.Run("erases the user and anonymizes their audit events", func(t *testing.T) {
+		deliveries, err := db.NewSelect().Model((*models.WebhookDelivery)(nil)).Count(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, deliveries)
+
+		err = EraseAccount(ctx, db, owner.ID, models.AuditActorAdmin)
+		assert.ErrorIs(t, err, ErrConflict, "the organization would be left without owner")
+		_, err = GetUserById(ctx, db, owner.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, EraseAccount(ctx, db, user.ID, models.AuditActorAdmin))
+		assert.ErrorIs(t, EraseAccount(ctx, db, user.ID, models.AuditActorAdmin), ErrNotFound)
+
+		_, err = GetUserById(ctx, db, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		expenses, err := db.NewSelect().Model((*models.Expense)(nil)).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, expenses)
+		receipts, err := db.NewSelect().Model((*models.ReceiptScan)(nil)).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, receipts)
+		deliveries, err = db.NewSelect().Model((*models.WebhookDelivery)(nil)).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, deliveries, "the owner is not sent the erased expenses")
+
+		var events []models.AuditEvent
+		require.NoError(t, db.NewSelect().Model(&events).OrderExpr("id").Scan(ctx))
+		require.Len(t, events, 2)
+		assert.Zero(t, events[0].UserID)
+		assert.Equal(t, models.AuditUserPasswordReset, events[0].Action)
+		assert.Nil(t, events[0].Details)
+		assert.Zero(t, events[1].UserID)
+		assert.Equal(t, models.AuditAccountErased, events[1].Action)
+		assert.Equal(t, models.AuditActorAdmin, events[1].Actor)
+	})
+
+	t.Run("erases the last member with the organization", func(t *testing.T) {
+		require.NoError(t, EraseAccount(ctx, db, owner.ID, models.AuditActorUser))
+
+		orgs, err := db.NewSelect().Model((*models.Organization)(nil)).Where("id = ?", org.ID).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, orgs)
+		categories, err := GetCategories(ctx, db, org.ID)
+		require.NoError(t, err)
+		assert.Empty(t, categories)
+	})
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+const (
+	// apiKeyPrefix makes keys easy to recognize, e.g. by secret scanners.
+	apiKeyPrefix = "exp_"
+	// lastUsedPrecision limits how often a busy key updates its last use.
+	lastUsedPrecision = time.Minute
+)
+
+// CreateAPIKey stores a new key for key.UserID and returns it in clear text.
+// The key cannot be retrieved afterwards.
+func CreateAPIKey(ctx context.Context, db *bun.DB, key *models.APIKey) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := apiKeyPrefix + secret
+	key.Prefix = token[:len(apiKeyPrefix)+8]
+	key.KeyHash = utils.HashToken(token)
+
+	if _, err := db.NewInsert().Model(key).Returning("id, created_at").Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ListAPIKeys returns the keys of the user, revoked ones included.
+func ListAPIKeys(ctx context.Context, db *bun.DB, userID int) ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	keys := []models.APIKey{}
+	err := db.NewSelect().Model(&keys).Where("user_id = ?", userID).OrderExpr("id").Scan(ctx)
+	return keys, err
+}
+
+// RevokeAPIKey stops one of the user's keys from working. The key is kept so
+// its last use remains visible.
+func RevokeAPIKey(ctx context.Context, db *bun.DB, id, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewUpdate().Model((*models.APIKey)(nil)).
+		Set("revoked_at = ?", time.Now().UTC()).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Exec(ctx)
+	return expectAffected(res, err, "API key not found")
+}
+
+// AuthenticateAPIKey returns the valid key matching token along with its
+// owner, and records its use.
+func AuthenticateAPIKey(ctx context.Context, db *bun.DB, token string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	now := time.Now().UTC()
+	key := new(models.APIKey)
+	err := db.NewSelect().Model(key).
+		Relation("User").
+		Where("key_hash = ?", utils.HashToken(token)).
+		Where("api_key.revoked_at IS NULL").
+		Where("api_key.expires_at IS NULL OR api_key.expires_at > ?", now).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalid("invalid, expired or revoked API key", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedPrecision {
+		if _, err := db.NewUpdate().Model(key).
+			Set("last_used_at = ?", now).
+			WherePK().
+			Exec(ctx); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// RecordAuditEvent stores event. Pass a transaction to only record it if the
+// change it describes is committed.
+func RecordAuditEvent(ctx context.Context, db bun.IDB, event *models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	_, err := db.NewInsert().Model(event).Returning("id, created_at").Exec(ctx)
+	return err
+}
+
+// ListAuditEvents returns the events about the user, oldest first.
+func ListAuditEvents(ctx context.Context, db bun.IDB, userID int) ([]models.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	events := []models.AuditEvent{}
+	err := db.NewSelect().Model(&events).Where("user_id = ?", userID).OrderExpr("id").Scan(ctx)
+	return events, err
+}
@@ -5,33 +5,126 @@ import (
 
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/events"
 	"github.com/Spiria-Digital/expense-manager/server/models"
 )
 
-// GetCategories returns all expenses for a given user.
-func GetCategories(ctx context.Context, db *bun.DB) ([]models.Category, error) {
+// GetCategories returns the categories of the organization orgID, or those of
+// the users without organization when it is zero.
+func GetCategories(ctx context.Context, db *bun.DB, orgID int) ([]models.Category, error) {
 	var categories []models.Category
-	err := db.NewSelect().Model(&categories).OrderExpr("name").Scan(ctx)
+	err := db.NewSelect().Model(&categories).Where(inOrganization, orgID).OrderExpr("name").Scan(ctx)
 	return categories, err
 }
 
-func CreateCategory(ctx context.Context, db *bun.DB, category *models.Category) error {
-	_, err := db.NewInsert().Model(category).Returning("id").Exec(ctx)
-	return err
+// CreateCategory adds a category to category.OrganizationID for userID.
+// Categories are shared: the change is published to the members of the
+// organization, or to userID when there is none.
+func CreateCategory(ctx context.Context, db *bun.DB, userID int, category *models.Category) error {
+	recipients, err := categoryRecipients(ctx, db, userID, category.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if _, err := db.NewInsert().Model(category).Returning("id").Exec(ctx); err != nil {
+		return translateError(err, "", "category name already exists")
+	}
+	publishCategory(recipients, events.CategoryCreated, category)
+	return nil
 }
 
-func UpdateCategory(ctx context.Context, db *bun.DB, category *models.Category) error {
-	_, err := db.NewUpdate().Model(category).Column("name").Where("id = ?", category.ID).Exec(ctx)
-	return err
+func UpdateCategory(ctx context.Context, db *bun.DB, userID int, category *models.Category) error {
+	recipients, err := categoryRecipients(ctx, db, userID, category.OrganizationID)
+	if err != nil {
+		return err
+	}
+	res, err := db.NewUpdate().Model(category).Column("name").
+		Where("id = ?", category.ID).
+		Where(inOrganization, category.OrganizationID).
+		Exec(ctx)
+	if err := expectAffected(res, translateError(err, "", "category name already exists"), "category not found"); err != nil {
+		return err
+	}
+	publishCategory(recipients, events.CategoryUpdated, category)
+	return nil
 }
 
-func DeleteCategory(ctx context.Context, db *bun.DB, category *models.Category) error {
-	_, err := db.NewDelete().Model(category).Where("id = ?", category.ID).Exec(ctx)
-	return err
+func DeleteCategory(ctx context.Context, db *bun.DB, userID int, category *models.Category) error {
+	recipients, err := categoryRecipients(ctx, db, userID, category.OrganizationID)
+	if err != nil {
+		return err
+	}
+	res, err := db.NewDelete().Model(category).
+		Where("id = ?", category.ID).
+		Where(inOrganization, category.OrganizationID).
+		Exec(ctx)
+	if err := expectAffected(res, err, "category not found"); err != nil {
+		return err
+	}
+	publishCategory(recipients, events.CategoryDeleted, category)
+	return nil
 }
 
-func GetCategory(ctx context.Context, db *bun.DB, id int) (*models.Category, error) {
+// categoryRecipients returns the users following the categories of the
+// organization orgID: its members, or userID alone when orgID is zero. Zero
+// is no user, for the changes made outside of a request.
+func categoryRecipients(ctx context.Context, db bun.IDB, userID, orgID int) ([]int, error) {
+	if orgID == 0 {
+		if userID == 0 {
+			return nil, nil
+		}
+		return []int{userID}, nil
+	}
+	var members []int
+	err := db.NewSelect().Model((*models.OrganizationMember)(nil)).
+		Column("user_id").
+		Where("organization_id = ?", orgID).
+		Scan(ctx, &members)
+	return members, err
+}
+
+func publishCategory(recipients []int, eventType string, category *models.Category) {
+	for _, userID := range recipients {
+		Events.Publish(userID, eventType, category)
+	}
+}
+
+func GetCategory(ctx context.Context, db *bun.DB, orgID, id int) (*models.Category, error) {
 	category := new(models.Category)
-	err := db.NewSelect().Model(category).Where("id = ?", id).Scan(ctx)
-	return category, err
+	err := db.NewSelect().Model(category).Where("id = ?", id).Where(inOrganization, orgID).Scan(ctx)
+	return category, translateError(err, "category not found", "")
+}
+
+// checkCategory fails unless the category exists in the organization orgID.
+// Zero is no category.
+func checkCategory(ctx context.Context, db bun.IDB, orgID, id int, message string) error {
+	if id == 0 {
+		return nil
+	}
+	exists, err := db.NewSelect().Model((*models.Category)(nil)).
+		Where("id = ?", id).
+		Where(inOrganization, orgID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return invalid(message, nil)
+	}
+	return nil
+}
+
+// GetCategoriesByID returns the categories with the given IDs, keyed by ID.
+func GetCategoriesByID(ctx context.Context, db *bun.DB, ids []int) (map[int]*models.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var categories []*models.Category
+	if err := db.NewSelect().Model(&categories).Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	return byID, nil
 }
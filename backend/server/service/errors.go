@@ -0,0 +1,94 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Error kinds returned by the service layer. Match them with errors.Is; the
+// HTTP layer maps each kind to a status code.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	ErrForbidden = errors.New("forbidden")
+	ErrInvalid   = errors.New("invalid")
+)
+
+// Error is a service failure carrying a message that is safe to show to API
+// clients. It unwraps to both its kind and the underlying cause, so callers can
+// still match errors such as sql.ErrNoRows.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func notFound(message string, err error) error {
+	return &Error{Kind: ErrNotFound, Message: message, Err: err}
+}
+
+func conflict(message string, err error) error {
+	return &Error{Kind: ErrConflict, Message: message, Err: err}
+}
+
+func invalid(message string, err error) error {
+	return &Error{Kind: ErrInvalid, Message: message, Err: err}
+}
+
+func forbidden(message string, err error) error {
+	return &Error{Kind: ErrForbidden, Message: message, Err: err}
+}
+
+// isUniqueViolation reports whether err was raised by a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || strings.Contains(msg, "duplicate key value")
+}
+
+// translateError converts driver errors into service errors described by
+// message: missing rows become ErrNotFound and unique violations ErrConflict.
+func translateError(err error, notFoundMessage, conflictMessage string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound(notFoundMessage, err)
+	case conflictMessage != "" && isUniqueViolation(err):
+		return conflict(conflictMessage, err)
+	default:
+		return err
+	}
+}
+
+// expectAffected turns a write that matched no rows into ErrNotFound.
+func expectAffected(res sql.Result, err error, notFoundMessage string) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound(notFoundMessage, sql.ErrNoRows)
+	}
+	return nil
+}
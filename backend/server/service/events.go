@@ -0,0 +1,10 @@
+package service
+
+import (
+	"github.com/Spiria-Digital/expense-manager/server/events"
+)
+
+// Events receives the changes once they are committed, for the users
+// following them live. It can be replaced at startup, before serving
+// requests.
+var Events = events.NewBroker(events.DefaultBufferSize)
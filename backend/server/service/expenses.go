@@ -2,18 +2,42 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/uptrace/bun"
 
+	"github.com/Spiria-Digital/expense-manager/server/events"
 	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
 )
 
+// ExpenseRelations selects the related records loaded along with expenses.
+type ExpenseRelations struct {
+	Category bool
+	Owner    bool
+}
+
+// apply joins the selected relations. Only the public profile of the owner is
+// loaded.
+func (r ExpenseRelations) apply(q *bun.SelectQuery) *bun.SelectQuery {
+	if r.Category {
+		q = q.Relation("Category")
+	}
+	if r.Owner {
+		q = q.Relation("Owner", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("id", "email", "first_name", "last_name")
+		})
+	}
+	return q
+}
+
 // ListExpenses returns all expenses for a given user.
 // TODO - change the date from the database to return a date in the format "YYYY-MM-DD"
 // TODO - refactor ListExpenses and ListExpensesByCategory to use a single function
-func ListExpenses(ctx context.Context, db *bun.DB, owner int) ([]models.Expense, error) {
+func ListExpenses(ctx context.Context, db *bun.DB, owner int, include ExpenseRelations) ([]models.Expense, error) {
 	var expenses []models.Expense
-	err := db.NewSelect().Model(&expenses).Where("owner_id = ?", owner).Scan(ctx)
+	q := db.NewSelect().Model(&expenses).Relation("Violations").Where("expense.owner_id = ?", owner)
+	err := include.apply(q).Scan(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -22,30 +46,197 @@ func ListExpenses(ctx context.Context, db *bun.DB, owner int) ([]models.Expense,
 
 func ListExpensesByCategory(ctx context.Context, db *bun.DB, owner int, category string) ([]models.Expense, error) {
 	var expenses []models.Expense
-	err := db.NewSelect().Model(&expenses).Where("owner_id = ? and category_id = ?", owner, category).Scan(ctx)
+	err := db.NewSelect().Model(&expenses).Relation("Violations").Where("owner_id = ? and category_id = ?", owner, category).Scan(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return expenses, nil
 }
 
+// CreateExpense records expense, attributing it to the organization its owner
+// currently belongs to, whose categories, rates, merchants and policy rules
+// apply. The amount of mileage and per-diem expenses is computed from the
+// rate tables, the merchant is matched with the known merchants, expenses
+// without a category get the suggested one, and policy violations are
+// recorded.
 func CreateExpense(ctx context.Context, db *bun.DB, expense *models.Expense) error {
-	_, err := db.NewInsert().Model(expense).Exec(ctx)
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		orgID, err := OrganizationOf(ctx, tx, expense.OwnerID)
+		if err != nil {
+			return err
+		}
+		expense.OrganizationID = orgID
+		if err := checkCategory(ctx, tx, orgID, expense.CategoryID, "category not found"); err != nil {
+			return err
+		}
+		if err := checkReceipt(ctx, tx, expense.OwnerID, expense.ReceiptID); err != nil {
+			return err
+		}
+		if err := priceExpense(ctx, tx, expense); err != nil {
+			return err
+		}
+		merchant, err := assignMerchant(ctx, tx, expense)
+		if err != nil {
+			return err
+		}
+		if expense.CategoryID == 0 {
+			suggestion, err := SuggestCategory(ctx, tx, expense.OwnerID, orgID, merchant, expense.Title)
+			if err != nil {
+				return err
+			}
+			expense.CategoryID, expense.CategorySource = suggestion.CategoryID, suggestion.Source
+		}
+		if _, err := tx.NewInsert().Model(expense).Exec(ctx); err != nil {
+			return err
+		}
+		if err := applyPolicies(ctx, tx, expense); err != nil {
+			return err
+		}
+		return enqueueExpenseEvent(ctx, tx, models.WebhookEventExpenseCreated, expense)
+	})
+	if err == nil {
+		Events.Publish(expense.OwnerID, events.ExpenseCreated, expense.Response())
+		telemetry.RecordExpenseCreated(expense.Type)
+	}
 	return err
 }
 
-func GetExpense(ctx context.Context, db *bun.DB, id int, owner int) (*models.Expense, error) {
+func GetExpense(ctx context.Context, db *bun.DB, id int, owner int, include ExpenseRelations) (*models.Expense, error) {
 	expense := new(models.Expense)
-	err := db.NewSelect().Model(expense).Where("id = ? and owner_id = ?", id, owner).Scan(ctx)
-	return expense, err
+	q := db.NewSelect().Model(expense).Relation("Violations").Where("expense.id = ? and expense.owner_id = ?", id, owner)
+	err := include.apply(q).Scan(ctx)
+	return expense, translateError(err, "expense not found", "")
 }
 
+// UpdateExpense saves expense, recomputing the amount of mileage and per-diem
+// expenses, matching the merchant again and evaluating the policy rules again.
+// The expense stays in its organization. The current rates only apply when
+// the inputs of the amount changed.
 func UpdateExpense(ctx context.Context, db *bun.DB, expense *models.Expense) error {
-	_, err := db.NewUpdate().Model(expense).WherePK().Exec(ctx)
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		stored := new(models.Expense)
+		err := tx.NewSelect().Model(stored).
+			Where("id = ? AND owner_id = ?", expense.ID, expense.OwnerID).
+			Scan(ctx)
+		if err != nil {
+			return translateError(err, "expense not found", "")
+		}
+		expense.OrganizationID = stored.OrganizationID
+		if err := checkCategory(ctx, tx, expense.OrganizationID, expense.CategoryID, "category not found"); err != nil {
+			return err
+		}
+		if err := checkReceipt(ctx, tx, expense.OwnerID, expense.ReceiptID); err != nil {
+			return err
+		}
+		if err := repriceExpense(ctx, tx, expense, stored); err != nil {
+			return err
+		}
+		if _, err := assignMerchant(ctx, tx, expense); err != nil {
+			return err
+		}
+		res, err := tx.NewUpdate().Model(expense).
+			ExcludeColumn("owner_id", "organization_id").
+			WherePK().
+			Where("owner_id = ?", expense.OwnerID).
+			Exec(ctx)
+		if err := expectAffected(res, err, "expense not found"); err != nil {
+			return err
+		}
+		if err := applyPolicies(ctx, tx, expense); err != nil {
+			return err
+		}
+		return enqueueExpenseEvent(ctx, tx, models.WebhookEventExpenseUpdated, expense)
+	})
+	if err == nil {
+		Events.Publish(expense.OwnerID, events.ExpenseUpdated, expense.Response())
+	}
 	return err
 }
 
 func DeleteExpense(ctx context.Context, db *bun.DB, id int, owner int) error {
-	_, err := db.NewDelete().Model(&models.Expense{}).Where("id = ? and owner_id = ?", id, owner).Exec(ctx)
+	expense := new(models.Expense)
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewDelete().Model(expense).
+			Where("id = ? and owner_id = ?", id, owner).
+			Returning("*").
+			Scan(ctx)
+		if err != nil {
+			return translateError(err, "expense not found", "")
+		}
+		return enqueueExpenseEvent(ctx, tx, models.WebhookEventExpenseDeleted, expense)
+	})
+	if err == nil {
+		Events.Publish(owner, events.ExpenseDeleted, expense.Response())
+	}
 	return err
 }
+
+// ExpenseQuery selects the expenses of an owner, or of an organization when
+// OrganizationID is set. Zero values are ignored; To is inclusive.
+type ExpenseQuery struct {
+	OwnerID        int
+	OrganizationID int
+	CategoryID     int
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
+}
+
+func (q ExpenseQuery) apply(sq *bun.SelectQuery, alias string) *bun.SelectQuery {
+	if q.OrganizationID != 0 {
+		sq = sq.Where("?.organization_id = ?", bun.Ident(alias), q.OrganizationID)
+	} else {
+		sq = sq.Where("?.owner_id = ?", bun.Ident(alias), q.OwnerID)
+	}
+	if q.CategoryID != 0 {
+		sq = sq.Where("?.category_id = ?", bun.Ident(alias), q.CategoryID)
+	}
+	return TeamFilter{From: q.From, To: q.To}.apply(sq, alias)
+}
+
+// QueryExpenses returns a page of the expenses selected by q, most recent
+// first.
+func QueryExpenses(ctx context.Context, db *bun.DB, q ExpenseQuery) ([]models.Expense, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	expenses := []models.Expense{}
+	sq := db.NewSelect().Model(&expenses).
+		Relation("Violations").
+		OrderExpr("expense.date DESC, expense.id DESC").
+		Limit(q.Limit).
+		Offset(q.Offset)
+	err := q.apply(sq, "expense").Scan(ctx)
+	return expenses, err
+}
+
+// ExpenseSummary totals expenses overall and per category.
+type ExpenseSummary struct {
+	Total      float64         `json:"total"`
+	Count      int             `json:"count"`
+	Categories []CategorySpend `json:"categories"`
+}
+
+// SummarizeExpenses totals the expenses selected by q, ignoring its paging.
+func SummarizeExpenses(ctx context.Context, db *bun.DB, q ExpenseQuery) (*ExpenseSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	summary := &ExpenseSummary{Categories: []CategorySpend{}}
+	sq := db.NewSelect().
+		TableExpr("expenses AS e").
+		Join("LEFT JOIN categories AS c ON c.id = e.category_id").
+		ColumnExpr("COALESCE(c.id, 0) AS category_id, COALESCE(c.name, '') AS category_name").
+		ColumnExpr("CAST(SUM(e.amount) AS REAL) AS total, COUNT(*) AS count").
+		GroupExpr("c.id, c.name").
+		OrderExpr("category_name")
+	if err := q.apply(sq, "e").Scan(ctx, &summary.Categories); err != nil {
+		return nil, err
+	}
+	for _, spend := range summary.Categories {
+		summary.Total += spend.Total
+		summary.Count += spend.Count
+	}
+	return summary, nil
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// PingDatabase checks that the database can be reached.
+func PingDatabase(ctx context.Context, db *bun.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// DefaultJobMaxAttempts is the number of attempts of jobs enqueued without
+// MaxAttempts.
+const DefaultJobMaxAttempts = 5
+
+// maxJobs is the number of jobs returned by ListJobs.
+const maxJobs = 50
+
+// EnqueueJob stores job with its payload encoded as JSON. Jobs without RunAt
+// are due immediately. Pass a transaction to only enqueue the job if the
+// change it follows is committed.
+func EnqueueJob(ctx context.Context, db bun.IDB, job *models.Job, payload any) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var err error
+	if job.Payload, err = json.Marshal(payload); err != nil {
+		return err
+	}
+	job.Status = models.JobStatusPending
+	job.Attempts = 0
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	job.RunAt = job.RunAt.UTC()
+	_, err = db.NewInsert().Model(job).Returning("id, created_at").Exec(ctx)
+	return err
+}
+
+// ClaimJob marks the next due job of one of the given types as running and
+// returns it, or returns nil when no job is due. Running jobs locked before
+// staleBefore were abandoned by a stopped worker and are claimed again. A job
+// is never returned to two callers, even from different processes.
+func ClaimJob(ctx context.Context, db *bun.DB, types []string, now, staleBefore time.Time) (*models.Job, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	claimable := func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.WhereOr("status = ? AND run_at <= ?", models.JobStatusPending, now.UTC()).
+			WhereOr("status = ? AND locked_at < ?", models.JobStatusRunning, staleBefore.UTC())
+	}
+	next := db.NewSelect().
+		Model((*models.Job)(nil)).
+		Column("id").
+		Where("type IN (?)", bun.In(types)).
+		WhereGroup(" AND ", claimable).
+		OrderExpr("run_at, id").
+		Limit(1)
+
+	job := new(models.Job)
+	res, err := db.NewUpdate().
+		Model(job).
+		Set("status = ?", models.JobStatusRunning).
+		Set("locked_at = ?", now.UTC()).
+		Set("attempts = attempts + 1").
+		Where("id = (?)", next).
+		// the job may have been claimed since it was selected
+		Where("status = ? OR locked_at < ?", models.JobStatusPending, staleBefore.UTC()).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RecordJobAttempt saves the outcome of a job attempt.
+func RecordJobAttempt(ctx context.Context, db *bun.DB, job *models.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewUpdate().Model(job).
+		Column("status", "attempts", "run_at", "locked_at", "last_error", "result", "finished_at").
+		WherePK().
+		Exec(ctx)
+	return expectAffected(res, err, "job not found")
+}
+
+// ListJobs returns the latest jobs created for the user, most recent first.
+func ListJobs(ctx context.Context, db *bun.DB, userID int) ([]models.Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	jobs := []models.Job{}
+	err := db.NewSelect().Model(&jobs).
+		Where("user_id = ?", userID).
+		OrderExpr("id DESC").
+		Limit(maxJobs).
+		Scan(ctx)
+	return jobs, err
+}
+
+// GetJob returns one of the jobs created for the user.
+func GetJob(ctx context.Context, db *bun.DB, id, userID int) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	job := new(models.Job)
+	err := db.NewSelect().Model(job).Where("id = ? AND user_id = ?", id, userID).Scan(ctx)
+	return job, translateError(err, "job not found", "")
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// BackupDatabase writes a consistent copy of the database to path while it is
+// in use. The file must not exist.
+func BackupDatabase(ctx context.Context, db *bun.DB, path string) error {
+	_, err := db.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
+
+// CheckIntegrity looks for corruption and for rows referencing missing rows,
+// and returns the problems found.
+func CheckIntegrity(ctx context.Context, db *bun.DB) ([]string, error) {
+	var results []string
+	if err := db.NewRaw("PRAGMA integrity_check").Scan(ctx, &results); err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, result := range results {
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, parent string
+		var rowID *int64
+		var key int
+		if err := rows.Scan(&table, &rowID, &parent, &key); err != nil {
+			return nil, err
+		}
+		row := "without rowid"
+		if rowID != nil {
+			row = fmt.Sprintf("row %d", *rowID)
+		}
+		problems = append(problems, fmt.Sprintf("%s %s references a missing %s", table, row, parent))
+	}
+	return problems, rows.Err()
+}
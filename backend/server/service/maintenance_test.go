@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	db, err := storage.NewBunDB(filepath.Join(dir, "expenses.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	_, err = Migrate(ctx, db, migrations.Migrations, 0)
+	require.NoError(t, err)
+	user := &models.User{Email: "backup.owner@test.com", Password: "unused", FirstName: "Bea", LastName: "Backup"}
+	require.NoError(t, CreateUser(ctx, db, user))
+
+	path := filepath.Join(dir, "backup.db")
+	require.NoError(t, BackupDatabase(ctx, db, path))
+	assert.Error(t, BackupDatabase(ctx, db, path), "never overwrites a file")
+	backup, err := storage.NewBunDB(path)
+	require.NoError(t, err)
+	defer backup.Close()
+	restored, err := GetUserByEmail(ctx, backup, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, restored.ID)
+
+	problems, err := CheckIntegrity(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// SQLite only enforces foreign keys on the connections enabling them
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "INSERT INTO expenses (owner_id, title, date, amount) VALUES (?, 'Orphan', '2025-01-01', 1)", user.ID+1000)
+	require.NoError(t, err)
+	problems, err = CheckIntegrity(ctx, db)
+	require.NoError(t, err)
+	assert.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "expenses row")
+	assert.Contains(t, problems[0], "references a missing users")
+}
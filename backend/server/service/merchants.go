@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// Sources of automatically assigned categories.
+const (
+	// CategorySourceMerchantHistory is the category the user most often
+	// chose for the merchant.
+	CategorySourceMerchantHistory = "merchant_history"
+	// CategorySourceMerchant is the default category of the merchant.
+	CategorySourceMerchant = "merchant"
+	// CategorySourceTitleHistory is the category the user most often chose
+	// for expenses with similar titles.
+	CategorySourceTitleHistory = "title_history"
+)
+
+// merchantNoise are the words ignored when comparing merchant names: web
+// domains, company forms and the prefixes of payment processors.
+var merchantNoise = map[string]bool{
+	"www": true, "com": true, "net": true, "org": true,
+	"inc": true, "llc": true, "ltd": true, "corp": true, "co": true,
+	"sq": true, "tst": true, "pos": true, "paypal": true,
+}
+
+// merchantWords splits a merchant name into lowercase words, dropping noise
+// words and numbers but the first word, such as store numbers, unless
+// nothing else is left.
+func merchantWords(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var significant []string
+	for _, word := range words {
+		isNumber := strings.IndexFunc(word, unicode.IsLetter) < 0
+		if merchantNoise[word] || (isNumber && len(significant) > 0) {
+			continue
+		}
+		significant = append(significant, word)
+	}
+	if len(significant) == 0 {
+		return words
+	}
+	return significant
+}
+
+// NormalizeMerchant returns the key merchant names are compared with, so
+// "Amazon.com" and "AMAZON" have the same key.
+func NormalizeMerchant(name string) string {
+	return strings.Join(merchantWords(name), " ")
+}
+
+type merchantKey struct {
+	MerchantID int
+	Key        string
+}
+
+// ResolveMerchant returns the merchant of the organization orgID whose name or
+// alias matches the beginning of name, preferring the longest match, so
+// "AMZN Mktp US*2K3" matches the alias "AMZN". It returns nil when no merchant
+// matches.
+func ResolveMerchant(ctx context.Context, db bun.IDB, orgID int, name string) (*models.Merchant, error) {
+	words := merchantWords(name)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	prefixes := make([]string, len(words))
+	for i := range words {
+		prefixes[i] = strings.Join(words[:i+1], " ")
+	}
+
+	var keys, aliasKeys []merchantKey
+	if err := db.NewSelect().
+		Model((*models.Merchant)(nil)).
+		ColumnExpr("id AS merchant_id, key").
+		Where("key IN (?)", bun.In(prefixes)).
+		Where(inOrganization, orgID).
+		Scan(ctx, &keys); err != nil {
+		return nil, err
+	}
+	if err := db.NewSelect().
+		Model((*models.MerchantAlias)(nil)).
+		Column("merchant_id", "key").
+		Where("key IN (?)", bun.In(prefixes)).
+		Where(inOrganization, orgID).
+		Scan(ctx, &aliasKeys); err != nil {
+		return nil, err
+	}
+	keys = append(keys, aliasKeys...)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	best := slices.MaxFunc(keys, func(a, b merchantKey) int {
+		return len(a.Key) - len(b.Key)
+	})
+
+	merchant := new(models.Merchant)
+	err := db.NewSelect().Model(merchant).Where("id = ?", best.MerchantID).Scan(ctx)
+	return merchant, err
+}
+
+// assignMerchant links expense to the merchant of its organization matching
+// its merchant name, replacing the name with the canonical one.
+func assignMerchant(ctx context.Context, db bun.IDB, expense *models.Expense) (*models.Merchant, error) {
+	expense.Merchant = strings.Join(strings.Fields(expense.Merchant), " ")
+	expense.MerchantID = 0
+	merchant, err := ResolveMerchant(ctx, db, expense.OrganizationID, expense.Merchant)
+	if err != nil || merchant == nil {
+		return nil, err
+	}
+	expense.Merchant = merchant.Name
+	expense.MerchantID = merchant.ID
+	return merchant, nil
+}
+
+// CategorySuggestion is the category suggested for a new expense.
+type CategorySuggestion struct {
+	Merchant   *models.Merchant `json:"merchant,omitempty"`
+	CategoryID int              `json:"categoryId,omitempty"`
+	Source     string           `json:"source,omitempty" enums:"merchant_history,merchant,title_history"`
+}
+
+// SuggestCategory suggests a category for an expense of owner in the
+// organization orgID at the given merchant with the given title. In order of
+// preference, it is the category the owner most often used for the merchant,
+// the merchant's default category, or the category the owner most often used
+// for similar titles. Only the expenses of the organization are considered,
+// as categories are not shared with other organizations.
+func SuggestCategory(ctx context.Context, db bun.IDB, ownerID, orgID int, merchant *models.Merchant, title string) (*CategorySuggestion, error) {
+	suggestion := &CategorySuggestion{Merchant: merchant}
+
+	if merchant != nil {
+		var categoryIDs []int
+		err := db.NewSelect().
+			Model((*models.Expense)(nil)).
+			Column("category_id").
+			Where("owner_id = ? AND merchant_id = ? AND category_id IS NOT NULL", ownerID, merchant.ID).
+			Where(inOrganization, orgID).
+			Group("category_id").
+			OrderExpr("count(*) DESC, max(date) DESC").
+			Limit(1).
+			Scan(ctx, &categoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(categoryIDs) > 0 {
+			suggestion.CategoryID, suggestion.Source = categoryIDs[0], CategorySourceMerchantHistory
+			return suggestion, nil
+		}
+		if merchant.DefaultCategoryID != 0 {
+			suggestion.CategoryID, suggestion.Source = merchant.DefaultCategoryID, CategorySourceMerchant
+			return suggestion, nil
+		}
+	}
+
+	categoryID, err := titleHistoryCategory(ctx, db, ownerID, orgID, title)
+	if err != nil {
+		return nil, err
+	}
+	if categoryID != 0 {
+		suggestion.CategoryID, suggestion.Source = categoryID, CategorySourceTitleHistory
+	}
+	return suggestion, nil
+}
+
+// similarTitles is the number of the most similar titles considered by
+// titleHistoryCategory.
+const similarTitles = 20
+
+// titleHistoryCategory returns the category most used by owner among the
+// expenses of the organization orgID whose titles are the most similar to
+// title, or 0.
+func titleHistoryCategory(ctx context.Context, db bun.IDB, ownerID, orgID int, title string) (int, error) {
+	var terms []string
+	for _, term := range searchTerm.FindAllString(title, maxSearchTerms) {
+		// short words are too common to tell expenses apart
+		if len([]rune(term)) >= 3 {
+			terms = append(terms, `"`+term+`"`)
+		}
+	}
+	if len(terms) == 0 {
+		return 0, nil
+	}
+
+	var categoryIDs []int
+	err := db.NewSelect().
+		TableExpr("expenses_fts").
+		ColumnExpr("expense.category_id").
+		Join("JOIN expenses AS expense ON expense.id = expenses_fts.rowid").
+		Where("expenses_fts MATCH ?", "title : ("+strings.Join(terms, " OR ")+")").
+		Where("expense.owner_id = ? AND expense.category_id IS NOT NULL", ownerID).
+		Where("coalesce(expense.organization_id, 0) = ?", orgID).
+		OrderExpr("rank").
+		Limit(similarTitles).
+		Scan(ctx, &categoryIDs)
+	if err != nil || len(categoryIDs) == 0 {
+		return 0, err
+	}
+
+	// the most frequent category, the most similar title breaking ties
+	counts := map[int]int{}
+	best := categoryIDs[0]
+	for _, id := range categoryIDs {
+		counts[id]++
+		if counts[id] > counts[best] {
+			best = id
+		}
+	}
+	return best, nil
+}
+
+// ListMerchants returns the merchants of the organization orgID.
+func ListMerchants(ctx context.Context, db *bun.DB, orgID int) ([]models.Merchant, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	merchants := []models.Merchant{}
+	err := db.NewSelect().
+		Model(&merchants).
+		Relation("Aliases", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.OrderExpr("alias")
+		}).
+		Where(inOrganization, orgID).
+		OrderExpr("name").
+		Scan(ctx)
+	return merchants, err
+}
+
+// CreateMerchant records merchant with the given aliases in
+// merchant.OrganizationID.
+func CreateMerchant(ctx context.Context, db *bun.DB, merchant *models.Merchant, aliases []string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := prepareMerchant(ctx, tx, merchant, aliases); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(merchant).Returning("id, created_at").Exec(ctx); err != nil {
+			return translateError(err, "", "a merchant with this name already exists")
+		}
+		return saveMerchantAliases(ctx, tx, merchant)
+	})
+}
+
+// UpdateMerchant saves merchant, which must belong to
+// merchant.OrganizationID, and replaces its aliases. Expenses already linked
+// to it keep their merchant name.
+func UpdateMerchant(ctx context.Context, db *bun.DB, merchant *models.Merchant, aliases []string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := prepareMerchant(ctx, tx, merchant, aliases); err != nil {
+			return err
+		}
+		res, err := tx.NewUpdate().Model(merchant).
+			Column("name", "key", "default_category_id").
+			WherePK().
+			Where(inOrganization, merchant.OrganizationID).
+			Returning("created_at").
+			Exec(ctx)
+		if err := expectAffected(res, translateError(err, "", "a merchant with this name already exists"), "merchant not found"); err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model((*models.MerchantAlias)(nil)).Where("merchant_id = ?", merchant.ID).Exec(ctx); err != nil {
+			return err
+		}
+		return saveMerchantAliases(ctx, tx, merchant)
+	})
+}
+
+// DeleteMerchant deletes a merchant of the organization orgID. Its expenses
+// keep their merchant name.
+func DeleteMerchant(ctx context.Context, db *bun.DB, orgID, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*models.Merchant)(nil)).
+			Where("id = ?", id).
+			Where(inOrganization, orgID).
+			Exec(ctx)
+		if err := expectAffected(res, err, "merchant not found"); err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().Model((*models.Expense)(nil)).
+			Set("merchant_id = NULL").
+			Where("merchant_id = ?", id).
+			Exec(ctx)
+		return err
+	})
+}
+
+// prepareMerchant normalizes the name and aliases of merchant, checking that
+// they are not used by another merchant of its organization and that the
+// default category exists in it.
+func prepareMerchant(ctx context.Context, tx bun.Tx, merchant *models.Merchant, aliases []string) error {
+	merchant.Name = strings.Join(strings.Fields(merchant.Name), " ")
+	merchant.Key = NormalizeMerchant(merchant.Name)
+	if merchant.Key == "" {
+		return invalid("merchant name must contain a letter or a digit", nil)
+	}
+
+	merchant.Aliases = []models.MerchantAlias{}
+	keys := []string{merchant.Key}
+	for _, alias := range aliases {
+		alias = strings.Join(strings.Fields(alias), " ")
+		key := NormalizeMerchant(alias)
+		if key == "" {
+			return invalid(fmt.Sprintf("alias %q must contain a letter or a digit", alias), nil)
+		}
+		if slices.Contains(keys, key) {
+			// same as the name or another alias once normalized
+			continue
+		}
+		keys = append(keys, key)
+		merchant.Aliases = append(merchant.Aliases, models.MerchantAlias{Alias: alias, Key: key})
+	}
+
+	var taken []string
+	err := tx.NewSelect().
+		Model((*models.Merchant)(nil)).
+		Column("name").
+		Where("id != ?", merchant.ID).
+		Where(inOrganization, merchant.OrganizationID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("key IN (?)", bun.In(keys)).
+				WhereOr("id IN (?)", tx.NewSelect().
+					Model((*models.MerchantAlias)(nil)).
+					Column("merchant_id").
+					Where("key IN (?)", bun.In(keys)).
+					Where(inOrganization, merchant.OrganizationID))
+		}).
+		Limit(1).
+		Scan(ctx, &taken)
+	if err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return conflict(fmt.Sprintf("the name or an alias is already used by merchant %q", taken[0]), nil)
+	}
+
+	return checkCategory(ctx, tx, merchant.OrganizationID, merchant.DefaultCategoryID, "default category not found")
+}
+
+func saveMerchantAliases(ctx context.Context, tx bun.Tx, merchant *models.Merchant) error {
+	if len(merchant.Aliases) == 0 {
+		return nil
+	}
+	for i := range merchant.Aliases {
+		merchant.Aliases[i].MerchantID = merchant.ID
+		merchant.Aliases[i].OrganizationID = merchant.OrganizationID
+	}
+	_, err := tx.NewInsert().Model(&merchant.Aliases).Exec(ctx)
+	return translateError(err, "", "the name or an alias is already used by another merchant")
+}
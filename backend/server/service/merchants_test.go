@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMerchant(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"Amazon.com":             "amazon",
+		"  AMAZON  ":             "amazon",
+		"AMZN Mktp US*2K3":       "amzn mktp us 2k3",
+		"SQ *BLUE BOTTLE #1234":  "blue bottle",
+		"Starbucks Store 00123":  "starbucks store",
+		"Café de l'Époque, Inc.": "café de l époque",
+		"7-Eleven #2231":         "7 eleven",
+		"1234":                   "1234",
+		"www.booking.com":        "booking",
+		"":                       "",
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, NormalizeMerchant(input), input)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// StartTOTPEnrollment stores a new, not yet active, TOTP secret for the user
+// and replaces their recovery codes.
+func StartTOTPEnrollment(ctx context.Context, db *bun.DB, user *models.User, encryptedSecret string, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	if user.TOTPEnabled {
+		return conflict("two-factor authentication is already enabled", nil)
+	}
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		user.TOTPSecret = encryptedSecret
+		user.TOTPLastStep = 0
+		if _, err := tx.NewUpdate().Model(user).
+			Column("totp_secret", "totp_last_step").
+			WherePK().
+			Exec(ctx); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(ctx, tx, user.ID, recoveryCodes)
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx bun.Tx, userID int, codes []string) error {
+	if _, err := tx.NewDelete().Model((*models.RecoveryCode)(nil)).
+		Where("user_id = ?", userID).
+		Exec(ctx); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+
+	rows := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code))})
+	}
+	_, err := tx.NewInsert().Model(&rows).Exec(ctx)
+	return err
+}
+
+// ActivateTOTP turns on two-factor authentication once the user proved their
+// authenticator works. step is the time step of the code they entered.
+func ActivateTOTP(ctx context.Context, db *bun.DB, user *models.User, step int64) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	if user.TOTPSecret == "" {
+		return invalid("two-factor enrollment has not been started", nil)
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	_, err := db.NewUpdate().Model(user).Column("totp_enabled", "totp_last_step").WherePK().Exec(ctx)
+	return err
+}
+
+// DisableTOTP removes the user's TOTP secret and recovery codes.
+func DisableTOTP(ctx context.Context, db *bun.DB, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+		if _, err := tx.NewUpdate().Model(user).
+			Column("totp_secret", "totp_enabled", "totp_last_step").
+			WherePK().
+			Exec(ctx); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(ctx, tx, user.ID, nil)
+	})
+}
+
+// UseTOTPStep records that the code of the given time step has been used. A
+// step that is not newer than the last one is rejected, so an intercepted
+// code cannot be replayed.
+func UseTOTPStep(ctx context.Context, db *bun.DB, userID int, step int64) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewUpdate().Model((*models.User)(nil)).
+		Set("totp_last_step = ?", step).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Exec(ctx)
+	if err := expectAffected(res, err, ""); errors.Is(err, ErrNotFound) {
+		return invalid("code already used", err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseRecoveryCode redeems one of the user's recovery codes.
+func UseRecoveryCode(ctx context.Context, db *bun.DB, userID int, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewUpdate().Model((*models.RecoveryCode)(nil)).
+		Set("used_at = ?", time.Now().UTC()).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Exec(ctx)
+	if err := expectAffected(res, err, ""); errors.Is(err, ErrNotFound) {
+		return invalid("invalid recovery code", err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left.
+func CountRecoveryCodes(ctx context.Context, db *bun.DB, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.NewSelect().Model((*models.RecoveryCode)(nil)).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(ctx)
+}
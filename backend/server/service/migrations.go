@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+// ErrDatabaseAhead is returned when the database has migrations applied by a
+// newer build, whose schema this build may not handle.
+var ErrDatabaseAhead = errors.New("the database was migrated by a newer version")
+
+// lockRetryInterval is how often Migrate tries to take the migrator lock.
+const lockRetryInterval = time.Second
+
+// migrationLocksTable is the table holding the migrator lock, as named by
+// bun.
+const migrationLocksTable = "bun_migration_locks"
+
+// MigrationStatus compares the migrations applied to the database with the
+// registered ones. It returns the names of the registered migrations not
+// applied yet, and of the applied migrations that are not registered, which
+// were run by a newer build.
+func MigrationStatus(ctx context.Context, db *bun.DB, migrations *migrate.Migrations) (pending, unknown []string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	migrator := migrate.NewMigrator(db, migrations)
+	all, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the applied migrations: %w", err)
+	}
+	for _, migration := range all.Unapplied() {
+		pending = append(pending, migration.String())
+	}
+	missing, err := migrator.MissingMigrations(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the applied migrations: %w", err)
+	}
+	for _, migration := range missing {
+		unknown = append(unknown, migration.Name)
+	}
+	return pending, unknown, nil
+}
+
+// Migrate creates the migration tables if needed and applies the pending
+// migrations, holding the migrator lock so that processes starting together
+// do not run them twice. It waits up to lockTimeout for the lock and returns
+// ErrDatabaseAhead, without migrating, when the database has unknown
+// migrations.
+func Migrate(ctx context.Context, db *bun.DB, migrations *migrate.Migrations, lockTimeout time.Duration) (*migrate.MigrationGroup, error) {
+	migrator := migrate.NewMigrator(db, migrations)
+	if err := migrator.Init(ctx); err != nil {
+		return nil, err
+	}
+	if err := lockMigrations(ctx, migrator, lockTimeout); err != nil {
+		return nil, err
+	}
+	// release the lock even when ctx is cancelled, or no process could migrate
+	defer migrator.Unlock(context.WithoutCancel(ctx))
+
+	missing, err := migrator.MissingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i, migration := range missing {
+			names[i] = migration.Name
+		}
+		return nil, fmt.Errorf("%w: unknown migrations %s", ErrDatabaseAhead, strings.Join(names, ", "))
+	}
+	return migrator.Migrate(ctx)
+}
+
+// MigrationsLocked reports whether the migrator lock is held, by a running
+// migration or one that was interrupted.
+func MigrationsLocked(ctx context.Context, db bun.IDB) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	exists, err := db.NewSelect().
+		Table("sqlite_master").
+		Where("type = 'table' AND name = ?", migrationLocksTable).
+		Exists(ctx)
+	if err != nil || !exists {
+		return false, err
+	}
+	return db.NewSelect().Table(migrationLocksTable).Exists(ctx)
+}
+
+func lockMigrations(ctx context.Context, migrator *migrate.Migrator, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := migrator.Lock(ctx)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w; if no migration is running, release the lock with \"bun db unlock\"", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
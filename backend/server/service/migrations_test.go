@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/Spiria-Digital/expense-manager/cmd/bun/migrations"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	db, err := storage.NewBunDB(filepath.Join(t.TempDir(), "expenses.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	group, err := Migrate(ctx, db, migrations.Migrations, 0)
+	require.NoError(t, err)
+	assert.Len(t, group.Migrations, len(migrations.Migrations.Sorted()))
+	pending, unknown, err := MigrationStatus(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.Empty(t, unknown)
+	group, err = Migrate(ctx, db, migrations.Migrations, 0)
+	require.NoError(t, err)
+	assert.True(t, group.IsZero(), "nothing left to apply")
+
+	t.Run("waits for the lock", func(t *testing.T) {
+		migrator := migrate.NewMigrator(db, migrations.Migrations)
+		require.NoError(t, migrator.Lock(ctx))
+		locked, err := MigrationsLocked(ctx, db)
+		require.NoError(t, err)
+		assert.True(t, locked)
+		_, err = Migrate(ctx, db, migrations.Migrations, 0)
+		assert.ErrorContains(t, err, "bun db unlock")
+
+		time.AfterFunc(100*time.Millisecond, func() {
+			assert.NoError(t, migrator.Unlock(ctx))
+		})
+		_, err = Migrate(ctx, db, migrations.Migrations, 5*time.Second)
+		assert.NoError(t, err)
+		locked, err = MigrationsLocked(ctx, db)
+		require.NoError(t, err)
+		assert.False(t, locked)
+	})
+
+	t.Run("refuses newer databases", func(t *testing.T) {
+		migrator := migrate.NewMigrator(db, migrations.Migrations)
+		require.NoError(t, migrator.MarkApplied(ctx, &migrate.Migration{Name: "29990101000000", GroupID: 99}))
+		_, unknown, err := MigrationStatus(ctx, db, migrations.Migrations)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"29990101000000"}, unknown)
+
+		_, err = Migrate(ctx, db, migrations.Migrations, 0)
+		assert.ErrorIs(t, err, ErrDatabaseAhead)
+		assert.ErrorContains(t, err, "29990101000000")
+	})
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// TeamMember is a member of an organization as shown to their teammates.
+type TeamMember struct {
+	UserID    int       `json:"userId"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joinedAt"`
+}
+
+// TeamFilter narrows team listings and reports. Zero values are ignored; To
+// is inclusive.
+type TeamFilter struct {
+	From     time.Time
+	To       time.Time
+	MemberID int
+}
+
+// apply adds the filter to q, where the expenses table is aliased as alias.
+func (f TeamFilter) apply(q *bun.SelectQuery, alias string) *bun.SelectQuery {
+	if !f.From.IsZero() {
+		q = q.Where("?.date >= ?", bun.Ident(alias), f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("?.date <= ?", bun.Ident(alias), f.To)
+	}
+	if f.MemberID != 0 {
+		q = q.Where("?.owner_id = ?", bun.Ident(alias), f.MemberID)
+	}
+	return q
+}
+
+// CategorySpend is the spend of a member in one category. CategoryID is zero
+// for uncategorized expenses.
+type CategorySpend struct {
+	CategoryID   int     `json:"categoryId"`
+	CategoryName string  `json:"categoryName"`
+	Total        float64 `json:"total"`
+	Count        int     `json:"count"`
+}
+
+// MemberSpend is the spend of one member, broken down by category.
+type MemberSpend struct {
+	UserID     int             `json:"userId"`
+	FirstName  string          `json:"firstName"`
+	LastName   string          `json:"lastName"`
+	Total      float64         `json:"total"`
+	Count      int             `json:"count"`
+	Categories []CategorySpend `json:"categories"`
+}
+
+// TeamReport aggregates an organization's spend per member and per category.
+type TeamReport struct {
+	OrganizationID int             `json:"organizationId"`
+	Total          float64         `json:"total"`
+	Count          int             `json:"count"`
+	Members        []MemberSpend   `json:"members"`
+	Categories     []CategorySpend `json:"categories"`
+}
+
+// CreateOrganization creates org and makes the user its owner.
+func CreateOrganization(ctx context.Context, db *bun.DB, org *models.Organization, ownerID int) (*models.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	member := &models.OrganizationMember{UserID: ownerID, Role: models.RoleOwner}
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(org).Returning("id, created_at").Exec(ctx); err != nil {
+			return err
+		}
+		member.OrganizationID = org.ID
+		_, err := tx.NewInsert().Model(member).Returning("id, created_at").Exec(ctx)
+		return translateError(err, "", "user already belongs to an organization")
+	})
+	if err != nil {
+		return nil, err
+	}
+	member.Organization = org
+	return member, nil
+}
+
+// GetMembership returns the user's membership along with their organization.
+func GetMembership(ctx context.Context, db *bun.DB, userID int) (*models.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	member := new(models.OrganizationMember)
+	err := db.NewSelect().Model(member).
+		Relation("Organization").
+		Where("organization_member.user_id = ?", userID).
+		Scan(ctx)
+	return member, translateError(err, "not a member of an organization", "")
+}
+
+// inOrganization selects the rows of the tables shared within an
+// organization, such as categories, for the organization ID given as
+// argument. Zero selects the rows shared by the users without organization.
+const inOrganization = "coalesce(organization_id, 0) = ?"
+
+// OrganizationOf returns the ID of the user's organization, or zero.
+func OrganizationOf(ctx context.Context, db bun.IDB, userID int) (int, error) {
+	var orgID int
+	err := db.NewSelect().Model((*models.OrganizationMember)(nil)).
+		Column("organization_id").
+		Where("user_id = ?", userID).
+		Scan(ctx, &orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return orgID, err
+}
+
+func teamMembersQuery(db bun.IDB, orgID int) *bun.SelectQuery {
+	return db.NewSelect().
+		TableExpr("organization_members AS m").
+		Join("JOIN users AS u ON u.id = m.user_id").
+		ColumnExpr("u.id AS user_id, u.email, u.first_name, u.last_name, m.role, m.created_at AS joined_at").
+		Where("m.organization_id = ?", orgID)
+}
+
+// ListMembers returns the members of the organization.
+func ListMembers(ctx context.Context, db *bun.DB, orgID int) ([]TeamMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	members := []TeamMember{}
+	err := teamMembersQuery(db, orgID).OrderExpr("u.last_name, u.first_name").Scan(ctx, &members)
+	return members, err
+}
+
+// InviteMember invites the owner of email to join the organization with
+// role, replacing any invitation already sent to the address. The address
+// does not need to be registered, so that inviting reveals nothing about it.
+func InviteMember(ctx context.Context, db *bun.DB, orgID, invitedBy int, email, role string, ttl time.Duration) (*models.OrganizationInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	invitation := &models.OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          normalizeEmail(email),
+		Role:           role,
+		InvitedBy:      invitedBy,
+		ExpiresAt:      time.Now().UTC().Add(ttl),
+	}
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*models.OrganizationInvitation)(nil)).
+			Where("organization_id = ? AND email = ?", orgID, invitation.Email).
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(invitation).Returning("id, created_at").Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns the pending invitations sent to email, with their
+// organization.
+func ListInvitations(ctx context.Context, db *bun.DB, email string) ([]models.OrganizationInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	invitations := []models.OrganizationInvitation{}
+	err := db.NewSelect().Model(&invitations).
+		Relation("Organization").
+		Where("organization_invitation.email = ?", normalizeEmail(email)).
+		Where("organization_invitation.expires_at > ?", time.Now().UTC()).
+		OrderExpr("organization_invitation.id").
+		Scan(ctx)
+	return invitations, err
+}
+
+// AcceptInvitation makes the user a member of the organization that sent them
+// the invitation, which is then deleted. The invitation must be addressed to
+// the user's email and not be expired.
+func AcceptInvitation(ctx context.Context, db *bun.DB, id int, user *models.User) (*models.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	member := &models.OrganizationMember{UserID: user.ID}
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		invitation := new(models.OrganizationInvitation)
+		err := tx.NewSelect().Model(invitation).
+			Relation("Organization").
+			Where("organization_invitation.id = ? AND organization_invitation.email = ?", id, normalizeEmail(user.Email)).
+			Where("organization_invitation.expires_at > ?", time.Now().UTC()).
+			Scan(ctx)
+		if err != nil {
+			return translateError(err, "invitation not found", "")
+		}
+
+		member.OrganizationID = invitation.OrganizationID
+		member.Role = invitation.Role
+		member.Organization = invitation.Organization
+		if _, err := tx.NewInsert().Model(member).Returning("id, created_at").Exec(ctx); err != nil {
+			return translateError(err, "", "user already belongs to an organization")
+		}
+		_, err = tx.NewDelete().Model(invitation).WherePK().Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// DeclineInvitation deletes an invitation sent to email.
+func DeclineInvitation(ctx context.Context, db *bun.DB, id int, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewDelete().Model((*models.OrganizationInvitation)(nil)).
+		Where("id = ? AND email = ?", id, normalizeEmail(email)).
+		Exec(ctx)
+	return expectAffected(res, err, "invitation not found")
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ensureOtherOwner fails unless the organization keeps an owner besides userID.
+func ensureOtherOwner(ctx context.Context, tx bun.Tx, orgID, userID int) error {
+	owners, err := tx.NewSelect().Model((*models.OrganizationMember)(nil)).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, models.RoleOwner, userID).
+		Count(ctx)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return invalid("an organization needs at least one owner", nil)
+	}
+	return nil
+}
+
+// leaveOrganization removes a user whose account is erased from their
+// organization, which must keep another owner. When they are its last member,
+// the organization is deleted along with its categories, merchants, rates and
+// policy rules.
+func leaveOrganization(ctx context.Context, tx bun.Tx, userID int) error {
+	member := new(models.OrganizationMember)
+	err := tx.NewSelect().Model(member).Where("user_id = ?", userID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	others, err := tx.NewSelect().Model((*models.OrganizationMember)(nil)).
+		Where("organization_id = ? AND user_id <> ?", member.OrganizationID, userID).
+		Count(ctx)
+	if err != nil {
+		return err
+	}
+	if others > 0 {
+		if err := ensureOtherOwner(ctx, tx, member.OrganizationID, userID); errors.Is(err, ErrInvalid) {
+			return conflict("transfer the ownership of the organization first", nil)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	for _, model := range []any{
+		(*models.Category)(nil), (*models.Merchant)(nil), (*models.MileageRate)(nil),
+		(*models.PerDiemRate)(nil), (*models.PolicyRule)(nil),
+	} {
+		if _, err := tx.NewDelete().Model(model).Where("organization_id = ?", member.OrganizationID).Exec(ctx); err != nil {
+			return err
+		}
+	}
+	// the membership and the invitations are removed by the foreign keys
+	_, err = tx.NewDelete().Model((*models.Organization)(nil)).Where("id = ?", member.OrganizationID).Exec(ctx)
+	return err
+}
+
+// UpdateMemberRole changes the role of a member of the organization. The last
+// owner cannot be demoted, and organization webhooks of members demoted to
+// plain members are deactivated.
+func UpdateMemberRole(ctx context.Context, db *bun.DB, orgID, userID int, role string) (*TeamMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	member := new(TeamMember)
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if role != models.RoleOwner {
+			if err := ensureOtherOwner(ctx, tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		res, err := tx.NewUpdate().Model((*models.OrganizationMember)(nil)).
+			Set("role = ?", role).
+			Where("organization_id = ? AND user_id = ?", orgID, userID).
+			Exec(ctx)
+		if err := expectAffected(res, err, "member not found"); err != nil {
+			return err
+		}
+		if role == models.RoleMember {
+			if err := deactivateOrganizationWebhooks(ctx, tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		return teamMembersQuery(tx, orgID).Where("m.user_id = ?", userID).Scan(ctx, member)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes a user from the organization and deactivates their
+// organization webhooks. Their past expenses stay attributed to it. The last
+// owner cannot leave.
+func RemoveMember(ctx context.Context, db *bun.DB, orgID, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := ensureOtherOwner(ctx, tx, orgID, userID); err != nil {
+			return err
+		}
+		res, err := tx.NewDelete().Model((*models.OrganizationMember)(nil)).
+			Where("organization_id = ? AND user_id = ?", orgID, userID).
+			Exec(ctx)
+		if err := expectAffected(res, err, "member not found"); err != nil {
+			return err
+		}
+		return deactivateOrganizationWebhooks(ctx, tx, orgID, userID)
+	})
+}
+
+// ListTeamExpenses returns the expenses attributed to the organization, most
+// recent first.
+func ListTeamExpenses(ctx context.Context, db *bun.DB, orgID int, filter TeamFilter, include ExpenseRelations) ([]models.Expense, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	expenses := []models.Expense{}
+	q := db.NewSelect().Model(&expenses).
+		Relation("Violations").
+		Where("expense.organization_id = ?", orgID).
+		OrderExpr("expense.date DESC, expense.id DESC")
+	err := filter.apply(include.apply(q), "expense").Scan(ctx)
+	return expenses, err
+}
+
+// GetTeamReport sums the organization's expenses per member and category.
+// Former members who still have expenses attributed to the organization are
+// included.
+func GetTeamReport(ctx context.Context, db *bun.DB, orgID int, filter TeamFilter) (*TeamReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var rows []struct {
+		UserID       int
+		FirstName    string
+		LastName     string
+		CategoryID   int
+		CategoryName string
+		Total        float64
+		Count        int
+	}
+	q := db.NewSelect().
+		TableExpr("expenses AS e").
+		Join("JOIN users AS u ON u.id = e.owner_id").
+		Join("LEFT JOIN categories AS c ON c.id = e.category_id").
+		ColumnExpr("u.id AS user_id, u.first_name, u.last_name").
+		ColumnExpr("COALESCE(c.id, 0) AS category_id, COALESCE(c.name, '') AS category_name").
+		ColumnExpr("CAST(SUM(e.amount) AS REAL) AS total, COUNT(*) AS count").
+		Where("e.organization_id = ?", orgID).
+		GroupExpr("u.id, u.first_name, u.last_name, c.id, c.name").
+		OrderExpr("u.last_name, u.first_name, u.id, category_name")
+	if err := filter.apply(q, "e").Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	report := &TeamReport{OrganizationID: orgID, Members: []MemberSpend{}, Categories: []CategorySpend{}}
+	categories := map[int]int{}
+	for _, row := range rows {
+		spend := CategorySpend{CategoryID: row.CategoryID, CategoryName: row.CategoryName, Total: row.Total, Count: row.Count}
+
+		if n := len(report.Members); n == 0 || report.Members[n-1].UserID != row.UserID {
+			report.Members = append(report.Members, MemberSpend{UserID: row.UserID, FirstName: row.FirstName, LastName: row.LastName})
+		}
+		member := &report.Members[len(report.Members)-1]
+		member.Total += row.Total
+		member.Count += row.Count
+		member.Categories = append(member.Categories, spend)
+
+		i, ok := categories[row.CategoryID]
+		if !ok {
+			i = len(report.Categories)
+			categories[row.CategoryID] = i
+			report.Categories = append(report.Categories, CategorySpend{CategoryID: row.CategoryID, CategoryName: row.CategoryName})
+		}
+		report.Categories[i].Total += row.Total
+		report.Categories[i].Count += row.Count
+
+		report.Total += row.Total
+		report.Count += row.Count
+	}
+	sort.SliceStable(report.Categories, func(i, j int) bool {
+		return report.Categories[i].CategoryName < report.Categories[j].CategoryName
+	})
+	return report, nil
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// Fields policy conditions can test. weekday is the lower-case English name
+// of the expense date's day, category the name of its category and hasReceipt
+// whether an uploaded receipt is attached.
+var (
+	numericPolicyFields = map[string]func(*models.Expense) float64{
+		"amount":     func(e *models.Expense) float64 { return float64(e.Amount) },
+		"distanceKm": func(e *models.Expense) float64 { return e.DistanceKm },
+		"days":       func(e *models.Expense) float64 { return float64(e.Days) },
+	}
+	textPolicyFields = map[string]func(*models.Expense, string) string{
+		"category":    func(_ *models.Expense, category string) string { return category },
+		"merchant":    func(e *models.Expense, _ string) string { return e.Merchant },
+		"title":       func(e *models.Expense, _ string) string { return e.Title },
+		"description": func(e *models.Expense, _ string) string { return e.Description },
+		"type":        func(e *models.Expense, _ string) string { return e.Type },
+		"vehicle":     func(e *models.Expense, _ string) string { return e.Vehicle },
+		"destination": func(e *models.Expense, _ string) string { return e.Destination },
+		"weekday":     func(e *models.Expense, _ string) string { return strings.ToLower(e.Date.Weekday().String()) },
+	}
+	booleanPolicyFields = map[string]func(*models.Expense) bool{
+		"hasReceipt": func(e *models.Expense) bool { return e.ReceiptID != 0 },
+	}
+)
+
+// ValidatePolicyConditions checks that every condition uses a known field, an
+// operator that applies to it and a value of the right type.
+func ValidatePolicyConditions(conditions []models.PolicyCondition) error {
+	if len(conditions) == 0 {
+		return invalid("a rule needs at least one condition", nil)
+	}
+	for i, c := range conditions {
+		if _, err := conditionMatcher(c); err != nil {
+			return invalid(fmt.Sprintf("condition %d: %s", i+1, err.Error()), nil)
+		}
+	}
+	return nil
+}
+
+// conditionMatcher compiles a condition into a function reporting whether an
+// expense, whose category is named category, matches it.
+func conditionMatcher(c models.PolicyCondition) (func(e *models.Expense, category string) bool, error) {
+	if field, ok := numericPolicyFields[c.Field]; ok {
+		var want float64
+		if err := json.Unmarshal(c.Value, &want); err != nil {
+			return nil, fmt.Errorf("%s must be compared with a number", c.Field)
+		}
+		var compare func(float64) bool
+		switch c.Operator {
+		case "eq":
+			compare = func(v float64) bool { return v == want }
+		case "neq":
+			compare = func(v float64) bool { return v != want }
+		case "gt":
+			compare = func(v float64) bool { return v > want }
+		case "gte":
+			compare = func(v float64) bool { return v >= want }
+		case "lt":
+			compare = func(v float64) bool { return v < want }
+		case "lte":
+			compare = func(v float64) bool { return v <= want }
+		default:
+			return nil, fmt.Errorf("unsupported operator %q for %s", c.Operator, c.Field)
+		}
+		return func(e *models.Expense, _ string) bool { return compare(field(e)) }, nil
+	}
+
+	if field, ok := booleanPolicyFields[c.Field]; ok {
+		var want bool
+		if err := json.Unmarshal(c.Value, &want); err != nil {
+			return nil, fmt.Errorf("%s must be compared with true or false", c.Field)
+		}
+		switch c.Operator {
+		case "eq":
+		case "neq":
+			want = !want
+		default:
+			return nil, fmt.Errorf("unsupported operator %q for %s", c.Operator, c.Field)
+		}
+		return func(e *models.Expense, _ string) bool { return field(e) == want }, nil
+	}
+
+	field, ok := textPolicyFields[c.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", c.Field)
+	}
+	normalize := func(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+
+	var compare func(string) bool
+	switch c.Operator {
+	case "empty", "not_empty":
+		empty := c.Operator == "empty"
+		compare = func(v string) bool { return (v == "") == empty }
+	case "eq", "neq", "contains":
+		var want string
+		if err := json.Unmarshal(c.Value, &want); err != nil {
+			return nil, fmt.Errorf("%s %s needs a string", c.Field, c.Operator)
+		}
+		want = normalize(want)
+		switch c.Operator {
+		case "eq":
+			compare = func(v string) bool { return v == want }
+		case "neq":
+			compare = func(v string) bool { return v != want }
+		default:
+			compare = func(v string) bool { return strings.Contains(v, want) }
+		}
+	case "in", "not_in":
+		var values []string
+		if err := json.Unmarshal(c.Value, &values); err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("%s %s needs a list of strings", c.Field, c.Operator)
+		}
+		set := make(map[string]bool, len(values))
+		for _, v := range values {
+			set[normalize(v)] = true
+		}
+		in := c.Operator == "in"
+		compare = func(v string) bool { return set[v] == in }
+	default:
+		return nil, fmt.Errorf("unsupported operator %q for %s", c.Operator, c.Field)
+	}
+	return func(e *models.Expense, category string) bool { return compare(normalize(field(e, category))) }, nil
+}
+
+// ruleMatches reports whether the expense matches all the conditions of rule.
+// Invalid conditions never match.
+func ruleMatches(rule *models.PolicyRule, expense *models.Expense, category string) bool {
+	for _, c := range rule.Conditions {
+		match, err := conditionMatcher(c)
+		if err != nil || !match(expense, category) {
+			return false
+		}
+	}
+	return len(rule.Conditions) > 0
+}
+
+// applyPolicies evaluates the enabled rules of the expense's organization
+// against expense and replaces its stored violations with the result.
+func applyPolicies(ctx context.Context, tx bun.Tx, expense *models.Expense) error {
+	var rules []models.PolicyRule
+	if err := tx.NewSelect().Model(&rules).
+		Where("enabled").
+		Where(inOrganization, expense.OrganizationID).
+		OrderExpr("id").
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	var category string
+	if expense.CategoryID != 0 {
+		if err := tx.NewSelect().Model((*models.Category)(nil)).
+			Column("name").
+			Where("id = ?", expense.CategoryID).
+			Scan(ctx, &category); err != nil {
+			return translateError(err, "category not found", "")
+		}
+	}
+
+	if _, err := tx.NewDelete().Model((*models.PolicyViolation)(nil)).
+		Where("expense_id = ?", expense.ID).
+		Exec(ctx); err != nil {
+		return err
+	}
+
+	expense.Violations = []models.PolicyViolation{}
+	for i := range rules {
+		rule := &rules[i]
+		if !ruleMatches(rule, expense, category) {
+			continue
+		}
+		expense.Violations = append(expense.Violations, models.PolicyViolation{
+			ExpenseID: expense.ID,
+			RuleID:    rule.ID,
+			RuleName:  rule.Name,
+			Message:   rule.Message,
+			Severity:  rule.Severity,
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+	if len(expense.Violations) == 0 {
+		return nil
+	}
+	_, err := tx.NewInsert().Model(&expense.Violations).Exec(ctx)
+	return err
+}
+
+// ListPolicyRules returns the rules of the organization orgID.
+func ListPolicyRules(ctx context.Context, db *bun.DB, orgID int) ([]models.PolicyRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	rules := []models.PolicyRule{}
+	err := db.NewSelect().Model(&rules).Where(inOrganization, orgID).OrderExpr("name").Scan(ctx)
+	return rules, err
+}
+
+// CreatePolicyRule saves a new rule of rule.OrganizationID. It applies to the
+// organization's expenses created or updated from now on.
+func CreatePolicyRule(ctx context.Context, db *bun.DB, rule *models.PolicyRule) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	if err := ValidatePolicyConditions(rule.Conditions); err != nil {
+		return err
+	}
+	_, err := db.NewInsert().Model(rule).Returning("id, created_at, updated_at").Exec(ctx)
+	return translateError(err, "", "a rule with this name already exists")
+}
+
+func UpdatePolicyRule(ctx context.Context, db *bun.DB, rule *models.PolicyRule) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	if err := ValidatePolicyConditions(rule.Conditions); err != nil {
+		return err
+	}
+	rule.UpdatedAt = time.Now().UTC()
+	res, err := db.NewUpdate().Model(rule).
+		Column("name", "message", "severity", "enabled", "conditions", "updated_at").
+		WherePK().
+		Where(inOrganization, rule.OrganizationID).
+		Returning("created_at").
+		Exec(ctx)
+	return expectAffected(res, translateError(err, "", "a rule with this name already exists"), "rule not found")
+}
+
+// DeletePolicyRule deletes a rule of the organization orgID along with the
+// violations it raised.
+func DeletePolicyRule(ctx context.Context, db *bun.DB, orgID, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewDelete().Model((*models.PolicyRule)(nil)).
+		Where("id = ?", id).
+		Where(inOrganization, orgID).
+		Exec(ctx)
+	return expectAffected(res, err, "rule not found")
+}
+
+// ViolationFilter narrows the violations report. Zero values are ignored; To
+// is inclusive.
+type ViolationFilter struct {
+	From     time.Time
+	To       time.Time
+	Severity string
+}
+
+// RuleViolations summarizes the violations of one rule.
+type RuleViolations struct {
+	RuleID   int     `json:"ruleId"`
+	RuleName string  `json:"ruleName"`
+	Severity string  `json:"severity"`
+	Count    int     `json:"count"`
+	Total    float64 `json:"total"`
+}
+
+// FlaggedExpense is an expense listed in the violations report.
+type FlaggedExpense struct {
+	ExpenseID int       `json:"expenseId"`
+	OwnerID   int       `json:"ownerId"`
+	Title     string    `json:"title"`
+	Merchant  string    `json:"merchant"`
+	Date      time.Time `json:"date"`
+	Amount    float64   `json:"amount"`
+	RuleID    int       `json:"ruleId"`
+	RuleName  string    `json:"ruleName"`
+	Message   string    `json:"message"`
+	Severity  string    `json:"severity"`
+}
+
+// ViolationsReport lists policy violations, summarized per rule.
+type ViolationsReport struct {
+	Rules      []RuleViolations `json:"rules"`
+	Violations []FlaggedExpense `json:"violations"`
+}
+
+// GetViolationsReport returns the violations of the rules of the organization
+// orgID, most recent expenses first.
+func GetViolationsReport(ctx context.Context, db *bun.DB, orgID int, filter ViolationFilter) (*ViolationsReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	q := db.NewSelect().
+		TableExpr("policy_violations AS v").
+		Join("JOIN expenses AS e ON e.id = v.expense_id").
+		Join("JOIN policy_rules AS r ON r.id = v.rule_id").
+		Where("coalesce(r.organization_id, 0) = ?", orgID)
+	if !filter.From.IsZero() {
+		q = q.Where("e.date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("e.date <= ?", filter.To)
+	}
+	if filter.Severity != "" {
+		q = q.Where("v.severity = ?", filter.Severity)
+	}
+
+	report := &ViolationsReport{Rules: []RuleViolations{}, Violations: []FlaggedExpense{}}
+	if err := q.Clone().
+		ColumnExpr("e.id AS expense_id, e.owner_id, e.title, e.merchant, e.date, CAST(e.amount AS REAL) AS amount").
+		ColumnExpr("v.rule_id, v.rule_name, v.message, v.severity").
+		OrderExpr("e.date DESC, e.id DESC, v.rule_id").
+		Scan(ctx, &report.Violations); err != nil {
+		return nil, err
+	}
+	err := q.
+		ColumnExpr("v.rule_id, MAX(v.rule_name) AS rule_name, MAX(v.severity) AS severity").
+		ColumnExpr("COUNT(*) AS count, CAST(SUM(e.amount) AS REAL) AS total").
+		GroupExpr("v.rule_id").
+		OrderExpr("count DESC, rule_name").
+		Scan(ctx, &report.Rules)
+	return report, err
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+func condition(field, op string, value any) models.PolicyCondition {
+	c := models.PolicyCondition{Field: field, Operator: op}
+	if value != nil {
+		c.Value, _ = json.Marshal(value)
+	}
+	return c
+}
+
+func TestPolicyConditions(t *testing.T) {
+	t.Parallel()
+
+	saturday := time.Date(2025, 3, 8, 0, 0, 0, 0, time.UTC)
+	expense := &models.Expense{Title: "Team dinner", Merchant: " The Wine Bar ", Amount: 80, Date: saturday}
+
+	tests := []struct {
+		name      string
+		condition models.PolicyCondition
+		match     bool
+	}{
+		{"amount over", condition("amount", "gt", 75), true},
+		{"amount under", condition("amount", "lte", 75), false},
+		{"category name ignores case", condition("category", "eq", "meals"), true},
+		{"merchant contains", condition("merchant", "contains", "wine"), true},
+		{"merchant in list", condition("merchant", "in", []string{"the wine bar", "liquor store"}), true},
+		{"merchant not in list", condition("merchant", "not_in", []string{"the wine bar"}), false},
+		{"weekend", condition("weekday", "in", []string{"saturday", "sunday"}), true},
+		{"description empty", condition("description", "empty", nil), true},
+		{"title not empty", condition("title", "not_empty", nil), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.NoError(t, ValidatePolicyConditions([]models.PolicyCondition{test.condition}))
+			rule := &models.PolicyRule{Conditions: []models.PolicyCondition{test.condition}}
+			assert.Equal(t, test.match, ruleMatches(rule, expense, "Meals"))
+		})
+	}
+
+	t.Run("all conditions must match", func(t *testing.T) {
+		rule := &models.PolicyRule{Conditions: []models.PolicyCondition{
+			condition("category", "eq", "Meals"),
+			condition("amount", "gt", 100),
+		}}
+		assert.False(t, ruleMatches(rule, expense, "Meals"))
+		assert.False(t, ruleMatches(&models.PolicyRule{}, expense, "Meals"), "a rule without conditions never matches")
+	})
+
+	t.Run("invalid conditions", func(t *testing.T) {
+		for _, c := range []models.PolicyCondition{
+			condition("colour", "eq", "red"),
+			condition("amount", "contains", "7"),
+			condition("amount", "gt", "75"),
+			condition("merchant", "in", "bar"),
+			condition("merchant", "gt", 3),
+		} {
+			assert.ErrorIs(t, ValidatePolicyConditions([]models.PolicyCondition{c}), ErrInvalid, c.Field+" "+c.Operator)
+		}
+		assert.ErrorIs(t, ValidatePolicyConditions(nil), ErrInvalid)
+	})
+}
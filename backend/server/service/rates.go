@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// mealsPerDay caps the number of provided meals deducted from a per diem.
+const mealsPerDay = 3
+
+// ListMileageRates returns the mileage rates of the organization orgID.
+func ListMileageRates(ctx context.Context, db *bun.DB, orgID int) ([]models.MileageRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	rates := []models.MileageRate{}
+	err := db.NewSelect().Model(&rates).Where(inOrganization, orgID).OrderExpr("vehicle").Scan(ctx)
+	return rates, err
+}
+
+// SetMileageRate creates or replaces the rate of rate.Vehicle in
+// rate.OrganizationID.
+func SetMileageRate(ctx context.Context, db *bun.DB, rate *models.MileageRate) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	rate.UpdatedAt = time.Now().UTC()
+	_, err := db.NewInsert().Model(rate).
+		On("CONFLICT (coalesce(organization_id, 0), vehicle) DO UPDATE").
+		Set("rate_per_km = EXCLUDED.rate_per_km, updated_at = EXCLUDED.updated_at").
+		Returning("id").
+		Exec(ctx)
+	return err
+}
+
+func DeleteMileageRate(ctx context.Context, db *bun.DB, orgID int, vehicle string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewDelete().Model((*models.MileageRate)(nil)).
+		Where("vehicle = ?", vehicle).
+		Where(inOrganization, orgID).
+		Exec(ctx)
+	return expectAffected(res, err, "mileage rate not found")
+}
+
+// ListPerDiemRates returns the per-diem rates of the organization orgID.
+func ListPerDiemRates(ctx context.Context, db *bun.DB, orgID int) ([]models.PerDiemRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	rates := []models.PerDiemRate{}
+	err := db.NewSelect().Model(&rates).Where(inOrganization, orgID).OrderExpr("destination").Scan(ctx)
+	return rates, err
+}
+
+// SetPerDiemRate creates or replaces the rates of rate.Destination in
+// rate.OrganizationID.
+func SetPerDiemRate(ctx context.Context, db *bun.DB, rate *models.PerDiemRate) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	rate.UpdatedAt = time.Now().UTC()
+	_, err := db.NewInsert().Model(rate).
+		On("CONFLICT (coalesce(organization_id, 0), destination) DO UPDATE").
+		Set("daily_rate = EXCLUDED.daily_rate, meal_rate = EXCLUDED.meal_rate, updated_at = EXCLUDED.updated_at").
+		Returning("id").
+		Exec(ctx)
+	return err
+}
+
+func DeletePerDiemRate(ctx context.Context, db *bun.DB, orgID int, destination string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewDelete().Model((*models.PerDiemRate)(nil)).
+		Where("destination = ?", destination).
+		Where(inOrganization, orgID).
+		Exec(ctx)
+	return expectAffected(res, err, "per-diem rate not found")
+}
+
+func roundCents(amount float64) models.Amount {
+	return models.Amount(math.Round(amount*100) / 100)
+}
+
+// repriceExpense prices an edited expense. The rates are only looked up again
+// when the type or the inputs of the amount changed, so that editing the title
+// of a past claim does not reprice it at the current rates.
+func repriceExpense(ctx context.Context, db bun.IDB, expense, stored *models.Expense) error {
+	if expense.Type == models.ExpenseTypeReceipt || !samePriceInputs(expense, stored) {
+		return priceExpense(ctx, db, expense)
+	}
+	expense.Rate = stored.Rate
+	switch expense.Type {
+	case models.ExpenseTypeMileage:
+		expense.Amount = roundCents(expense.DistanceKm * stored.Rate)
+	case models.ExpenseTypePerDiem:
+		// the meal rate is not stored, but the same inputs gave this amount
+		expense.Amount = stored.Amount
+	}
+	return nil
+}
+
+func samePriceInputs(expense, stored *models.Expense) bool {
+	return expense.Type == stored.Type &&
+		expense.DistanceKm == stored.DistanceKm &&
+		expense.Vehicle == stored.Vehicle &&
+		expense.Destination == stored.Destination &&
+		expense.Days == stored.Days &&
+		expense.MealsProvided == stored.MealsProvided
+}
+
+// priceExpense clears the fields that do not apply to the expense type and,
+// for mileage and per-diem expenses, computes Amount from the current rates of
+// the expense's organization.
+func priceExpense(ctx context.Context, db bun.IDB, expense *models.Expense) error {
+	if expense.Type == "" {
+		expense.Type = models.ExpenseTypeReceipt
+	}
+	if expense.Type != models.ExpenseTypeMileage {
+		expense.DistanceKm, expense.Vehicle = 0, ""
+	}
+	if expense.Type != models.ExpenseTypePerDiem {
+		expense.Destination, expense.Days, expense.MealsProvided = "", 0, 0
+	}
+
+	switch expense.Type {
+	case models.ExpenseTypeReceipt:
+		expense.Rate = 0
+		return nil
+
+	case models.ExpenseTypeMileage:
+		if expense.DistanceKm <= 0 || expense.Vehicle == "" {
+			return invalid("mileage expenses need a distance and a vehicle", nil)
+		}
+		rate := new(models.MileageRate)
+		err := db.NewSelect().Model(rate).
+			Where("vehicle = ?", expense.Vehicle).
+			Where(inOrganization, expense.OrganizationID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid("no mileage rate for vehicle "+expense.Vehicle, err)
+		} else if err != nil {
+			return err
+		}
+		expense.Rate = rate.RatePerKm
+		expense.Amount = roundCents(expense.DistanceKm * rate.RatePerKm)
+		return nil
+
+	case models.ExpenseTypePerDiem:
+		if expense.Destination == "" || expense.Days <= 0 {
+			return invalid("per-diem expenses need a destination and a number of days", nil)
+		}
+		if expense.MealsProvided < 0 || expense.MealsProvided > expense.Days*mealsPerDay {
+			return invalid("meals provided cannot exceed three per day", nil)
+		}
+		rate := new(models.PerDiemRate)
+		err := db.NewSelect().Model(rate).
+			Where("destination = ?", expense.Destination).
+			Where(inOrganization, expense.OrganizationID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid("no per-diem rate for destination "+expense.Destination, err)
+		} else if err != nil {
+			return err
+		}
+		expense.Rate = rate.DailyRate
+		amount := float64(expense.Days)*rate.DailyRate - float64(expense.MealsProvided)*rate.MealRate
+		expense.Amount = roundCents(math.Max(amount, 0))
+		return nil
+
+	default:
+		return invalid("unknown expense type "+expense.Type, nil)
+	}
+}
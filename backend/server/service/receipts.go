@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/events"
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// maxReceiptScans is the number of scans returned by ListReceiptScans.
+const maxReceiptScans = 50
+
+// CreateReceiptScan stores an uploaded receipt and enqueues the job reading
+// it.
+func CreateReceiptScan(ctx context.Context, db *bun.DB, scan *models.ReceiptScan) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scan.Status = models.ReceiptScanPending
+	scan.Size = len(scan.Content)
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(scan).Returning("id, created_at").Exec(ctx); err != nil {
+			return err
+		}
+		job := &models.Job{UserID: scan.UserID, Type: models.JobTypeReceiptScan}
+		return EnqueueJob(ctx, tx, job, models.ReceiptScanPayload{ReceiptID: scan.ID})
+	})
+}
+
+// ListReceiptScans returns the user's latest scans, most recent first,
+// without their content.
+func ListReceiptScans(ctx context.Context, db *bun.DB, userID int) ([]models.ReceiptScan, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scans := []models.ReceiptScan{}
+	err := db.NewSelect().Model(&scans).
+		ExcludeColumn("content").
+		Where("user_id = ?", userID).
+		OrderExpr("id DESC").
+		Limit(maxReceiptScans).
+		Scan(ctx)
+	return scans, err
+}
+
+// GetReceiptScan returns one of the user's scans without its content.
+func GetReceiptScan(ctx context.Context, db *bun.DB, id, userID int) (*models.ReceiptScan, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scan := new(models.ReceiptScan)
+	err := db.NewSelect().Model(scan).
+		ExcludeColumn("content").
+		Where("id = ? AND user_id = ?", id, userID).
+		Scan(ctx)
+	return scan, translateError(err, "receipt not found", "")
+}
+
+// DeleteReceiptScan deletes one of the user's scans and the uploaded file.
+// The expenses it was attached to are left without a receipt, and their
+// policy rules evaluated again.
+func DeleteReceiptScan(ctx context.Context, db *bun.DB, id, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var expenses []models.Expense
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*models.ReceiptScan)(nil)).
+			Where("id = ? AND user_id = ?", id, userID).
+			Exec(ctx)
+		if err := expectAffected(res, err, "receipt not found"); err != nil {
+			return err
+		}
+		if err := tx.NewSelect().Model(&expenses).Where("receipt_id = ?", id).Scan(ctx); err != nil {
+			return err
+		}
+		for i := range expenses {
+			expense := &expenses[i]
+			expense.ReceiptID = 0
+			if _, err := tx.NewUpdate().Model(expense).Column("receipt_id").WherePK().Exec(ctx); err != nil {
+				return err
+			}
+			if err := applyPolicies(ctx, tx, expense); err != nil {
+				return err
+			}
+			if err := enqueueExpenseEvent(ctx, tx, models.WebhookEventExpenseUpdated, expense); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for i := range expenses {
+			Events.Publish(expenses[i].OwnerID, events.ExpenseUpdated, expenses[i].Response())
+		}
+	}
+	return err
+}
+
+// checkReceipt fails unless the receipt scan id was uploaded by userID. Zero
+// is no receipt.
+func checkReceipt(ctx context.Context, db bun.IDB, userID, id int) error {
+	if id == 0 {
+		return nil
+	}
+	exists, err := db.NewSelect().Model((*models.ReceiptScan)(nil)).
+		Where("id = ? AND user_id = ?", id, userID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return invalid("receipt not found", nil)
+	}
+	return nil
+}
+
+// GetReceiptScanContent returns a scan with its content.
+func GetReceiptScanContent(ctx context.Context, db *bun.DB, id int) (*models.ReceiptScan, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scan := new(models.ReceiptScan)
+	err := db.NewSelect().Model(scan).Where("id = ?", id).Scan(ctx)
+	return scan, translateError(err, "receipt not found", "")
+}
+
+// StartReceiptScan marks a scan as being processed.
+func StartReceiptScan(ctx context.Context, db *bun.DB, scan *models.ReceiptScan) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	scan.Status = models.ReceiptScanProcessing
+	res, err := db.NewUpdate().Model(scan).Column("status").WherePK().Exec(ctx)
+	return expectAffected(res, err, "receipt not found")
+}
+
+// CompleteReceiptScan saves the draft or the error of a finished scan.
+func CompleteReceiptScan(ctx context.Context, db *bun.DB, scan *models.ReceiptScan) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	now := time.Now().UTC()
+	scan.CompletedAt = &now
+	res, err := db.NewUpdate().Model(scan).Column("status", "draft", "error", "completed_at").WherePK().Exec(ctx)
+	return expectAffected(res, err, "receipt not found")
+}
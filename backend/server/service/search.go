@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+)
+
+// Snippet highlight markers. The rest of the snippet is HTML-escaped.
+const (
+	SnippetStart = "<mark>"
+	SnippetEnd   = "</mark>"
+)
+
+// snippetStart and snippetEnd delimit the matches in the snippets SQLite
+// returns. They are control characters, which are turned into the markers
+// once the text is escaped.
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+var snippetMarkers = strings.NewReplacer(snippetStart, SnippetStart, snippetEnd, SnippetEnd)
+
+// maxSearchTerms bounds the number of words a search query is made of.
+const maxSearchTerms = 10
+
+var searchTerm = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// ExpenseSearch is a full-text search of a user's expenses. Every word of
+// Query must match the beginning of a word of the title, description,
+// merchant or category. Zero dates are ignored; To is inclusive.
+type ExpenseSearch struct {
+	OwnerID int
+	Query   string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
+	Include ExpenseRelations
+}
+
+// ExpenseMatch is an expense found by SearchExpenses.
+type ExpenseMatch struct {
+	Expense *models.Expense
+	// Snippet is an HTML excerpt of the best matching field, with the
+	// matches wrapped in SnippetStart and SnippetEnd.
+	Snippet string
+	// Rank is the BM25 relevance of the match, lower is better.
+	Rank float64
+}
+
+// matchExpression turns user input into an FTS5 query of prefix terms, so
+// operators and quotes in the input are searched for rather than
+// interpreted.
+func matchExpression(query string) (string, error) {
+	terms := searchTerm.FindAllString(query, maxSearchTerms+1)
+	if len(terms) == 0 {
+		return "", invalid("search query must contain a word", nil)
+	}
+	if len(terms) > maxSearchTerms {
+		return "", invalid(fmt.Sprintf("search query must contain at most %d words", maxSearchTerms), nil)
+	}
+	for i, term := range terms {
+		terms[i] = `"` + term + `"*`
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// SearchExpenses returns the expenses matching s, most relevant first.
+// Matches in the title weigh the most, then the merchant, the category and
+// the description.
+func SearchExpenses(ctx context.Context, db *bun.DB, s ExpenseSearch) ([]ExpenseMatch, error) {
+	match, err := matchExpression(s.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var hits []struct {
+		ID      int
+		Snippet string
+		Rank    float64
+	}
+	q := db.NewSelect().
+		TableExpr("expenses_fts").
+		ColumnExpr("expenses_fts.rowid AS id").
+		ColumnExpr("snippet(expenses_fts, -1, ?, ?, '…', 12) AS snippet", snippetStart, snippetEnd).
+		ColumnExpr("bm25(expenses_fts, 10.0, 1.0, 5.0, 3.0) AS rank").
+		Join("JOIN expenses AS expense ON expense.id = expenses_fts.rowid").
+		Where("expenses_fts MATCH ?", match).
+		Where("expense.owner_id = ?", s.OwnerID).
+		OrderExpr("rank, expense.date DESC").
+		Limit(s.Limit).
+		Offset(s.Offset)
+	if err := (TeamFilter{From: s.From, To: s.To}).apply(q, "expense").Scan(ctx, &hits); err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return []ExpenseMatch{}, nil
+	}
+
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var expenses []models.Expense
+	eq := db.NewSelect().Model(&expenses).Relation("Violations").Where("expense.id IN (?)", bun.In(ids))
+	if err := s.Include.apply(eq).Scan(ctx); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Expense, len(expenses))
+	for i := range expenses {
+		byID[expenses[i].ID] = &expenses[i]
+	}
+
+	matches := make([]ExpenseMatch, 0, len(hits))
+	for _, hit := range hits {
+		if expense, ok := byID[hit.ID]; ok {
+			snippet := snippetMarkers.Replace(html.EscapeString(hit.Snippet))
+			matches = append(matches, ExpenseMatch{Expense: expense, Snippet: snippet, Rank: hit.Rank})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// ExternalIdentity is a user authenticated by an OpenID Connect provider.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// OIDCLogin holds the secrets of a single sign-on attempt.
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// StartOIDCLogin generates and remembers the state, nonce and PKCE verifier
+// of a new single sign-on attempt. Expired attempts are purged on the way.
+func StartOIDCLogin(ctx context.Context, db *bun.DB, ttl time.Duration) (*OIDCLogin, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	login := new(OIDCLogin)
+	for _, secret := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		token, err := utils.GenerateSecureToken(32)
+		if err != nil {
+			return nil, err
+		}
+		*secret = token
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.NewDelete().Model((*models.OIDCLoginState)(nil)).Where("expires_at <= ?", now).Exec(ctx); err != nil {
+		return nil, err
+	}
+	_, err := db.NewInsert().Model(&models.OIDCLoginState{
+		StateHash:    utils.HashToken(login.State),
+		Nonce:        login.Nonce,
+		CodeVerifier: login.CodeVerifier,
+		ExpiresAt:    now.Add(ttl),
+	}).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// ConsumeOIDCLogin returns the attempt started with state and forgets it, so
+// a callback cannot be replayed.
+func ConsumeOIDCLogin(ctx context.Context, db *bun.DB, state string) (*OIDCLogin, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	row := new(models.OIDCLoginState)
+	err := db.NewDelete().Model(row).
+		Where("state_hash = ? AND expires_at > ?", utils.HashToken(state), time.Now().UTC()).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalid("invalid or expired login state", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLogin{State: state, Nonce: row.Nonce, CodeVerifier: row.CodeVerifier}, nil
+}
+
+// SignInWithIdentity returns the user linked to identity. On the first login
+// the identity is linked to the account with the same verified email, or a
+// new account is created when provision is set.
+func SignInWithIdentity(ctx context.Context, db *bun.DB, identity *ExternalIdentity, provision bool) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	user := new(models.User)
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now().UTC()
+		link := new(models.UserIdentity)
+		err := tx.NewSelect().Model(link).
+			Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).
+			Scan(ctx)
+		if err == nil {
+			if _, err := tx.NewUpdate().Model(link).
+				Set("email = ?", identity.Email).
+				Set("last_login = ?", now).
+				WherePK().
+				Exec(ctx); err != nil {
+				return err
+			}
+			return tx.NewSelect().Model(user).Where("id = ?", link.UserID).Scan(ctx)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// only a verified address proves the account belongs to the same person
+		if identity.Email == "" || !identity.EmailVerified {
+			return forbidden("the identity provider did not verify the email address", nil)
+		}
+		err = tx.NewSelect().Model(user).Where("email = ?", identity.Email).Scan(ctx)
+		switch {
+		case err == nil:
+			if !user.IsEmailVerified() {
+				user.EmailVerifiedAt = now
+				if _, err := tx.NewUpdate().Model(user).Column("email_verified_at").WherePK().Exec(ctx); err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, sql.ErrNoRows) && provision:
+			if err := provisionUser(ctx, tx, user, identity, now); err != nil {
+				return err
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			return forbidden("no account is registered with this email address", err)
+		default:
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(&models.UserIdentity{
+			UserID:    user.ID,
+			Issuer:    identity.Issuer,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			LastLogin: now,
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates the account of identity. It gets an unknown random
+// password; the user can set one with a password reset.
+func provisionUser(ctx context.Context, tx bun.Tx, user *models.User, identity *ExternalIdentity, now time.Time) error {
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+	hash, err := utils.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+
+	*user = models.User{
+		Email:           identity.Email,
+		Password:        hash,
+		FirstName:       identity.FirstName,
+		LastName:        identity.LastName,
+		EmailVerifiedAt: now,
+	}
+	if user.FirstName == "" {
+		user.FirstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+	_, err = tx.NewInsert().Model(user).Returning("*").Exec(ctx)
+	return translateError(err, "", "email is already registered")
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// IssueUserToken creates a new single-use token for the user and returns it
+// in clear text. Outstanding tokens with the same purpose are revoked so only
+// the most recent email works.
+func IssueUserToken(ctx context.Context, db *bun.DB, userID int, purpose string, ttl time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err = db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().Model((*models.UserToken)(nil)).
+			Set("used_at = ?", now).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a valid token as used and returns it. The update is
+// a single statement so a token cannot be redeemed twice concurrently.
+func consumeUserToken(ctx context.Context, db bun.IDB, purpose, token string) (*models.UserToken, error) {
+	now := time.Now().UTC()
+	userToken := new(models.UserToken)
+	err := db.NewUpdate().Model(userToken).
+		Set("used_at = ?", now).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).
+		Where("used_at IS NULL AND expires_at > ?", now).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalid("invalid or expired token", err)
+	}
+	return userToken, err
+}
+
+// VerifyEmail redeems an email verification token and marks the owner's
+// address as verified.
+func VerifyEmail(ctx context.Context, db *bun.DB, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, err := consumeUserToken(ctx, tx, models.TokenPurposeEmailVerification, token)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model((*models.User)(nil)).
+			Set("email_verified_at = ?", time.Now().UTC()).
+			Where("id = ? AND email_verified_at IS NULL", userToken.UserID).
+			Exec(ctx)
+		return err
+	})
+}
+
+// ResetPassword redeems a password reset token and replaces the owner's
+// password hash. A successful reset also proves ownership of the address.
+func ResetPassword(ctx context.Context, db *bun.DB, token, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		userToken, err := consumeUserToken(ctx, tx, models.TokenPurposePasswordReset, token)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model((*models.User)(nil)).
+			Set("password = ?", passwordHash).
+			Set("email_verified_at = COALESCE(email_verified_at, ?)", time.Now().UTC()).
+			Where("id = ?", userToken.UserID).
+			Exec(ctx)
+		return err
+	})
+}
@@ -18,7 +18,7 @@ func CreateUser(ctx context.Context, db *bun.DB, user *models.User) error {
 	defer cancel()
 
 	_, err := db.NewInsert().Model(user).Returning("id").Exec(ctx)
-	return err
+	return translateError(err, "", "email is already registered")
 }
 
 func GetUserById(ctx context.Context, db *bun.DB, id int) (*models.User, error) {
@@ -27,7 +27,7 @@ func GetUserById(ctx context.Context, db *bun.DB, id int) (*models.User, error)
 
 	user := new(models.User)
 	err := db.NewSelect().Model(user).Where("id = ?", id).Scan(ctx)
-	return user, err
+	return user, translateError(err, "user not found", "")
 }
 
 func GetUserByEmail(ctx context.Context, db *bun.DB, email string) (*models.User, error) {
@@ -36,16 +36,20 @@ func GetUserByEmail(ctx context.Context, db *bun.DB, email string) (*models.User
 
 	user := new(models.User)
 	err := db.NewSelect().Model(user).Where("email = ?", email).Scan(ctx)
-	return user, err
+	return user, translateError(err, "user not found", "")
 }
 
-func UpdateUser(ctx context.Context, db *bun.DB, user *models.User) error {
+// UpdateUser saves user. When columns are given only those are written.
+func UpdateUser(ctx context.Context, db *bun.DB, user *models.User, columns ...string) error {
 	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
 	defer cancel()
 
-	_, err := db.NewUpdate().Model(&user).
-		WherePK().Exec(ctx)
-	return err
+	q := db.NewUpdate().Model(user).WherePK()
+	if len(columns) > 0 {
+		q = q.Column(columns...)
+	}
+	res, err := q.Exec(ctx)
+	return expectAffected(res, err, "user not found")
 }
 
 func DeleteUser(ctx context.Context, db *bun.DB, id int) error {
@@ -56,18 +60,127 @@ func DeleteUser(ctx context.Context, db *bun.DB, id int) error {
 	return err
 }
 
-// ListUsers returns a list of first 100 users.
-func ListUsers(ctx context.Context, db *bun.DB) ([]models.OutgoingUser, error) {
+// GetUsersByID returns the users with the given IDs, keyed by ID.
+func GetUsersByID(ctx context.Context, db *bun.DB, ids []int) (map[int]*models.User, error) {
 	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
 	defer cancel()
 
+	var users []*models.User
+	if err := db.NewSelect().Model(&users).Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	return byID, nil
+}
+
+// ListUsers returns the first 100 users the user can see: the members of
+// their organization, or only themselves when they have none.
+func ListUsers(ctx context.Context, db *bun.DB, userID int) ([]models.OutgoingUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	orgID, err := OrganizationOf(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	var users []models.OutgoingUser
-	err := db.NewSelect().
+	q := db.NewSelect().
 		ModelTableExpr("users as u1").
 		Model(&users).
-		ColumnExpr("u1.id, u1.first_name, u1.last_name, u1.is_admin").
-		Order("last_name ASC").
-		Limit(100).
-		Scan(ctx)
+		ColumnExpr("u1.id, u1.first_name, u1.last_name, u1.is_admin")
+	if orgID != 0 {
+		members := db.NewSelect().Model((*models.OrganizationMember)(nil)).
+			Column("user_id").
+			Where("organization_id = ?", orgID)
+		q = q.Where("u1.id IN (?)", members)
+	} else {
+		q = q.Where("u1.id = ?", userID)
+	}
+	err = q.Order("last_name ASC").Limit(100).Scan(ctx)
+	return users, err
+}
+
+// ListAccounts returns every user with their account details, by ID, for the
+// administrators.
+func ListAccounts(ctx context.Context, db *bun.DB) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	users := []models.User{}
+	err := db.NewSelect().Model(&users).OrderExpr("id").Scan(ctx)
 	return users, err
 }
+
+// CountAdmins returns the number of enabled administrators.
+func CountAdmins(ctx context.Context, db *bun.DB) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	return db.NewSelect().Model((*models.User)(nil)).Where("is_admin AND disabled_at IS NULL").Count(ctx)
+}
+
+// LockoutPolicy controls how repeated failed logins lock an account.
+type LockoutPolicy struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// LockDuration returns how long an account with attempts consecutive
+// failures stays locked. It doubles with every failure past the threshold.
+func (p LockoutPolicy) LockDuration(attempts int) time.Duration {
+	if p.Threshold <= 0 || attempts < p.Threshold {
+		return 0
+	}
+	d := p.Duration
+	for i := p.Threshold; i < attempts && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
+
+// RecordFailedLogin increments the user's failed login counter and locks the
+// account once the policy threshold is reached. The user is updated in place.
+func RecordFailedLogin(ctx context.Context, db *bun.DB, user *models.User, policy LockoutPolicy) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var attempts int
+	err := db.NewUpdate().Model((*models.User)(nil)).
+		Set("failed_login_attempts = failed_login_attempts + 1").
+		Where("id = ?", user.ID).
+		Returning("failed_login_attempts").
+		Scan(ctx, &attempts)
+	if err != nil {
+		return err
+	}
+	user.FailedLoginAttempts = attempts
+
+	if d := policy.LockDuration(attempts); d > 0 {
+		user.LockedUntil = time.Now().UTC().Add(d)
+		_, err = db.NewUpdate().Model(user).Column("locked_until").WherePK().Exec(ctx)
+	}
+	return err
+}
+
+// ResetFailedLogins clears the failed login counter after a successful login.
+func ResetFailedLogins(ctx context.Context, db *bun.DB, user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil.IsZero() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = time.Time{}
+	_, err := db.NewUpdate().Model(user).Column("failed_login_attempts", "locked_until").WherePK().Exec(ctx)
+	return err
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := LockoutPolicy{Threshold: 3, Duration: time.Minute, MaxDuration: 5 * time.Minute}
+	assert.Zero(t, policy.LockDuration(2))
+	assert.Equal(t, time.Minute, policy.LockDuration(3))
+	assert.Equal(t, 2*time.Minute, policy.LockDuration(4))
+	assert.Equal(t, 4*time.Minute, policy.LockDuration(5))
+	assert.Equal(t, 5*time.Minute, policy.LockDuration(6))
+	assert.Equal(t, 5*time.Minute, policy.LockDuration(60))
+
+	assert.Zero(t, LockoutPolicy{}.LockDuration(100), "a zero threshold disables lockout")
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// WebhookPayload is the body posted to webhook subscribers.
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+func CreateWebhook(ctx context.Context, db *bun.DB, subscription *models.WebhookSubscription) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	subscription.Active = true
+	_, err := db.NewInsert().Model(subscription).Returning("id, created_at").Exec(ctx)
+	return err
+}
+
+// ListWebhooks returns the subscriptions created by the user.
+func ListWebhooks(ctx context.Context, db *bun.DB, userID int) ([]models.WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	subscriptions := []models.WebhookSubscription{}
+	err := db.NewSelect().Model(&subscriptions).Where("user_id = ?", userID).OrderExpr("id").Scan(ctx)
+	return subscriptions, err
+}
+
+// DeleteWebhook deletes one of the user's subscriptions and its deliveries.
+func DeleteWebhook(ctx context.Context, db *bun.DB, id, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewDelete().Model((*models.WebhookSubscription)(nil)).
+		Where("id = ? AND user_id = ?", id, userID).
+		Exec(ctx)
+	return expectAffected(res, err, "webhook not found")
+}
+
+// ListWebhookDeliveries returns the latest deliveries of one of the user's
+// subscriptions, most recent first.
+func ListWebhookDeliveries(ctx context.Context, db *bun.DB, subscriptionID, userID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	exists, err := db.NewSelect().Model((*models.WebhookSubscription)(nil)).
+		Where("id = ? AND user_id = ?", subscriptionID, userID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFound("webhook not found", nil)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	err = db.NewSelect().Model(&deliveries).
+		Where("subscription_id = ?", subscriptionID).
+		OrderExpr("id DESC").
+		Limit(limit).
+		Scan(ctx)
+	return deliveries, err
+}
+
+// enqueueExpenseEvent writes a pending delivery for every active subscription
+// interested in event on expense. It runs in the transaction of the change,
+// so a notification is sent if and only if the change is committed.
+func enqueueExpenseEvent(ctx context.Context, tx bun.Tx, event string, expense *models.Expense) error {
+	var subscriptions []models.WebhookSubscription
+	q := tx.NewSelect().Model(&subscriptions).Where("active")
+	if expense.OrganizationID != 0 {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("user_id = ? AND organization_id IS NULL", expense.OwnerID).
+				WhereOr("organization_id = ?", expense.OrganizationID)
+		})
+	} else {
+		q = q.Where("user_id = ? AND organization_id IS NULL", expense.OwnerID)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return err
+	}
+
+	var deliveries []models.WebhookDelivery
+	var payload json.RawMessage
+	var eventID string
+	for i := range subscriptions {
+		if !subscriptions[i].Subscribes(event) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if eventID, err = utils.GenerateSecureToken(16); err != nil {
+				return err
+			}
+			payload, err = json.Marshal(WebhookPayload{ID: eventID, Event: event, CreatedAt: time.Now().UTC(), Data: expense.Response()})
+			if err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscriptions[i].ID,
+			OwnerID:        expense.OwnerID,
+			EventID:        eventID,
+			Event:          event,
+			Payload:        payload,
+			Status:         models.DeliveryStatusPending,
+			NextAttemptAt:  &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	_, err := tx.NewInsert().Model(&deliveries).Exec(ctx)
+	return err
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due, along with their subscription.
+func DueWebhookDeliveries(ctx context.Context, db *bun.DB, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+	err := db.NewSelect().Model(&deliveries).
+		Relation("Subscription").
+		Where("webhook_delivery.status = ?", models.DeliveryStatusPending).
+		Where("webhook_delivery.next_attempt_at <= ?", now.UTC()).
+		Where("subscription.active").
+		OrderExpr("webhook_delivery.next_attempt_at, webhook_delivery.id").
+		Limit(limit).
+		Scan(ctx)
+	return deliveries, err
+}
+
+// RecordWebhookAttempt saves the outcome of a delivery attempt.
+func RecordWebhookAttempt(ctx context.Context, db *bun.DB, delivery *models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, SQLTimeoutDuration)
+	defer cancel()
+
+	res, err := db.NewUpdate().Model(delivery).
+		Column("status", "attempts", "next_attempt_at", "last_attempt_at", "response_status", "last_error", "delivered_at").
+		WherePK().
+		Exec(ctx)
+	return expectAffected(res, err, "delivery not found")
+}
+
+// deactivateOrganizationWebhooks stops the organization-wide subscriptions of
+// a user who lost access to the team's expenses.
+func deactivateOrganizationWebhooks(ctx context.Context, tx bun.Tx, orgID, userID int) error {
+	_, err := tx.NewUpdate().Model((*models.WebhookSubscription)(nil)).
+		Set("active = ?", false).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/sso"
+)
+
+// OIDCProvider signs users in with the configured OpenID Connect provider. It
+// is nil when single sign-on is disabled.
+var OIDCProvider *sso.Provider
+
+func init() {
+	OIDCProvider = sso.New(config.Current.OIDC, &http.Client{Timeout: 10 * time.Second})
+}
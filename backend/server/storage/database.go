@@ -14,9 +14,11 @@ import (
 )
 
 func NewBunDB(filePath ...string) (*bun.DB, error) {
-	dataSource := "file::memory:?cache=shared&_fk=1"
+	// _fk is understood by mattn/go-sqlite3 and _pragma by modernc.org/sqlite,
+	// sqliteshim picks one of them depending on the platform
+	dataSource := "file::memory:?cache=shared&_fk=1&_pragma=foreign_keys(1)"
 	if len(filePath) > 0 {
-		dataSource = fmt.Sprintf("file:%s?cache=shared&_fk=1", filePath[0])
+		dataSource = fmt.Sprintf("file:%s?cache=shared&_fk=1&_pragma=foreign_keys(1)", filePath[0])
 	}
 	conn, err := sql.Open(sqliteshim.ShimName, dataSource)
 	if err != nil {
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by LockFile when another process holds a conflicting
+// lock on the file.
+var ErrLocked = errors.New("file locked by another process")
+
+// LockFile takes an advisory lock on path, which is created when missing,
+// until the returned file is closed or the process exits. Several processes
+// can hold a shared lock, a single one an exclusive lock. It does not wait
+// and fails with ErrLocked when the lock is taken.
+func LockFile(path string, exclusive bool) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file, exclusive); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
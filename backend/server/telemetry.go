@@ -0,0 +1,24 @@
+package server
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/telemetry"
+)
+
+// TracerProvider exports the traces. main shuts it down after the server
+// stops, flushing the last spans.
+var TracerProvider *sdktrace.TracerProvider
+
+func init() {
+	cfg := config.Current.Telemetry
+	provider, err := telemetry.SetupTracing(context.Background(), cfg.TraceExporter, cfg.TraceSampleRatio)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up tracing")
+	}
+	TracerProvider = provider
+}
@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryHook records the durations of the database queries and traces the
+// queries made within a trace, leaving out the polling of the background
+// workers. Failed and slow queries are logged with the logger of the
+// request. The statements are left out of the spans and logs: bun inlines
+// the values, which include emails and password hashes.
+type QueryHook struct {
+	// SlowQuery is the duration above which queries are logged, never when
+	// 0.
+	SlowQuery time.Duration
+}
+
+var _ bun.QueryHook = QueryHook{}
+
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	operation, table := describeQuery(event)
+	name := operation
+	if table != "" {
+		name += " " + table
+	}
+	ctx, _ = tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.StartTime),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(operation),
+			semconv.DBCollectionName(table),
+		),
+	)
+	return ctx
+}
+
+func (h QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	operation, table := describeQuery(event)
+	duration := time.Since(event.StartTime)
+	dbQueryDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
+
+	// a no-op span outside of a trace
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+	switch {
+	case event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows):
+		dbQueryErrors.WithLabelValues(operation, table).Inc()
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, "query failed")
+		log.Ctx(ctx).Warn().Err(event.Err).
+			Str("operation", operation).Str("table", table).Dur("duration", duration).
+			Msg("query failed")
+	case h.SlowQuery > 0 && duration > h.SlowQuery:
+		log.Ctx(ctx).Warn().
+			Str("operation", operation).Str("table", table).Dur("duration", duration).
+			Msg("slow query")
+	}
+}
+
+func describeQuery(event *bun.QueryEvent) (operation, table string) {
+	if event.IQuery != nil {
+		table = event.IQuery.GetTableName()
+	}
+	return event.Operation(), table
+}
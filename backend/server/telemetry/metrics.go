@@ -0,0 +1,100 @@
+// Package telemetry exports the Prometheus metrics and OpenTelemetry traces
+// of the server.
+package telemetry
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uptrace/bun"
+)
+
+const namespace = "expense_manager"
+
+// Login results.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginLocked  = "locked"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by operation and table.",
+		// 0.25ms to 4s
+		Buckets: prometheus.ExponentialBuckets(0.00025, 2, 15),
+	}, []string{"operation", "table"})
+	dbQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database queries that failed, by operation and table.",
+	}, []string{"operation", "table"})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result: success, failure or locked.",
+	}, []string{"result"})
+	expensesCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expenses_created_total",
+		Help:      "Expenses created, by type.",
+	}, []string{"type"})
+)
+
+func init() {
+	// report the results that did not happen yet as 0
+	for _, result := range []string{LoginSuccess, LoginFailure, LoginLocked} {
+		logins.WithLabelValues(result)
+	}
+}
+
+// RecordLogin counts a login attempt with the given result.
+func RecordLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
+
+// RecordExpenseCreated counts a created expense.
+func RecordExpenseCreated(expenseType string) {
+	expensesCreated.WithLabelValues(expenseType).Inc()
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(db *bun.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db.DB, name))
+}
+
+// MetricsHandler serves the metrics in the Prometheus format. When token is
+// set, scrapers must send it as a bearer token.
+func MetricsHandler(token string) gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(c *gin.Context) {
+		if token != "" {
+			sent := []byte(c.GetHeader("Authorization"))
+			if subtle.ConstantTimeCompare(sent, []byte("Bearer "+token)) != 1 {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+)
+
+func TestTelemetry(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	db, err := storage.NewBunDB()
+	require.NoError(t, err)
+	db.AddQueryHook(QueryHook{})
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(Middleware())
+	router.GET("/metrics", MetricsHandler("secret"))
+	router.GET("/things/:id", func(ctx *gin.Context) {
+		var n int
+		require.NoError(t, db.NewSelect().ColumnExpr("1").Scan(ctx, &n))
+		ctx.Status(204)
+	})
+	serve := func(target string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("traces requests and queries", func(t *testing.T) {
+		traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		assert.Equal(t, 204, serve("/things/42", "traceparent", traceparent).Code)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		query, request := spans[0], spans[1]
+		assert.Equal(t, "GET /things/:id", request.Name())
+		assert.Equal(t, trace.SpanKindServer, request.SpanKind())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+		assert.Equal(t, "SELECT", query.Name())
+		assert.Equal(t, request.SpanContext().SpanID(), query.Parent().SpanID())
+
+		var n int
+		require.NoError(t, db.NewSelect().ColumnExpr("1").Scan(context.Background(), &n))
+		assert.Len(t, recorder.Ended(), 2, "queries outside of a trace are not traced")
+	})
+
+	t.Run("serves the metrics", func(t *testing.T) {
+		serve("/nowhere")
+		for _, method := range []string{"FOO", "BAR"} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/things/1", nil))
+		}
+		assert.Equal(t, 401, serve("/metrics").Code)
+		assert.Equal(t, 401, serve("/metrics", "Authorization", "Bearer wrong").Code)
+
+		w := serve("/metrics", "Authorization", "Bearer secret")
+		require.Equal(t, 200, w.Code)
+		body := w.Body.String()
+		assert.Contains(t, body, `expense_manager_http_requests_total{method="GET",route="/things/:id",status="204"} 1`)
+		assert.Contains(t, body, `expense_manager_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+		assert.NotContains(t, body, `method="FOO"`)
+		assert.Regexp(t, `expense_manager_http_requests_total\{method="other",route="[^"]*",status="\d+"\} 2`, body)
+		assert.Contains(t, body, `expense_manager_http_request_duration_seconds_count{method="GET",route="/things/:id"} 1`)
+		assert.Contains(t, body, `expense_manager_db_query_duration_seconds_count{operation="SELECT",table=""} 2`)
+		assert.Contains(t, body, `expense_manager_logins_total{result="failure"} 0`)
+	})
+}
+
+func TestSetupTracing(t *testing.T) {
+	_, err := SetupTracing(context.Background(), "carrier-pigeon", 1)
+	assert.EqualError(t, err, `unknown trace exporter "carrier-pigeon"`)
+}
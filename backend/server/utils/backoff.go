@@ -0,0 +1,13 @@
+package utils
+
+import "time"
+
+// Backoff returns how long to wait after the given number of failed attempts
+// when the first retry waits initial and the delay doubles up to max.
+func Backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, time.Second, Backoff(1, time.Second, 10*time.Second))
+	assert.Equal(t, 2*time.Second, Backoff(2, time.Second, 10*time.Second))
+	assert.Equal(t, 8*time.Second, Backoff(4, time.Second, 10*time.Second))
+	assert.Equal(t, 10*time.Second, Backoff(5, time.Second, 10*time.Second))
+	assert.Equal(t, 10*time.Second, Backoff(50, time.Second, 10*time.Second))
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	testCases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range testCases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	t.Parallel()
+
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	now := time.Now()
+	step := TOTPStep(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := TOTPCode(secret, step+offset)
+		require.NoError(t, err)
+		matched, ok := ValidateTOTP(secret, code, now)
+		assert.True(t, ok, "offset %d", offset)
+		assert.Equal(t, step+offset, matched)
+	}
+
+	code, err := TOTPCode(secret, step+2)
+	require.NoError(t, err)
+	_, ok := ValidateTOTP(secret, code, now)
+	assert.False(t, ok, "codes outside the skew window are refused")
+
+	_, ok = ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+
+	uri := TOTPURI("Expense Manager", "jane@test.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Expense%20Manager:jane@test.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.Equal(t, code, NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))+" "))
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	t.Parallel()
+
+	key := make([]byte, 32)
+	ciphertext, err := Encrypt(key, "JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "JBSWY3DPEHPK3PXP")
+
+	plaintext, err := Decrypt(key, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", plaintext)
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	_, err = Decrypt(otherKey, ciphertext)
+	assert.Error(t, err)
+}
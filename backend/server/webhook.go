@@ -0,0 +1,24 @@
+package server
+
+import (
+	"github.com/Spiria-Digital/expense-manager/server/config"
+	"github.com/Spiria-Digital/expense-manager/server/webhook"
+)
+
+// WebhookDispatcher posts the queued webhook deliveries. It is started by
+// main alongside the HTTP server.
+var WebhookDispatcher *webhook.Dispatcher
+
+func init() {
+	cfg := config.Current.Webhooks
+	WebhookDispatcher = &webhook.Dispatcher{
+		DB:            BunDB,
+		Client:        webhook.NewClient(cfg.Timeout),
+		EncryptionKey: config.Current.EncryptionKey,
+		Interval:      cfg.Interval,
+		BatchSize:     50,
+		MaxAttempts:   cfg.MaxAttempts,
+		Backoff:       cfg.Backoff,
+		MaxBackoff:    cfg.MaxBackoff,
+	}
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for receivers that are not on the public
+// internet, so webhooks cannot be used to reach the internal network or the
+// cloud metadata service.
+var ErrForbiddenAddress = errors.New("webhook receivers must have a public address")
+
+// Resolver looks up the addresses of receiver hosts. Tests replace it.
+var Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+} = net.DefaultResolver
+
+// reservedNetworks are the non-public ranges net.IP does not report as
+// private: "this network" and the carrier-grade NAT range.
+var reservedNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)},
+}
+
+// IsPublic reports whether ip can be the address of a receiver: it is not a
+// loopback, private, link-local (such as 169.254.169.254), multicast or
+// unspecified address.
+func IsPublic(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of a receiver URL and fails with
+// ErrForbiddenAddress unless all its addresses are public. The addresses are
+// checked again when connecting, since the DNS records can change.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublic(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+
+	addrs, err := Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return ErrForbiddenAddress
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client posting deliveries. It only connects to
+// public addresses, ignores the proxy settings, which would hide the address
+// of the receiver, and does not follow redirects: a redirect is a failed
+// delivery.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialPublic refuses connections to addresses that are not public. It runs
+// after the name resolution, on the address actually dialed.
+func dialPublic(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// deliveryError describes a failed request for the delivery log, without the
+// addresses and network details of the raw error.
+func deliveryError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrForbiddenAddress):
+		return ErrForbiddenAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "receiver timed out"
+	default:
+		return "could not connect to the receiver"
+	}
+}
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPublic(t *testing.T) {
+	t.Parallel()
+
+	for address, public := range map[string]bool{
+		"93.184.215.14":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.0.0.1":        false,
+		"172.16.5.4":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"0.1.2.3":         false,
+		"224.0.0.1":       false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		assert.Equal(t, public, IsPublic(net.ParseIP(address)), address)
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	t.Run("refuses to dial private addresses", func(t *testing.T) {
+		_, err := NewClient(time.Second).Post(receiver.URL, "application/json", nil)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrForbiddenAddress)
+		assert.Equal(t, ErrForbiddenAddress.Error(), deliveryError(err))
+	})
+
+	t.Run("does not follow redirects", func(t *testing.T) {
+		client := NewClient(time.Second)
+		client.Transport = receiver.Client().Transport
+		resp, err := client.Post(receiver.URL, "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+	})
+
+	assert.Equal(t, "could not connect to the receiver", deliveryError(errors.New("dial tcp 10.0.0.1:22: connection refused")))
+}
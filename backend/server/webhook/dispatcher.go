@@ -0,0 +1,166 @@
+// Package webhook posts the webhook notifications queued in the outbox.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature of a payload sent at timestamp: "sha256=" and
+// the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// subscription secret. Receivers should also reject old timestamps to
+// prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher periodically posts the due deliveries. Failed deliveries are
+// retried with exponential backoff until MaxAttempts is reached. A single
+// dispatcher must run per database.
+type Dispatcher struct {
+	DB            *bun.DB
+	Client        *http.Client
+	EncryptionKey []byte
+
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	// The first retry waits Backoff, then the delay doubles up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	now func() time.Time
+}
+
+// Run dispatches deliveries every Interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			log.Err(err).Msg("webhook dispatch error")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue posts the deliveries that are due and returns how many were
+// attempted.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	deliveries, err := service.DueWebhookDeliveries(ctx, d.DB, d.clock(), d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		d.attempt(ctx, &deliveries[i])
+		if err := service.RecordWebhookAttempt(ctx, d.DB, &deliveries[i]); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) clock() time.Time {
+	if d.now != nil {
+		return d.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// attempt posts delivery once and updates its status for the next attempt.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	now := d.clock()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+
+	status, err := d.post(ctx, delivery, now)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = models.DeliveryStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.NextAttemptAt = nil
+		log.Warn().Err(err).Int("delivery", delivery.ID).Msg("webhook delivery failed, giving up")
+		return
+	}
+	next := now.Add(utils.Backoff(delivery.Attempts, d.Backoff, d.MaxBackoff))
+	delivery.NextAttemptAt = &next
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	secret, err := utils.Decrypt(d.EncryptionKey, delivery.Subscription.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("decrypting secret: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "expense-manager-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		// the delivery log is shown to the subscriber
+		log.Warn().Err(err).Int("delivery", delivery.ID).Msg("webhook request error")
+		return 0, errors.New(deliveryError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Spiria-Digital/expense-manager/server/models"
+	"github.com/Spiria-Digital/expense-manager/server/service"
+	"github.com/Spiria-Digital/expense-manager/server/storage"
+	"github.com/Spiria-Digital/expense-manager/server/utils"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(storage.GetRootDir(), "expenses.db")
+	db, err := storage.NewBunDB(filePath)
+	require.NoError(t, err)
+
+	user := &models.User{Email: "webhook.receiver@test.com", Password: "unused", FirstName: "Wendy", LastName: "Hook"}
+	require.NoError(t, service.CreateUser(context.Background(), db, user))
+	t.Cleanup(func() {
+		require.NoError(t, service.DeleteUser(context.Background(), db, user.ID))
+		require.NoError(t, db.Close())
+	})
+
+	// the receiver fails the first delivery, then accepts everything
+	var mu sync.Mutex
+	var requests []received
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{header: r.Header.Clone(), body: body})
+		if len(requests) == 1 {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	key := make([]byte, 32)
+	encrypted, err := utils.Encrypt(key, "shared-secret")
+	require.NoError(t, err)
+	subscription := &models.WebhookSubscription{
+		UserID: user.ID,
+		URL:    receiver.URL,
+		Events: []string{models.WebhookEventExpenseCreated, models.WebhookEventExpenseDeleted},
+		Secret: encrypted,
+	}
+	require.NoError(t, service.CreateWebhook(context.Background(), db, subscription))
+
+	now := time.Now().UTC()
+	d := &Dispatcher{
+		DB:            db,
+		Client:        receiver.Client(),
+		EncryptionKey: key,
+		BatchSize:     10,
+		MaxAttempts:   3,
+		Backoff:       time.Minute,
+		MaxBackoff:    time.Hour,
+		now:           func() time.Time { return now },
+	}
+	deliveries := func() []models.WebhookDelivery {
+		list, err := service.ListWebhookDeliveries(context.Background(), db, subscription.ID, user.ID, 10)
+		require.NoError(t, err)
+		return list
+	}
+
+	expense := &models.Expense{OwnerID: user.ID, Title: "Hooked", Date: now, Amount: 12}
+	require.NoError(t, service.CreateExpense(context.Background(), db, expense))
+	require.NoError(t, service.UpdateExpense(context.Background(), db, expense))
+	now = time.Now().UTC()
+	list := deliveries()
+	require.Len(t, list, 1, "updates are not subscribed")
+	assert.Equal(t, models.DeliveryStatusPending, list[0].Status)
+
+	t.Run("failed attempt is retried later", func(t *testing.T) {
+		_, err := d.DispatchDue(context.Background())
+		require.NoError(t, err)
+
+		delivery := deliveries()[0]
+		assert.Equal(t, models.DeliveryStatusPending, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+		assert.Contains(t, delivery.LastError, "503")
+		require.NotNil(t, delivery.NextAttemptAt)
+		assert.WithinDuration(t, now.Add(time.Minute), *delivery.NextAttemptAt, time.Second)
+
+		// not due yet
+		_, err = d.DispatchDue(context.Background())
+		require.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, requests, 1)
+	})
+
+	t.Run("signed delivery", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		_, err := d.DispatchDue(context.Background())
+		require.NoError(t, err)
+
+		delivery := deliveries()[0]
+		assert.Equal(t, models.DeliveryStatusDelivered, delivery.Status)
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.NotNil(t, delivery.DeliveredAt)
+		assert.Empty(t, delivery.LastError)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, requests, 2)
+		last := requests[1]
+		assert.Equal(t, models.WebhookEventExpenseCreated, last.header.Get(HeaderEvent))
+		assert.Equal(t, strconv.Itoa(delivery.ID), last.header.Get(HeaderDelivery))
+		assert.Equal(t, requests[0].header.Get(HeaderEventID), last.header.Get(HeaderEventID), "retries keep the event ID")
+
+		timestamp, err := strconv.ParseInt(last.header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, now.Unix(), timestamp)
+		assert.Equal(t, Sign("shared-secret", timestamp, last.body), last.header.Get(HeaderSignature))
+
+		var payload struct {
+			Event string                 `json:"event"`
+			Data  models.ExpenseResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(last.body, &payload))
+		assert.Equal(t, models.WebhookEventExpenseCreated, payload.Event)
+		assert.Equal(t, expense.ID, payload.Data.ID)
+		assert.Equal(t, user.ID, payload.Data.OwnerID)
+		assert.Contains(t, string(last.body), `"ownerId":`, "the payload is the API view of the expense")
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		receiver.Close()
+		require.NoError(t, service.DeleteExpense(context.Background(), db, expense.ID, user.ID))
+
+		for i := 0; i < d.MaxAttempts; i++ {
+			now = now.Add(2 * time.Hour)
+			_, err := d.DispatchDue(context.Background())
+			require.NoError(t, err)
+		}
+
+		delivery := deliveries()[0]
+		assert.Equal(t, models.WebhookEventExpenseDeleted, delivery.Event)
+		assert.Equal(t, models.DeliveryStatusFailed, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.Nil(t, delivery.NextAttemptAt)
+		assert.NotEmpty(t, delivery.LastError)
+	})
+}